@@ -10,6 +10,7 @@ import (
 	"github.com/AntonPashechko/yametrix/internal/agent/config"
 	"github.com/AntonPashechko/yametrix/internal/agent/sender"
 	"github.com/AntonPashechko/yametrix/internal/agent/updater"
+	"github.com/AntonPashechko/yametrix/internal/encrypt"
 	"github.com/AntonPashechko/yametrix/internal/models"
 	"github.com/AntonPashechko/yametrix/internal/sign"
 )
@@ -21,25 +22,40 @@ func main() {
 		log.Fatalf("cannot load config: %s\n", err)
 	}
 
-	//Инициализируем подписанта, если задан key
+	//Инициализируем подписанта, если задан key; ID ключа сервер ищет в своем keyring
 	if cfg.SignKey != `` {
-		sign.Initialize([]byte(cfg.SignKey))
+		sign.Initialize(cfg.SignKeyID, []byte(cfg.SignKey))
+	}
+
+	//Шифруем тело запросов открытым ключом сервера, если он задан
+	if cfg.CryptoKey != `` {
+		if err := encrypt.InitializeEncryptor(cfg.CryptoKey); err != nil {
+			log.Fatalf("cannot initialize encryptor: %s\n", err)
+		}
 	}
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	runtime := updater.NewRuntimeMetricsProducer(cfg)
-	another := updater.NewAnotherMetricsProducer(cfg)
-	consumer := sender.NewMetricsConsumer(cfg)
+	//Коллекторы регистрируются в пакете updater, здесь только включенные в конфиге
+	collectors, err := updater.NewCollectors(cfg)
+	if err != nil {
+		log.Fatalf("cannot create collectors: %s\n", err)
+	}
+
+	consumer, err := sender.NewMetricsConsumer(cfg)
+	if err != nil {
+		log.Fatalf("cannot create metrics consumer: %s\n", err)
+	}
 
 	metricCh := make(chan models.MetricDTO)
 
 	var wg sync.WaitGroup
-	wg.Add(3)
+	wg.Add(len(collectors) + 1)
 
-	go runtime.Work(ctx, &wg, metricCh)
-	go another.Work(ctx, &wg, metricCh)
+	for _, collector := range collectors {
+		go collector.Work(ctx, &wg, metricCh)
+	}
 	go consumer.Work(ctx, &wg, metricCh)
 
 	wg.Wait()
@@ -19,6 +19,10 @@ func main() {
 		log.Fatalf("cannot load config: %s\n", err)
 	}
 
+	if err := logger.SetLevel(cfg.LogLevel); err != nil {
+		log.Fatalf("cannot set log level: %s\n", err)
+	}
+
 	app, err := app.Create(cfg)
 	if err != nil {
 		logger.Error("cannot create app: %s", err)
@@ -5,32 +5,145 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/AntonPashechko/yametrix/pkg/utils"
 )
 
 type Config struct {
 	ServerEndpoint string
+	GRPCEndpoint   string //если задан - метрики отправляются по gRPC
 	ReportInterval int64
 	PollInterval   int64
 	SignKey        string
+	SignKeyID      string //ID ключа агента на сервере, пусто - общий ключ
+	Token          string //API токен с областью доступа write, пусто - не передается
+	Tenant         string //тенант метрик, пусто - тенант токена или общее пространство
+	CryptoKey      string //путь к открытому ключу сервера, пусто - тело запросов не шифруется
+	TLSCA          string //CA бандл для проверки сертификата сервера, пусто - системные CA
+	TLSCert        string //клиентский сертификат для mTLS
+	TLSKey         string
+	RateLimit      int64  //количество одновременных запросов к серверу
+	QueuePath      string //пусто - неотправленные батчи не сохраняются
+	QueueLimit     int64
+	ProcessNames   []string //пусто - метрики процесса только самого агента
+
+	ExecCommands []string //команды exec коллектора, запускаются через sh -c
+	ExecTimeout  time.Duration
+
+	ScrapeTargets []string //адреса Prometheus эндпоинтов для опроса
+
+	Collectors         []string                 //включенные коллекторы, пусто - все зарегистрированные
+	CollectorIntervals map[string]time.Duration //свои интервалы опроса коллекторов, остальные - PollInterval
+}
+
+// TLSEnabled - ходить на сервер по TLS: задан CA или клиентский сертификат
+func (m *Config) TLSEnabled() bool {
+	return m.TLSCA != "" || m.TLSCert != ""
+}
+
+// parseInterval разбирает интервал, заданный как 10 (секунды) или 10s
+func parseInterval(value string) (time.Duration, error) {
+	if duration, err := time.ParseDuration(value); err == nil {
+		return duration, nil
+	}
+
+	seconds, err := utils.StrToInt64(value)
+	if err != nil {
+		return 0, fmt.Errorf("bad interval %s", value)
+	}
+
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// parseList разбирает список через запятую, пустые элементы пропускаются
+func parseList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}
+
+// parseCollectorIntervals разбирает интервалы вида disk=30s,process=5
+func parseCollectorIntervals(value string) (map[string]time.Duration, error) {
+	intervals := make(map[string]time.Duration)
+
+	for _, item := range parseList(value) {
+		name, interval, found := strings.Cut(item, "=")
+		if !found {
+			return nil, fmt.Errorf("expected name=interval, got %s", item)
+		}
+
+		duration, err := parseInterval(strings.TrimSpace(interval))
+		if err != nil {
+			return nil, err
+		}
+		if duration <= 0 {
+			return nil, fmt.Errorf("interval of %s must be positive", name)
+		}
+
+		intervals[strings.TrimSpace(name)] = duration
+	}
+
+	return intervals, nil
 }
 
 func LoadAgentConfig() (*Config, error) {
 	cfg := new(Config)
 	/*Получаем параметры из командной строки*/
+	configPath := new(string)
+	flag.StringVar(configPath, "c", "", "config file path, json or yaml")
+	flag.StringVar(configPath, "config", "", "config file path, json or yaml")
 	flag.StringVar(&cfg.ServerEndpoint, "a", "http://localhost:8080", "server address and port")
+	flag.StringVar(&cfg.GRPCEndpoint, "g", "", "grpc server address and port")
 	flag.Int64Var(&cfg.ReportInterval, "r", 10, "report interval")
 	flag.Int64Var(&cfg.PollInterval, "p", 2, "poll interval")
 	flag.StringVar(&cfg.SignKey, "k", "", "sign key")
+	flag.StringVar(&cfg.SignKeyID, "kid", "", "sign key id")
+	flag.StringVar(&cfg.Token, "token", "", "server API token")
+	flag.StringVar(&cfg.Tenant, "tenant", "", "metrics tenant")
+	flag.StringVar(&cfg.CryptoKey, "crypto-key", "", "server public key path to encrypt requests")
+	flag.StringVar(&cfg.TLSCA, "tls-ca", "", "CA bundle path to verify server certificate")
+	flag.StringVar(&cfg.TLSCert, "tls-cert", "", "agent TLS certificate path for mTLS")
+	flag.StringVar(&cfg.TLSKey, "tls-key", "", "agent TLS private key path for mTLS")
+	flag.Int64Var(&cfg.RateLimit, "l", 1, "max concurrent requests to server")
+	flag.StringVar(&cfg.QueuePath, "q", "", "unsent batches queue dir, empty - unsent batches are dropped")
+	flag.Int64Var(&cfg.QueueLimit, "ql", 100, "unsent batches queue limit")
+	processNames := flag.String("pn", "", "comma separated process names to monitor")
+	execCommands := flag.String("e", "", "semicolon separated commands printing metrics")
+	execTimeout := flag.String("et", "5s", "exec command timeout")
+	scrapeTargets := flag.String("st", "", "comma separated prometheus endpoints to scrape")
+	collectors := flag.String("cl", "", "comma separated enabled collectors, all by default (/proc ones only on linux)")
+	collectorIntervals := flag.String("ci", "", "collector poll intervals, e.g. disk=30s,process=5s")
 
 	flag.Parse()
 
+	/*Файл конфигурации - самый низкий приоритет, поверх него env и флаги*/
+	if *configPath == "" {
+		if path, exist := os.LookupEnv("CONFIG"); exist {
+			*configPath = path
+		}
+	}
+
+	if *configPath != "" {
+		if err := loadFile(*configPath); err != nil {
+			return nil, err
+		}
+	}
+
 	/*Но если заданы в окружении - берем оттуда*/
 	if addr, exist := os.LookupEnv("ADDRESS"); exist {
 		cfg.ServerEndpoint = addr
 	}
 
+	if grpcAddr, exist := os.LookupEnv("GRPC_ADDRESS"); exist {
+		cfg.GRPCEndpoint = grpcAddr
+	}
+
 	if interval, exist := os.LookupEnv("REPORT_INTERVAL"); exist {
 		val, err := utils.StrToInt64(interval)
 		if err != nil {
@@ -51,8 +164,127 @@ func LoadAgentConfig() (*Config, error) {
 		cfg.SignKey = signKey
 	}
 
+	if keyID, exist := os.LookupEnv("KEY_ID"); exist {
+		cfg.SignKeyID = keyID
+	}
+
+	if token, exist := os.LookupEnv("TOKEN"); exist {
+		cfg.Token = token
+	}
+
+	if tenant, exist := os.LookupEnv("TENANT"); exist {
+		cfg.Tenant = tenant
+	}
+
+	if cryptoKey, exist := os.LookupEnv("CRYPTO_KEY"); exist {
+		cfg.CryptoKey = cryptoKey
+	}
+
+	if tlsCA, exist := os.LookupEnv("TLS_CA"); exist {
+		cfg.TLSCA = tlsCA
+	}
+
+	if tlsCert, exist := os.LookupEnv("TLS_CERT"); exist {
+		cfg.TLSCert = tlsCert
+	}
+
+	if tlsKey, exist := os.LookupEnv("TLS_KEY"); exist {
+		cfg.TLSKey = tlsKey
+	}
+
+	if limit, exist := os.LookupEnv("RATE_LIMIT"); exist {
+		val, err := utils.StrToInt64(limit)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse RATE_LIMIT env: %w", err)
+		}
+		cfg.RateLimit = val
+	}
+
+	if queuePath, exist := os.LookupEnv("QUEUE_PATH"); exist {
+		cfg.QueuePath = queuePath
+	}
+
+	if limit, exist := os.LookupEnv("QUEUE_LIMIT"); exist {
+		val, err := utils.StrToInt64(limit)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse QUEUE_LIMIT env: %w", err)
+		}
+		cfg.QueueLimit = val
+	}
+
+	if names, exist := os.LookupEnv("PROCESS_NAMES"); exist {
+		*processNames = names
+	}
+
+	if commands, exist := os.LookupEnv("EXEC_COMMANDS"); exist {
+		*execCommands = commands
+	}
+
+	if timeout, exist := os.LookupEnv("EXEC_TIMEOUT"); exist {
+		*execTimeout = timeout
+	}
+
+	if targets, exist := os.LookupEnv("SCRAPE_TARGETS"); exist {
+		*scrapeTargets = targets
+	}
+
+	if names, exist := os.LookupEnv("COLLECTORS"); exist {
+		*collectors = names
+	}
+
+	if intervals, exist := os.LookupEnv("COLLECTOR_INTERVALS"); exist {
+		*collectorIntervals = intervals
+	}
+
+	/*Явно заданные флаги важнее всего - разбираем командную строку еще раз поверх файла и env*/
+	flag.Parse()
+
+	if cfg.ReportInterval <= 0 {
+		return nil, fmt.Errorf("bad param REPORT_INTERVAL: must be positive")
+	}
+	if cfg.PollInterval <= 0 {
+		return nil, fmt.Errorf("bad param POLL_INTERVAL: must be positive")
+	}
+	if cfg.RateLimit <= 0 {
+		return nil, fmt.Errorf("bad param RATE_LIMIT: must be positive")
+	}
+
+	if (cfg.TLSCert == "") != (cfg.TLSKey == "") {
+		return nil, fmt.Errorf("bad params TLS_CERT and TLS_KEY: must be set both")
+	}
+
+	//gRPC отправка тело не шифрует, для нее есть TLS - молча слать открытым текстом нельзя
+	if cfg.GRPCEndpoint != "" && cfg.CryptoKey != "" {
+		return nil, fmt.Errorf("bad params GRPC_ADDRESS and CRYPTO_KEY: grpc requests are not encrypted with CRYPTO_KEY, use TLS_CA instead")
+	}
+
+	cfg.ProcessNames = parseList(*processNames)
+
+	for _, command := range strings.Split(*execCommands, ";") {
+		if command = strings.TrimSpace(command); command != "" {
+			cfg.ExecCommands = append(cfg.ExecCommands, command)
+		}
+	}
+
+	var err error
+	if cfg.ExecTimeout, err = parseInterval(*execTimeout); err != nil || cfg.ExecTimeout <= 0 {
+		return nil, fmt.Errorf("bad param EXEC_TIMEOUT: %s", *execTimeout)
+	}
+
+	cfg.ScrapeTargets = parseList(*scrapeTargets)
+	cfg.Collectors = parseList(*collectors)
+
+	if cfg.CollectorIntervals, err = parseCollectorIntervals(*collectorIntervals); err != nil {
+		return nil, fmt.Errorf("cannot parse collector intervals: %w", err)
+	}
+
+	//Схему по умолчанию выбираем по наличию TLS настроек
 	if !strings.HasPrefix(cfg.ServerEndpoint, "http") && !strings.HasPrefix(cfg.ServerEndpoint, "https") {
-		cfg.ServerEndpoint = "http://" + cfg.ServerEndpoint
+		if cfg.TLSEnabled() {
+			cfg.ServerEndpoint = "https://" + cfg.ServerEndpoint
+		} else {
+			cfg.ServerEndpoint = "http://" + cfg.ServerEndpoint
+		}
 	}
 
 	return cfg, nil
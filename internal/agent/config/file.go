@@ -0,0 +1,75 @@
+package config
+
+import (
+	"github.com/AntonPashechko/yametrix/internal/configfile"
+)
+
+// fileOptions - настройки из файла конфигурации, ключи как у переменных окружения
+type fileOptions struct {
+	Address            *configfile.Value           `json:"address" yaml:"address"`
+	GRPCAddress        *configfile.Value           `json:"grpc_address" yaml:"grpc_address"`
+	ReportInterval     *configfile.Value           `json:"report_interval" yaml:"report_interval"`
+	PollInterval       *configfile.Value           `json:"poll_interval" yaml:"poll_interval"`
+	Key                *configfile.Value           `json:"key" yaml:"key"`
+	KeyID              *configfile.Value           `json:"key_id" yaml:"key_id"`
+	Token              *configfile.Value           `json:"token" yaml:"token"`
+	Tenant             *configfile.Value           `json:"tenant" yaml:"tenant"`
+	CryptoKey          *configfile.Value           `json:"crypto_key" yaml:"crypto_key"`
+	TLSCA              *configfile.Value           `json:"tls_ca" yaml:"tls_ca"`
+	TLSCert            *configfile.Value           `json:"tls_cert" yaml:"tls_cert"`
+	TLSKey             *configfile.Value           `json:"tls_key" yaml:"tls_key"`
+	RateLimit          *configfile.Value           `json:"rate_limit" yaml:"rate_limit"`
+	QueuePath          *configfile.Value           `json:"queue_path" yaml:"queue_path"`
+	QueueLimit         *configfile.Value           `json:"queue_limit" yaml:"queue_limit"`
+	ProcessNames       []string                    `json:"process_names" yaml:"process_names"`
+	ExecCommands       []string                    `json:"exec_commands" yaml:"exec_commands"`
+	ExecTimeout        *configfile.Value           `json:"exec_timeout" yaml:"exec_timeout"`
+	ScrapeTargets      []string                    `json:"scrape_targets" yaml:"scrape_targets"`
+	Collectors         []string                    `json:"collectors" yaml:"collectors"`
+	CollectorIntervals map[string]configfile.Value `json:"collector_intervals" yaml:"collector_intervals"`
+}
+
+// loadFile читает файл конфигурации и выставляет его значения флагам,
+// поверх потом идут env и еще раз флаги командной строки
+func loadFile(path string) error {
+	var file fileOptions
+	if err := configfile.Load(path, &file); err != nil {
+		return err
+	}
+
+	values := []struct {
+		key   string
+		flag  string
+		value *configfile.Value
+	}{
+		{"address", "a", file.Address},
+		{"grpc_address", "g", file.GRPCAddress},
+		{"report_interval", "r", file.ReportInterval},
+		{"poll_interval", "p", file.PollInterval},
+		{"key", "k", file.Key},
+		{"key_id", "kid", file.KeyID},
+		{"token", "token", file.Token},
+		{"tenant", "tenant", file.Tenant},
+		{"crypto_key", "crypto-key", file.CryptoKey},
+		{"tls_ca", "tls-ca", file.TLSCA},
+		{"tls_cert", "tls-cert", file.TLSCert},
+		{"tls_key", "tls-key", file.TLSKey},
+		{"rate_limit", "l", file.RateLimit},
+		{"queue_path", "q", file.QueuePath},
+		{"queue_limit", "ql", file.QueueLimit},
+		{"process_names", "pn", configfile.List(file.ProcessNames, ",")},
+		{"exec_commands", "e", configfile.List(file.ExecCommands, ";")},
+		{"exec_timeout", "et", file.ExecTimeout},
+		{"scrape_targets", "st", configfile.List(file.ScrapeTargets, ",")},
+		{"collectors", "cl", configfile.List(file.Collectors, ",")},
+		{"collector_intervals", "ci", configfile.Map(file.CollectorIntervals)},
+	}
+
+	for _, v := range values {
+		if err := configfile.SetFlag(v.key, v.flag, v.value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
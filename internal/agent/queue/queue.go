@@ -0,0 +1,149 @@
+package queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/AntonPashechko/yametrix/internal/models"
+)
+
+const (
+	batchExt = ".json"
+	tmpExt   = ".tmp"
+)
+
+// Queue - ограниченная очередь неотправленных батчей метрик на диске.
+// Каждый батч лежит в отдельном файле, имя - порядковый номер, так порядок переживает рестарт агента.
+// Сама очередь не синхронизирована: ее пополняют воркеры отправки, а разгружает горутина разгрузки,
+// поэтому доступ к ней идет под блокировкой отправителя
+type Queue struct {
+	dir   string
+	limit int
+	seqs  []uint64 //номера батчей в очереди по возрастанию
+	next  uint64
+}
+
+// NewQueue открывает очередь в каталоге dir, подхватывая оставшиеся с прошлого запуска батчи
+func NewQueue(dir string, limit int) (*Queue, error) {
+	if limit <= 0 {
+		return nil, fmt.Errorf("bad queue limit %d", limit)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("cannot create queue dir: %w", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read queue dir: %w", err)
+	}
+
+	q := &Queue{
+		dir:   dir,
+		limit: limit,
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		//Недописанные файлы остались от аварийного завершения - они не нужны
+		if strings.HasSuffix(name, tmpExt) {
+			os.Remove(filepath.Join(dir, name))
+			continue
+		}
+
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, batchExt), 10, 64)
+		if err != nil || !strings.HasSuffix(name, batchExt) {
+			continue
+		}
+		q.seqs = append(q.seqs, seq)
+	}
+
+	sort.Slice(q.seqs, func(i, j int) bool { return q.seqs[i] < q.seqs[j] })
+	if len(q.seqs) != 0 {
+		q.next = q.seqs[len(q.seqs)-1] + 1
+	}
+
+	return q, nil
+}
+
+func (m *Queue) path(seq uint64) string {
+	return filepath.Join(m.dir, fmt.Sprintf("%020d%s", seq, batchExt))
+}
+
+// Len - количество батчей в очереди
+func (m *Queue) Len() int {
+	return len(m.seqs)
+}
+
+// Push кладет батч в конец очереди, при переполнении выбрасываются самые старые
+func (m *Queue) Push(metrics []models.MetricDTO) (dropped int, err error) {
+	data, err := json.Marshal(metrics)
+	if err != nil {
+		return 0, fmt.Errorf("cannot encode batch: %w", err)
+	}
+
+	//Пишем через временный файл, что бы не оставить наполовину записанный батч
+	seq := m.next
+	tmp := m.path(seq) + tmpExt
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return 0, fmt.Errorf("cannot write batch: %w", err)
+	}
+	if err := os.Rename(tmp, m.path(seq)); err != nil {
+		os.Remove(tmp)
+		return 0, fmt.Errorf("cannot write batch: %w", err)
+	}
+
+	m.next++
+	m.seqs = append(m.seqs, seq)
+
+	for len(m.seqs) > m.limit {
+		if err := m.pop(); err != nil {
+			return dropped, err
+		}
+		dropped++
+	}
+
+	return dropped, nil
+}
+
+// Peek возвращает самый старый батч, не удаляя его из очереди
+func (m *Queue) Peek() ([]models.MetricDTO, bool, error) {
+	if len(m.seqs) == 0 {
+		return nil, false, nil
+	}
+
+	data, err := os.ReadFile(m.path(m.seqs[0]))
+	if err != nil {
+		return nil, true, fmt.Errorf("cannot read batch: %w", err)
+	}
+
+	var metrics []models.MetricDTO
+	if err := json.Unmarshal(data, &metrics); err != nil {
+		return nil, true, fmt.Errorf("cannot decode batch: %w", err)
+	}
+
+	return metrics, true, nil
+}
+
+// Pop удаляет самый старый батч
+func (m *Queue) Pop() error {
+	if len(m.seqs) == 0 {
+		return nil
+	}
+
+	return m.pop()
+}
+
+func (m *Queue) pop() error {
+	if err := os.Remove(m.path(m.seqs[0])); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot remove batch: %w", err)
+	}
+
+	m.seqs = m.seqs[1:]
+	return nil
+}
@@ -0,0 +1,97 @@
+package queue
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AntonPashechko/yametrix/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func batch(id string) []models.MetricDTO {
+	return []models.MetricDTO{models.NewCounterMetric(id, 1)}
+}
+
+func TestQueueOrder(t *testing.T) {
+	dir := t.TempDir()
+
+	q, err := NewQueue(dir, 10)
+	require.NoError(t, err)
+
+	for _, id := range []string{"first", "second", "third"} {
+		dropped, err := q.Push(batch(id))
+		require.NoError(t, err)
+		assert.Equal(t, 0, dropped)
+	}
+
+	metrics, ok, err := q.Peek()
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "first", metrics[0].ID)
+	require.NoError(t, q.Pop())
+
+	//Открываем заново - как после рестарта агента
+	q, err = NewQueue(dir, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 2, q.Len())
+
+	_, err = q.Push(batch("fourth"))
+	require.NoError(t, err)
+
+	var ids []string
+	for {
+		metrics, ok, err := q.Peek()
+		require.NoError(t, err)
+		if !ok {
+			break
+		}
+		ids = append(ids, metrics[0].ID)
+		require.NoError(t, q.Pop())
+	}
+	assert.Equal(t, []string{"second", "third", "fourth"}, ids)
+}
+
+func TestQueueLimit(t *testing.T) {
+	q, err := NewQueue(t.TempDir(), 2)
+	require.NoError(t, err)
+
+	tests := []struct {
+		id          string
+		wantDropped int
+	}{
+		{"first", 0},
+		{"second", 0},
+		{"third", 1},
+	}
+	for _, tt := range tests {
+		dropped, err := q.Push(batch(tt.id))
+		require.NoError(t, err)
+		assert.Equal(t, tt.wantDropped, dropped)
+	}
+
+	assert.Equal(t, 2, q.Len())
+	metrics, _, err := q.Peek()
+	require.NoError(t, err)
+	assert.Equal(t, "second", metrics[0].ID)
+}
+
+func TestQueueBrokenFiles(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "00000000000000000001.json.tmp"), []byte("["), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "00000000000000000002.json"), []byte("["), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "readme.txt"), []byte("x"), 0644))
+
+	q, err := NewQueue(dir, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, q.Len())
+	assert.NoFileExists(t, filepath.Join(dir, "00000000000000000001.json.tmp"))
+
+	_, ok, err := q.Peek()
+	assert.True(t, ok)
+	assert.Error(t, err)
+
+	_, err = NewQueue(dir, 0)
+	assert.Error(t, err)
+}
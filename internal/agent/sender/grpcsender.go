@@ -0,0 +1,147 @@
+package sender
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/AntonPashechko/yametrix/internal/agent/config"
+	"github.com/AntonPashechko/yametrix/internal/models"
+	pb "github.com/AntonPashechko/yametrix/internal/proto"
+	"github.com/AntonPashechko/yametrix/internal/sign"
+	"github.com/AntonPashechko/yametrix/internal/subnet"
+	"github.com/AntonPashechko/yametrix/internal/tenant"
+	"github.com/AntonPashechko/yametrix/internal/tlsconfig"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type grpcSender struct {
+	conn               *grpc.ClientConn
+	token              string
+	tenant             string
+	realIP             string //IP агента для проверки доверенной подсети на сервере
+	client             pb.MetricsClient
+	retriableIntervals []time.Duration
+}
+
+func newGRPCSender(cfg *config.Config) (*grpcSender, error) {
+	creds := insecure.NewCredentials()
+	if cfg.TLSEnabled() {
+		tlsConfig, err := tlsconfig.NewClientConfig(cfg.TLSCA, cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create tls config: %w", err)
+		}
+		creds = credentials.NewTLS(tlsConfig)
+	}
+
+	//Соединение ленивое, сервер может быть еще не запущен
+	conn, err := grpc.Dial(cfg.GRPCEndpoint,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultCallOptions(grpc.UseCompressor(gzip.Name)))
+	if err != nil {
+		return nil, fmt.Errorf("cannot dial grpc server: %w", err)
+	}
+
+	//Сервер может принимать метрики только из доверенной подсети, сообщаем ему свой IP
+	var realIP string
+	if ip, err := subnet.OutboundIP(cfg.GRPCEndpoint); err != nil {
+		fmt.Printf("cannot detect agent ip: %s\n", err)
+	} else {
+		realIP = ip.String()
+	}
+
+	return &grpcSender{
+		conn:               conn,
+		token:              cfg.Token,
+		tenant:             cfg.Tenant,
+		realIP:             realIP,
+		client:             pb.NewMetricsClient(conn),
+		retriableIntervals: []time.Duration{time.Second, 3 * time.Second, 5 * time.Second, time.Nanosecond},
+	}, nil
+}
+
+func (m *grpcSender) retriableUpdate(ctx context.Context, req *pb.UpdateMetricsRequest) error {
+	var err error
+
+	for _, interval := range m.retriableIntervals {
+		_, err = m.client.UpdateMetrics(ctx, req)
+		if err == nil {
+			return nil
+		}
+
+		//Неверный запрос или отказ в доступе - повтор не поможет
+		switch status.Code(err) {
+		case codes.InvalidArgument, codes.PermissionDenied, codes.Unauthenticated:
+			return fmt.Errorf("cannot update metrics: %w: %s", errRejected, err)
+		}
+
+		//Повторяем только если сервер недоступен
+		if status.Code(err) != codes.Unavailable {
+			break
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return fmt.Errorf("cannot retriable update metrics: %w", ctx.Err())
+		}
+	}
+
+	return fmt.Errorf("cannot retriable update metrics: %w", err)
+}
+
+func (m *grpcSender) send(ctx context.Context, metrics []models.MetricDTO) error {
+	req := &pb.UpdateMetricsRequest{
+		Metrics: make([]*pb.Metric, 0, len(metrics)),
+	}
+	for _, metric := range metrics {
+		req.Metrics = append(req.Metrics, pb.FromDTO(metric))
+	}
+
+	if m.token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+m.token)
+	}
+
+	if m.tenant != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, tenant.MetadataKey, m.tenant)
+	}
+
+	if m.realIP != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, subnet.MetadataKey, m.realIP)
+	}
+
+	//Проводим контроль целостности, если надо
+	if signer := sign.Shared(); signer != nil {
+		data, err := pb.SignData(req)
+		if err != nil {
+			return fmt.Errorf("cannot marshal request: %w", err)
+		}
+
+		signValue, err := signer.CreateSign(data)
+		if err != nil {
+			return fmt.Errorf("cannot sign request: %w", err)
+		}
+
+		ctx = metadata.AppendToOutgoingContext(ctx, pb.SignMetadataKey, hex.EncodeToString(signValue))
+		if keyID := signer.KeyID(); keyID != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, pb.KeyIDMetadataKey, keyID)
+		}
+	}
+
+	if err := m.retriableUpdate(ctx, req); err != nil {
+		return fmt.Errorf("cannot do request: %w", err)
+	}
+
+	return nil
+}
+
+func (m *grpcSender) close() {
+	m.conn.Close()
+}
@@ -7,16 +7,19 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/AntonPashechko/yametrix/internal/agent/config"
 	"github.com/AntonPashechko/yametrix/internal/compress"
+	"github.com/AntonPashechko/yametrix/internal/encrypt"
 	"github.com/AntonPashechko/yametrix/internal/models"
 	"github.com/AntonPashechko/yametrix/internal/sign"
-	"github.com/AntonPashechko/yametrix/internal/storage/memstorage"
+	"github.com/AntonPashechko/yametrix/internal/subnet"
+	"github.com/AntonPashechko/yametrix/internal/tenant"
+	"github.com/AntonPashechko/yametrix/internal/tlsconfig"
 	"github.com/go-resty/resty/v2"
 )
 
@@ -24,57 +27,96 @@ const (
 	updates = "updates"
 )
 
-type metricsConsumer struct {
-	storage            *memstorage.Storage
-	tickerTime         time.Duration
+type httpSender struct {
 	endpoint           string
+	realIP             string //IP агента для проверки доверенной подсети на сервере
 	client             *resty.Client
 	retriableIntervals []time.Duration
 }
 
-func NewMetricsConsumer(cfg *config.Config) *metricsConsumer {
-	return &metricsConsumer{
-		storage:            memstorage.NewStorage(),
-		tickerTime:         time.Duration(cfg.ReportInterval) * time.Second,
+func newHTTPSender(cfg *config.Config) (*httpSender, error) {
+	client := resty.New()
+
+	if cfg.Token != "" {
+		client.SetAuthToken(cfg.Token)
+	}
+
+	if cfg.Tenant != "" {
+		client.SetHeader(tenant.Header, cfg.Tenant)
+	}
+
+	//Свой CA и клиентский сертификат для mTLS, если заданы
+	if cfg.TLSEnabled() {
+		tlsConfig, err := tlsconfig.NewClientConfig(cfg.TLSCA, cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create tls config: %w", err)
+		}
+		client.SetTLSClientConfig(tlsConfig)
+	}
+
+	//Сервер может принимать метрики только из доверенной подсети, сообщаем ему свой IP
+	var realIP string
+	if ip, err := subnet.OutboundIP(cfg.ServerEndpoint); err != nil {
+		fmt.Printf("cannot detect agent ip: %s\n", err)
+	} else {
+		realIP = ip.String()
+	}
+
+	return &httpSender{
 		endpoint:           cfg.ServerEndpoint,
-		client:             resty.New(),
+		realIP:             realIP,
+		client:             client,
 		retriableIntervals: []time.Duration{time.Second, 3 * time.Second, 5 * time.Second, time.Nanosecond},
-	}
+	}, nil
 }
 
-func (m *metricsConsumer) retriablePost(req *resty.Request, postURL string) error {
+// retriablePost повторяет запрос, пока сервер недоступен или перегружен (5xx, 429).
+// Остальные ответы не 2xx - отказ в приеме батча, повтор не поможет
+func (m *httpSender) retriablePost(ctx context.Context, req *resty.Request, postURL string) error {
 	var err error
 	var urlErr *url.Error
 
 	for _, interval := range m.retriableIntervals {
-		_, err = req.Post(postURL)
+		var resp *resty.Response
+		resp, err = req.Post(postURL)
 		if err == nil {
-			return nil
-		}
-
-		if !errors.As(err, &urlErr) {
+			if resp.IsSuccess() {
+				return nil
+			}
+			if resp.StatusCode() != http.StatusTooManyRequests && resp.StatusCode() < http.StatusInternalServerError {
+				return fmt.Errorf("server respond %s: %w", resp.Status(), errRejected)
+			}
+			err = fmt.Errorf("server respond %s", resp.Status())
+		} else if !errors.As(err, &urlErr) || ctx.Err() != nil {
 			break
 		}
 
-		time.Sleep(interval)
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return fmt.Errorf("cannot retriable post metric: %w", ctx.Err())
+		}
 	}
 
 	return fmt.Errorf("cannot retriable post metric: %w", err)
 }
 
-func (m *metricsConsumer) postMetrics(buf []byte) error {
+func (m *httpSender) postMetrics(ctx context.Context, buf []byte) error {
 
 	//Создали клиента
-	req := m.client.R()
+	req := m.client.R().SetContext(ctx)
 
 	//Проводим контроль целостности, если надо
-	if sign.MetricsSigner != nil {
-		sign, err := sign.MetricsSigner.CreateSign(buf)
+	if signer := sign.Shared(); signer != nil {
+		signValue, err := signer.CreateSign(buf)
 		if err != nil {
 			return fmt.Errorf("cannot sign request body: %w", err)
 		}
 
-		req.SetHeader("HashSHA256", hex.EncodeToString(sign))
+		req.SetHeader(sign.Header, hex.EncodeToString(signValue))
+		if keyID := signer.KeyID(); keyID != "" {
+			req.SetHeader(sign.KeyIDHeader, keyID)
+		}
 	}
 
 	//Компресим (после расчета для контроля целостности)
@@ -83,11 +125,24 @@ func (m *metricsConsumer) postMetrics(buf []byte) error {
 		return fmt.Errorf("cannot compress data: %w", err)
 	}
 
+	//Шифруем последним, сервер расшифровывает до декомпрессии
+	if encrypt.MetricsEncryptor != nil {
+		buf, err = encrypt.MetricsEncryptor.Encrypt(buf)
+		if err != nil {
+			return fmt.Errorf("cannot encrypt data: %w", err)
+		}
+		req.SetHeader(encrypt.Header, encrypt.Scheme)
+	}
+
+	if m.realIP != "" {
+		req.SetHeader(subnet.Header, m.realIP)
+	}
+
 	req.SetHeader("Content-Type", "application/json").
 		SetHeader("Content-Encoding", "gzip").
 		SetBody(buf)
 
-	err = m.retriablePost(req, strings.Join([]string{m.endpoint, updates}, "/"))
+	err = m.retriablePost(ctx, req, strings.Join([]string{m.endpoint, updates}, "/"))
 	if err != nil {
 		return fmt.Errorf("cannot do request: %w", err)
 	}
@@ -95,38 +150,13 @@ func (m *metricsConsumer) postMetrics(buf []byte) error {
 	return nil
 }
 
-func (m *metricsConsumer) Work(ctx context.Context, wg *sync.WaitGroup, metricCh <-chan models.MetricDTO) {
-
-	defer wg.Done()
-
-	ticker := time.NewTicker(m.tickerTime)
-
-	for {
-		select {
-		// выход по ctx
-		case <-ctx.Done():
-			return
-		//Сохораняем приходящие метрики от поставщиков
-		case mertic := <-metricCh:
-			m.storage.ApplyMetric(ctx, mertic)
-		// отправляем накопленые метрики на сервер
-		case <-ticker.C:
-			metrics := m.storage.GetAllMetrics()
-
-			//В ЗАДАНИИ СКАЗАНО отправлять пустые батчи не нужно; (12 инкремент)
-			if len(metrics) == 0 {
-				break
-			}
-
-			buf := new(bytes.Buffer)
-			if err := json.NewEncoder(buf).Encode(metrics); err != nil {
-				fmt.Printf("error encoding metrics %s\n", err)
-			}
-
-			err := m.postMetrics(buf.Bytes())
-			if err != nil {
-				fmt.Printf("cannot send metrics batch: %s\n", err)
-			}
-		}
+func (m *httpSender) send(ctx context.Context, metrics []models.MetricDTO) error {
+	buf := new(bytes.Buffer)
+	if err := json.NewEncoder(buf).Encode(metrics); err != nil {
+		return fmt.Errorf("error encoding metrics: %w", err)
 	}
+
+	return m.postMetrics(ctx, buf.Bytes())
 }
+
+func (m *httpSender) close() {}
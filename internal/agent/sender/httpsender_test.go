@@ -0,0 +1,49 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AntonPashechko/yametrix/internal/agent/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPSenderStatus(t *testing.T) {
+	tests := []struct {
+		name      string
+		code      int
+		wantCalls int
+		wantErr   bool
+		rejected  bool
+	}{
+		{"ok", http.StatusOK, 1, false, false},
+		{"bad_request", http.StatusBadRequest, 1, true, true},
+		{"forbidden", http.StatusForbidden, 1, true, true},
+		{"too_many_requests", http.StatusTooManyRequests, 2, true, false},
+		{"unavailable", http.StatusServiceUnavailable, 2, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				w.WriteHeader(tt.code)
+			}))
+			defer ts.Close()
+
+			sender, err := newHTTPSender(&config.Config{ServerEndpoint: ts.URL})
+			require.NoError(t, err)
+			sender.retriableIntervals = []time.Duration{time.Millisecond, time.Millisecond}
+
+			err = sender.send(context.Background(), batch("PollCount"))
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.rejected, errors.Is(err, errRejected))
+			assert.Equal(t, tt.wantCalls, calls)
+		})
+	}
+}
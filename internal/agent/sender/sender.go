@@ -0,0 +1,266 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/AntonPashechko/yametrix/internal/agent/config"
+	"github.com/AntonPashechko/yametrix/internal/agent/queue"
+	"github.com/AntonPashechko/yametrix/internal/models"
+	"github.com/AntonPashechko/yametrix/internal/storage/memstorage"
+)
+
+// errRejected - сервер отказался принять батч, повтор не поможет, поэтому в очередь его не кладем
+var errRejected = errors.New("metrics batch rejected")
+
+// metricsSender - транспорт, которым батч метрик уходит на сервер
+type metricsSender interface {
+	send(ctx context.Context, metrics []models.MetricDTO) error
+	close()
+}
+
+type metricsConsumer struct {
+	storage    *memstorage.Storage
+	tickerTime time.Duration
+	sender     metricsSender
+	rateLimit  int                     //количество воркеров, т.е. одновременных запросов к серверу
+	jobs       chan []models.MetricDTO //буфер батчей, при переполнении батчи уходят в очередь на диске
+	queue      *queue.Queue            //nil - батчи при недоступности сервера теряются
+	queueMux   sync.Mutex              //очередь пополняют все воркеры
+	//Очередь разгружает одна отдельная горутина, по сигналу, так батчи из нее уходят строго по порядку
+	flushCh chan struct{}
+}
+
+func NewMetricsConsumer(cfg *config.Config) (*metricsConsumer, error) {
+	if cfg.RateLimit <= 0 {
+		return nil, fmt.Errorf("bad rate limit %d", cfg.RateLimit)
+	}
+
+	//Если задан адрес gRPC сервера - отправляем через него, иначе по http
+	var sender metricsSender
+	if cfg.GRPCEndpoint != "" {
+		grpcSender, err := newGRPCSender(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create grpc sender: %w", err)
+		}
+		sender = grpcSender
+	} else {
+		httpSender, err := newHTTPSender(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create http sender: %w", err)
+		}
+		sender = httpSender
+	}
+
+	//Очередь неотправленных батчей, если задан каталог
+	var sendQueue *queue.Queue
+	if cfg.QueuePath != "" {
+		var err error
+		sendQueue, err = queue.NewQueue(cfg.QueuePath, int(cfg.QueueLimit))
+		if err != nil {
+			return nil, fmt.Errorf("cannot open send queue: %w", err)
+		}
+	}
+
+	return &metricsConsumer{
+		storage:    memstorage.NewStorage(),
+		tickerTime: time.Duration(cfg.ReportInterval) * time.Second,
+		sender:     sender,
+		rateLimit:  int(cfg.RateLimit),
+		jobs:       make(chan []models.MetricDTO, cfg.RateLimit),
+		queue:      sendQueue,
+		flushCh:    make(chan struct{}, 1),
+	}, nil
+}
+
+func (m *metricsConsumer) queueLen() int {
+	if m.queue == nil {
+		return 0
+	}
+
+	m.queueMux.Lock()
+	defer m.queueMux.Unlock()
+
+	return m.queue.Len()
+}
+
+// enqueue кладет батч в очередь на диске, без очереди батч теряется
+func (m *metricsConsumer) enqueue(metrics []models.MetricDTO) {
+	if m.queue == nil {
+		fmt.Printf("metrics batch of %d metrics dropped\n", len(metrics))
+		return
+	}
+
+	m.queueMux.Lock()
+	defer m.queueMux.Unlock()
+
+	dropped, err := m.queue.Push(metrics)
+	if err != nil {
+		fmt.Printf("cannot enqueue metrics batch: %s\n", err)
+	}
+	if dropped != 0 {
+		fmt.Printf("send queue is full, %d oldest batches dropped\n", dropped)
+	}
+}
+
+// peek и pop - доступ к голове очереди под блокировкой
+func (m *metricsConsumer) peek() ([]models.MetricDTO, bool, error) {
+	m.queueMux.Lock()
+	defer m.queueMux.Unlock()
+
+	return m.queue.Peek()
+}
+
+func (m *metricsConsumer) pop() error {
+	m.queueMux.Lock()
+	defer m.queueMux.Unlock()
+
+	return m.queue.Pop()
+}
+
+// flush отправляет батчи из очереди по порядку, до первой ошибки
+func (m *metricsConsumer) flush(ctx context.Context) {
+	for ctx.Err() == nil {
+		metrics, ok, err := m.peek()
+		if !ok {
+			return
+		}
+
+		//Битый батч отправить все равно не получится, выбрасываем
+		if err != nil {
+			fmt.Printf("cannot read queued batch, drop it: %s\n", err)
+			if err := m.pop(); err != nil {
+				fmt.Printf("cannot drop queued batch: %s\n", err)
+				return
+			}
+			continue
+		}
+
+		if err := m.sender.send(ctx, metrics); err != nil {
+			if !errors.Is(err, errRejected) {
+				fmt.Printf("cannot send metrics batch, %d batches queued: %s\n", m.queueLen(), err)
+				return
+			}
+			fmt.Printf("queued metrics batch rejected, drop it: %s\n", err)
+		}
+
+		if err := m.pop(); err != nil {
+			fmt.Printf("cannot remove sent batch from queue: %s\n", err)
+			return
+		}
+	}
+}
+
+// submit отдает батч воркерам не блокируясь, что бы медленный сервер не тормозил сбор метрик
+func (m *metricsConsumer) submit(metrics []models.MetricDTO) bool {
+	select {
+	case m.jobs <- metrics:
+		return true
+	default:
+		return false
+	}
+}
+
+// startFlush будит горутину разгрузки очереди, если она уже разгружает - сигнал дождется ее в буфере
+func (m *metricsConsumer) startFlush() {
+	select {
+	case m.flushCh <- struct{}{}:
+	default:
+	}
+}
+
+// flusher разгружает очередь по сигналам, завершается после закрытия flushCh
+func (m *metricsConsumer) flusher(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	for range m.flushCh {
+		m.flush(ctx)
+	}
+}
+
+// report отдает накопленные метрики на отправку
+func (m *metricsConsumer) report(metrics []models.MetricDTO) {
+	//Пока в очереди есть неотправленное - новый батч встает за ним, так сервер получит их по порядку
+	if m.queueLen() != 0 {
+		if len(metrics) != 0 {
+			m.enqueue(metrics)
+		}
+		m.startFlush()
+		return
+	}
+
+	//В ЗАДАНИИ СКАЗАНО отправлять пустые батчи не нужно; (12 инкремент)
+	if len(metrics) == 0 {
+		return
+	}
+
+	//Все воркеры заняты и буфер полон - откладываем батч на диск
+	if !m.submit(metrics) {
+		fmt.Printf("all %d senders are busy\n", m.rateLimit)
+		m.enqueue(metrics)
+	}
+}
+
+func (m *metricsConsumer) worker(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	for metrics := range m.jobs {
+		//Агент завершается - не отправляем, а сохраняем до рестарта
+		if ctx.Err() != nil {
+			m.enqueue(metrics)
+			continue
+		}
+
+		if err := m.sender.send(ctx, metrics); err != nil {
+			fmt.Printf("cannot send metrics batch: %s\n", err)
+			if !errors.Is(err, errRejected) {
+				m.enqueue(metrics)
+			}
+		}
+	}
+}
+
+func (m *metricsConsumer) Work(ctx context.Context, wg *sync.WaitGroup, metricCh <-chan models.MetricDTO) {
+
+	defer wg.Done()
+	defer m.sender.close()
+
+	var workers sync.WaitGroup
+	workers.Add(m.rateLimit)
+	for i := 0; i < m.rateLimit; i++ {
+		go m.worker(ctx, &workers)
+	}
+
+	var flusher sync.WaitGroup
+	flusher.Add(1)
+	go m.flusher(ctx, &flusher)
+
+	ticker := time.NewTicker(m.tickerTime)
+
+	for {
+		select {
+		// выход по ctx
+		case <-ctx.Done():
+			//Не отправленное сохраняем, отправим после рестарта
+			if metrics := m.storage.GetAllMetrics(); m.queue != nil && len(metrics) != 0 {
+				m.enqueue(metrics)
+			}
+			close(m.jobs)
+			close(m.flushCh)
+			workers.Wait()
+			flusher.Wait()
+			return
+		//Сохораняем приходящие метрики от поставщиков
+		case mertic := <-metricCh:
+			if err := m.storage.ApplyMetric(ctx, mertic); err != nil {
+				fmt.Printf("cannot apply metric %s: %s\n", mertic.ID, err)
+			}
+		// отправляем накопленые метрики на сервер
+		case <-ticker.C:
+			m.report(m.storage.GetAllMetrics())
+		}
+	}
+}
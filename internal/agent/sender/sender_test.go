@@ -0,0 +1,131 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AntonPashechko/yametrix/internal/agent/config"
+	"github.com/AntonPashechko/yametrix/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSender запоминает отправленные батчи, пока fail - отвечает ошибкой
+type fakeSender struct {
+	mux     sync.Mutex
+	sent    [][]models.MetricDTO
+	fail    bool
+	release chan struct{} //если задан - send ждет его закрытия
+}
+
+func (m *fakeSender) send(ctx context.Context, metrics []models.MetricDTO) error {
+	if m.release != nil {
+		<-m.release
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	if m.fail {
+		return errors.New("server is down")
+	}
+	m.sent = append(m.sent, metrics)
+	return nil
+}
+
+func (m *fakeSender) close() {}
+
+func (m *fakeSender) sentIDs() []string {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	var ids []string
+	for _, batch := range m.sent {
+		ids = append(ids, batch[0].ID)
+	}
+	return ids
+}
+
+func newTestConsumer(t *testing.T, rateLimit int64, sender *fakeSender) *metricsConsumer {
+	consumer, err := NewMetricsConsumer(&config.Config{
+		ServerEndpoint: "http://localhost:8080",
+		ReportInterval: 1,
+		RateLimit:      rateLimit,
+		QueuePath:      t.TempDir(),
+		QueueLimit:     10,
+	})
+	require.NoError(t, err)
+	consumer.sender = sender
+
+	return consumer
+}
+
+func batch(id string) []models.MetricDTO {
+	return []models.MetricDTO{models.NewCounterMetric(id, 1)}
+}
+
+func TestReportBackPressure(t *testing.T) {
+	sender := &fakeSender{release: make(chan struct{})}
+	consumer := newTestConsumer(t, 1, sender)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var workers sync.WaitGroup
+	workers.Add(1)
+	go consumer.worker(ctx, &workers)
+
+	//Воркер занят первым батчем, второй ждет в буфере, третий уходит на диск - report не блокируется
+	done := make(chan struct{})
+	go func() {
+		consumer.report(batch("first"))
+		for len(consumer.jobs) != 0 {
+			time.Sleep(time.Millisecond)
+		}
+		consumer.report(batch("second"))
+		consumer.report(batch("third"))
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("report blocked by slow sender")
+	}
+	assert.Equal(t, 1, consumer.queueLen())
+
+	close(sender.release)
+	close(consumer.jobs)
+	workers.Wait()
+
+	assert.Equal(t, []string{"first", "second"}, sender.sentIDs())
+}
+
+func TestQueueReplayOrder(t *testing.T) {
+	sender := &fakeSender{fail: true}
+	consumer := newTestConsumer(t, 2, sender)
+
+	ctx := context.Background()
+
+	//Сервер недоступен - батч оказывается в очереди
+	consumer.jobs <- batch("first")
+	close(consumer.jobs)
+	var workers sync.WaitGroup
+	workers.Add(1)
+	consumer.worker(ctx, &workers)
+	require.Equal(t, 1, consumer.queueLen())
+
+	//Пока очередь не пуста, новые батчи встают за ней
+	consumer.jobs = make(chan []models.MetricDTO, 2)
+	consumer.report(batch("second"))
+	assert.Equal(t, 2, consumer.queueLen())
+
+	sender.fail = false
+	consumer.flush(ctx)
+
+	assert.Equal(t, 0, consumer.queueLen())
+	assert.Equal(t, []string{"first", "second"}, sender.sentIDs())
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/AntonPashechko/yametrix/internal/agent/config"
 	"github.com/AntonPashechko/yametrix/internal/models"
+	"github.com/AntonPashechko/yametrix/pkg/utils"
 	"github.com/pbnjay/memory"
 	"github.com/shirou/gopsutil/cpu"
 )
@@ -15,47 +16,98 @@ import (
 const (
 	totalMemory    = "TotalMemory"
 	freeMemory     = "FreeMemory"
-	cpuUtilization = "CPUutilization1"
+	cpuUtilization = "CPUutilization"
+
+	cpuUser   = "CPUuser"
+	cpuSystem = "CPUsystem"
+	cpuIowait = "CPUiowait"
+	cpuSteal  = "CPUsteal"
 )
 
 type AnotherMetricsProducer struct {
 	tickerTime time.Duration
+	prevTimes  map[string]cpu.TimesStat //времена ядер с прошлого опроса, по имени ядра
+}
+
+func init() {
+	Register("another", func(cfg *config.Config, tickerTime time.Duration) Collector {
+		return NewAnotherMetricsProducer(cfg, tickerTime)
+	})
 }
 
-func NewAnotherMetricsProducer(cfg *config.Config) *AnotherMetricsProducer {
+func NewAnotherMetricsProducer(cfg *config.Config, tickerTime time.Duration) *AnotherMetricsProducer {
 	return &AnotherMetricsProducer{
-		tickerTime: time.Duration(cfg.PollInterval) * time.Second,
+		tickerTime: tickerTime,
+		prevTimes:  make(map[string]cpu.TimesStat),
 	}
 }
 
-func (m *AnotherMetricsProducer) produceMetrics(metricCh chan<- models.MetricDTO) {
-	//В 13 ИНКРЕМЕНТЕ В ТЕСТАХ ОТКУДА-ТО ВЫЛЕЗЛИ МЕТРИКИ ВНЕ ПАКЕТА RUNTIME TotalMemory FreeMemory CPUutilization1
-	//ДЛЯ ПЕРВЫХ 2х ПОДКЛЮЧИЛ github.com/pbnjay/memory
-	metricCh <- models.NewGaugeMetric(totalMemory, float64(memory.TotalMemory()))
-	metricCh <- models.NewGaugeMetric(freeMemory, float64(memory.FreeMemory()))
+// cpuMetrics считает загрузку ядер по приросту времен с прошлого опроса, а не мгновенному срезу.
+// Ядра нумеруются с 1: CPUutilization1 - первое ядро (cpu0)
+func cpuMetrics(prev map[string]cpu.TimesStat, times []cpu.TimesStat) []models.MetricDTO {
+	var metrics []models.MetricDTO
 
-	//ДЛЯ CPUutilization1 - github.com/shirou/gopsutil
-	percentage, err := cpu.Percent(0, true)
-	if err != nil {
-		fmt.Printf("cannot get cpu utilization: %s\n", err)
+	for i, cur := range times {
+		//Для нового ядра только запоминаем времена
+		old, ok := prev[cur.CPU]
+		if !ok {
+			continue
+		}
+
+		total := cur.Total() - old.Total()
+		if total <= 0 {
+			continue
+		}
+		percent := func(cur, old float64) float64 {
+			return (cur - old) / total * 100
+		}
+
+		num := utils.Int64ToStr(int64(i + 1))
+		busy := total - (cur.Idle - old.Idle) - (cur.Iowait - old.Iowait)
+		metrics = append(metrics, models.NewGaugeMetric(cpuUtilization+num, busy/total*100))
+
+		labels := map[string]string{"cpu": num}
+		for _, metric := range []models.MetricDTO{
+			models.NewGaugeMetric(cpuUser, percent(cur.User, old.User)),
+			models.NewGaugeMetric(cpuSystem, percent(cur.System, old.System)),
+			models.NewGaugeMetric(cpuIowait, percent(cur.Iowait, old.Iowait)),
+			models.NewGaugeMetric(cpuSteal, percent(cur.Steal, old.Steal)),
+		} {
+			metric.Labels = labels
+			metrics = append(metrics, metric)
+		}
 	}
 
-	metricCh <- models.NewGaugeMetric(cpuUtilization, percentage[0])
+	return metrics
 }
 
-func (m *AnotherMetricsProducer) Work(ctx context.Context, wg *sync.WaitGroup, metricCh chan<- models.MetricDTO) {
-	defer wg.Done()
+func (m *AnotherMetricsProducer) produceMetrics(ctx context.Context, metricCh chan<- models.MetricDTO) {
+	//В 13 ИНКРЕМЕНТЕ В ТЕСТАХ ОТКУДА-ТО ВЫЛЕЗЛИ МЕТРИКИ ВНЕ ПАКЕТА RUNTIME TotalMemory FreeMemory CPUutilization1
+	//ДЛЯ ПЕРВЫХ 2х ПОДКЛЮЧИЛ github.com/pbnjay/memory
+	if !send(ctx, metricCh, models.NewGaugeMetric(totalMemory, float64(memory.TotalMemory()))) ||
+		!send(ctx, metricCh, models.NewGaugeMetric(freeMemory, float64(memory.FreeMemory()))) {
+		return
+	}
 
-	ticker := time.NewTicker(m.tickerTime)
+	//ДЛЯ CPUutilizationN - github.com/shirou/gopsutil, по всем ядрам
+	times, err := cpu.Times(true)
+	if err != nil {
+		fmt.Printf("cannot get cpu times: %s\n", err)
+		return
+	}
 
-	for {
-		select {
-		// выход по ctx
-		case <-ctx.Done():
+	for _, metric := range cpuMetrics(m.prevTimes, times) {
+		if !send(ctx, metricCh, metric) {
 			return
-		// собираем метрики, пишем их в канал
-		case <-ticker.C:
-			m.produceMetrics(metricCh)
 		}
 	}
+
+	m.prevTimes = make(map[string]cpu.TimesStat, len(times))
+	for _, t := range times {
+		m.prevTimes[t.CPU] = t
+	}
+}
+
+func (m *AnotherMetricsProducer) Work(ctx context.Context, wg *sync.WaitGroup, metricCh chan<- models.MetricDTO) {
+	pollLoop(ctx, wg, m.tickerTime, func() { m.produceMetrics(ctx, metricCh) })
 }
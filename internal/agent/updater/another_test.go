@@ -0,0 +1,37 @@
+package updater
+
+import (
+	"testing"
+
+	"github.com/AntonPashechko/yametrix/internal/models"
+	"github.com/shirou/gopsutil/cpu"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCPUMetrics(t *testing.T) {
+	prev := map[string]cpu.TimesStat{
+		"cpu0": {CPU: "cpu0", User: 10, System: 10, Idle: 70, Iowait: 10},
+	}
+	times := []cpu.TimesStat{
+		//За интервал прошло 100 тиков: 30 user, 10 system, 40 idle, 10 iowait, 10 steal
+		{CPU: "cpu0", User: 40, System: 20, Idle: 110, Iowait: 20, Steal: 10},
+		//Нового ядра не было в прошлом опросе
+		{CPU: "cpu1", User: 5, Idle: 5},
+	}
+
+	got := make(map[string]models.MetricDTO)
+	for _, metric := range cpuMetrics(prev, times) {
+		got[metric.SeriesKey()] = metric
+	}
+
+	assert.Len(t, got, 5)
+	assert.InDelta(t, 50.0, *got["CPUutilization1"].Value, 1e-9)
+	assert.InDelta(t, 30.0, *got[`CPUuser{cpu="1"}`].Value, 1e-9)
+	assert.InDelta(t, 10.0, *got[`CPUsystem{cpu="1"}`].Value, 1e-9)
+	assert.InDelta(t, 10.0, *got[`CPUiowait{cpu="1"}`].Value, 1e-9)
+	assert.InDelta(t, 10.0, *got[`CPUsteal{cpu="1"}`].Value, 1e-9)
+
+	//Пустой срез и первый опрос - без паники и метрик
+	assert.Empty(t, cpuMetrics(prev, nil))
+	assert.Empty(t, cpuMetrics(map[string]cpu.TimesStat{}, times))
+}
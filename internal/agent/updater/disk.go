@@ -0,0 +1,66 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/AntonPashechko/yametrix/internal/agent/config"
+	"github.com/AntonPashechko/yametrix/internal/models"
+)
+
+const (
+	diskTotal = "DiskTotal"
+	diskFree  = "DiskFree"
+	diskUsed  = "DiskUsed"
+)
+
+// DiskMetricsProducer - занятость дисков по точкам монтирования из /proc/mounts
+type DiskMetricsProducer struct {
+	tickerTime time.Duration
+}
+
+func init() {
+	RegisterLinux("disk", func(cfg *config.Config, tickerTime time.Duration) Collector {
+		return NewDiskMetricsProducer(cfg, tickerTime)
+	})
+}
+
+func NewDiskMetricsProducer(cfg *config.Config, tickerTime time.Duration) *DiskMetricsProducer {
+	return &DiskMetricsProducer{
+		tickerTime: tickerTime,
+	}
+}
+
+func (m *DiskMetricsProducer) produceMetrics(ctx context.Context, metricCh chan<- models.MetricDTO) {
+	mounts, err := readProcFile(parseMounts, "mounts")
+	if err != nil {
+		fmt.Printf("cannot get mounts: %s\n", err)
+		return
+	}
+
+	for _, mount := range mounts {
+		total, free, err := diskUsage(mount.path)
+		//Пустые и недоступные файловые системы пропускаем
+		if err != nil || total == 0 {
+			continue
+		}
+
+		labels := map[string]string{"mount": mount.path, "device": mount.device}
+		for _, metric := range []models.MetricDTO{
+			models.NewGaugeMetric(diskTotal, float64(total)),
+			models.NewGaugeMetric(diskFree, float64(free)),
+			models.NewGaugeMetric(diskUsed, float64(total-free)),
+		} {
+			metric.Labels = labels
+			if !send(ctx, metricCh, metric) {
+				return
+			}
+		}
+	}
+}
+
+func (m *DiskMetricsProducer) Work(ctx context.Context, wg *sync.WaitGroup, metricCh chan<- models.MetricDTO) {
+	pollLoop(ctx, wg, m.tickerTime, func() { m.produceMetrics(ctx, metricCh) })
+}
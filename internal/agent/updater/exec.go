@@ -0,0 +1,227 @@
+package updater
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AntonPashechko/yametrix/internal/agent/config"
+	"github.com/AntonPashechko/yametrix/internal/models"
+	"github.com/AntonPashechko/yametrix/pkg/utils"
+)
+
+func init() {
+	Register("exec", func(cfg *config.Config, tickerTime time.Duration) Collector {
+		return NewExecMetricsProducer(cfg, tickerTime)
+	})
+}
+
+// ExecMetricsProducer запускает внешние команды и разбирает их вывод как метрики
+type ExecMetricsProducer struct {
+	tickerTime time.Duration
+	commands   []string
+	timeout    time.Duration
+}
+
+func NewExecMetricsProducer(cfg *config.Config, tickerTime time.Duration) *ExecMetricsProducer {
+	return &ExecMetricsProducer{
+		tickerTime: tickerTime,
+		commands:   cfg.ExecCommands,
+		timeout:    cfg.ExecTimeout,
+	}
+}
+
+// parseMetricLine разбирает строку вида name{label="value"} 1.5 [gauge|counter]
+func parseMetricLine(line string) (models.MetricDTO, error) {
+	var metric models.MetricDTO
+
+	//Метки могут содержать пробелы, поэтому отрезаем их до разбиения на поля
+	name, rest := line, ""
+	if open := strings.IndexByte(line, '{'); open >= 0 && open < strings.IndexAny(line+" ", " \t") {
+		end := strings.LastIndexByte(line, '}')
+		if end < open {
+			return metric, fmt.Errorf("unclosed labels")
+		}
+
+		labels, err := models.ParseLabels(line[open : end+1])
+		if err != nil {
+			return metric, fmt.Errorf("bad labels: %w", err)
+		}
+		metric.Labels = labels
+		name, rest = line[:open], line[end+1:]
+	} else if idx := strings.IndexAny(line, " \t"); idx >= 0 {
+		name, rest = line[:idx], line[idx:]
+	}
+
+	fields := strings.Fields(rest)
+	if name == "" || len(fields) == 0 || len(fields) > 2 {
+		return metric, fmt.Errorf("expected name value [type]")
+	}
+	metric.ID = name
+
+	metric.MType = models.GaugeType
+	if len(fields) == 2 {
+		metric.MType = fields[1]
+	}
+
+	switch metric.MType {
+	case models.GaugeType:
+		value, err := utils.StrToFloat64(fields[0])
+		if err != nil {
+			return metric, fmt.Errorf("bad gauge value %s", fields[0])
+		}
+		metric.SetValue(value)
+	case models.CounterType:
+		delta, err := utils.StrToInt64(fields[0])
+		if err != nil {
+			return metric, fmt.Errorf("bad counter value %s", fields[0])
+		}
+		metric.SetDelta(delta)
+	default:
+		return metric, fmt.Errorf("unsupported metric type %s", metric.MType)
+	}
+
+	return metric, nil
+}
+
+// validateExecMetric проверяет метрику из JSON вывода так же, как строки: команды шлют только gauge и counter
+func validateExecMetric(metric models.MetricDTO) error {
+	if metric.ID == "" {
+		return fmt.Errorf("metric id is empty")
+	}
+	if err := models.ValidateID(metric.ID); err != nil {
+		return err
+	}
+	if err := models.ValidateLabels(metric.Labels); err != nil {
+		return fmt.Errorf("bad labels: %w", err)
+	}
+
+	switch metric.MType {
+	case models.GaugeType:
+		if metric.Value == nil {
+			return fmt.Errorf("gauge %s has no value", metric.ID)
+		}
+	case models.CounterType:
+		if metric.Delta == nil {
+			return fmt.Errorf("counter %s has no delta", metric.ID)
+		}
+	default:
+		return fmt.Errorf("unsupported metric type %s", metric.MType)
+	}
+
+	return nil
+}
+
+// parseExecOutput разбирает вывод команды: JSON массив MetricDTO или строки name value [type]
+func parseExecOutput(output []byte) ([]models.MetricDTO, error) {
+	output = bytes.TrimSpace(output)
+
+	if bytes.HasPrefix(output, []byte("[")) {
+		metrics, err := models.NewMetricsFromJSON(bytes.NewReader(output))
+		if err != nil {
+			return nil, err
+		}
+
+		for i, metric := range metrics {
+			if err := validateExecMetric(metric); err != nil {
+				return nil, fmt.Errorf("metric %d: %w", i+1, err)
+			}
+		}
+
+		return metrics, nil
+	}
+
+	var metrics []models.MetricDTO
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for num := 1; scanner.Scan(); num++ {
+		line := strings.TrimSpace(scanner.Text())
+		//Пустые строки и комментарии пропускаем
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		metric, err := parseMetricLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", num, err)
+		}
+		metrics = append(metrics, metric)
+	}
+
+	return metrics, scanner.Err()
+}
+
+// runCommand запускает команду с таймаутом и разбирает ее вывод
+func (m *ExecMetricsProducer) runCommand(ctx context.Context, command string) ([]models.MetricDTO, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	//Своя группа процессов, что бы по таймауту убить и порожденные скриптом процессы
+	setProcessGroup(cmd)
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("cannot start: %w", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+	case <-ctx.Done():
+		killProcessGroup(cmd)
+		<-done
+		return nil, fmt.Errorf("timeout %s exceeded", m.timeout)
+	}
+
+	metrics, err := parseExecOutput(stdout.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse output: %w", err)
+	}
+
+	return metrics, nil
+}
+
+func (m *ExecMetricsProducer) produceMetrics(ctx context.Context, metricCh chan<- models.MetricDTO) {
+	//Команды запускаем параллельно, что бы одна долгая не задерживала остальные
+	var wg sync.WaitGroup
+	wg.Add(len(m.commands))
+
+	for _, command := range m.commands {
+		go func(command string) {
+			defer wg.Done()
+
+			metrics, err := m.runCommand(ctx, command)
+			if err != nil {
+				fmt.Printf("cannot exec %q: %s\n", command, err)
+				return
+			}
+
+			for _, metric := range metrics {
+				if !send(ctx, metricCh, metric) {
+					return
+				}
+			}
+		}(command)
+	}
+
+	wg.Wait()
+}
+
+func (m *ExecMetricsProducer) Work(ctx context.Context, wg *sync.WaitGroup, metricCh chan<- models.MetricDTO) {
+	pollLoop(ctx, wg, m.tickerTime, func() { m.produceMetrics(ctx, metricCh) })
+}
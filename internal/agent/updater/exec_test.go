@@ -0,0 +1,115 @@
+package updater
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/AntonPashechko/yametrix/internal/agent/config"
+	"github.com/AntonPashechko/yametrix/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExecOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    []models.MetricDTO
+		wantErr bool
+	}{
+		{
+			name:   "plain_lines",
+			output: "# queue stats\nQueueSize 12.5\n\nProcessed 3 counter\n",
+			want: []models.MetricDTO{
+				models.NewGaugeMetric("QueueSize", 12.5),
+				models.NewCounterMetric("Processed", 3),
+			},
+		},
+		{
+			name:   "labels",
+			output: `QueueSize{queue="main jobs"} 7 gauge`,
+			want: []models.MetricDTO{
+				func() models.MetricDTO {
+					metric := models.NewGaugeMetric("QueueSize", 7)
+					metric.Labels = map[string]string{"queue": "main jobs"}
+					return metric
+				}(),
+			},
+		},
+		{
+			name:   "json",
+			output: `[{"id":"Alloc","type":"gauge","value":1.5}]`,
+			want:   []models.MetricDTO{models.NewGaugeMetric("Alloc", 1.5)},
+		},
+		{
+			name:    "json_histogram",
+			output:  `[{"id":"x","type":"histogram"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "json_counter_without_delta",
+			output:  `[{"id":"Alloc","type":"gauge","value":1.5},{"id":"Processed","type":"counter"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "json_gauge_without_value",
+			output:  `[{"id":"Alloc","type":"gauge"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "json_bad_labels",
+			output:  `[{"id":"Alloc","type":"gauge","value":1,"labels":{"1host":"a"}}]`,
+			wantErr: true,
+		},
+		{
+			name:    "json_empty_id",
+			output:  `[{"type":"gauge","value":1}]`,
+			wantErr: true,
+		},
+		{
+			name:    "bad_counter",
+			output:  "Processed 1.5 counter",
+			wantErr: true,
+		},
+		{
+			name:    "no_value",
+			output:  "QueueSize",
+			wantErr: true,
+		},
+		{
+			name:    "unknown_type",
+			output:  "QueueSize 1 histogram",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics, err := parseExecOutput([]byte(tt.output))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, metrics)
+		})
+	}
+}
+
+func TestExecMetricsProducer(t *testing.T) {
+	cfg := &config.Config{
+		ExecCommands: []string{"echo Temperature 36.6", "sleep 5", "exit 1"},
+		ExecTimeout:  100 * time.Millisecond,
+	}
+	producer := NewExecMetricsProducer(cfg, time.Second)
+
+	metricCh := make(chan models.MetricDTO, 10)
+	producer.produceMetrics(context.Background(), metricCh)
+	close(metricCh)
+
+	var metrics []models.MetricDTO
+	for metric := range metricCh {
+		metrics = append(metrics, metric)
+	}
+	assert.Equal(t, []models.MetricDTO{models.NewGaugeMetric("Temperature", 36.6)}, metrics)
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package updater
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func killProcessGroup(cmd *exec.Cmd) {
+	//Отрицательный pid - вся группа
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
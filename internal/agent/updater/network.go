@@ -0,0 +1,85 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/AntonPashechko/yametrix/internal/agent/config"
+	"github.com/AntonPashechko/yametrix/internal/models"
+)
+
+const (
+	netRxBytes   = "NetRxBytes"
+	netRxPackets = "NetRxPackets"
+	netRxErrors  = "NetRxErrors"
+	netTxBytes   = "NetTxBytes"
+	netTxPackets = "NetTxPackets"
+	netTxErrors  = "NetTxErrors"
+)
+
+// NetworkMetricsProducer - трафик по сетевым интерфейсам из /proc/net/dev.
+// В /proc накопленные значения, а counter на сервере суммирует - поэтому шлем прирост с прошлого опроса
+type NetworkMetricsProducer struct {
+	tickerTime time.Duration
+	prev       map[string]netStats
+}
+
+func init() {
+	RegisterLinux("network", func(cfg *config.Config, tickerTime time.Duration) Collector {
+		return NewNetworkMetricsProducer(cfg, tickerTime)
+	})
+}
+
+func NewNetworkMetricsProducer(cfg *config.Config, tickerTime time.Duration) *NetworkMetricsProducer {
+	return &NetworkMetricsProducer{
+		tickerTime: tickerTime,
+	}
+}
+
+// delta - прирост счетчика, при сбросе (переполнение, пересоздание интерфейса) считаем с нуля
+func delta(cur uint64, prev uint64) int64 {
+	if cur < prev {
+		return int64(cur)
+	}
+
+	return int64(cur - prev)
+}
+
+func (m *NetworkMetricsProducer) produceMetrics(ctx context.Context, metricCh chan<- models.MetricDTO) {
+	stats, err := readProcFile(parseNetDev, "net", "dev")
+	if err != nil {
+		fmt.Printf("cannot get network stats: %s\n", err)
+		return
+	}
+
+	for iface, cur := range stats {
+		//Для нового интерфейса только запоминаем значения
+		prev, ok := m.prev[iface]
+		if !ok {
+			continue
+		}
+
+		labels := map[string]string{"interface": iface}
+		for _, metric := range []models.MetricDTO{
+			models.NewCounterMetric(netRxBytes, delta(cur.rxBytes, prev.rxBytes)),
+			models.NewCounterMetric(netRxPackets, delta(cur.rxPackets, prev.rxPackets)),
+			models.NewCounterMetric(netRxErrors, delta(cur.rxErrors, prev.rxErrors)),
+			models.NewCounterMetric(netTxBytes, delta(cur.txBytes, prev.txBytes)),
+			models.NewCounterMetric(netTxPackets, delta(cur.txPackets, prev.txPackets)),
+			models.NewCounterMetric(netTxErrors, delta(cur.txErrors, prev.txErrors)),
+		} {
+			metric.Labels = labels
+			if !send(ctx, metricCh, metric) {
+				return
+			}
+		}
+	}
+
+	m.prev = stats
+}
+
+func (m *NetworkMetricsProducer) Work(ctx context.Context, wg *sync.WaitGroup, metricCh chan<- models.MetricDTO) {
+	pollLoop(ctx, wg, m.tickerTime, func() { m.produceMetrics(ctx, metricCh) })
+}
@@ -0,0 +1,39 @@
+package updater
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/AntonPashechko/yametrix/internal/models"
+)
+
+// send пишет метрику в канал, false - ctx отменен и опрос пора прервать.
+// Потребитель при отмене ctx выходит, без select коллектор повис бы на записи навсегда
+func send(ctx context.Context, metricCh chan<- models.MetricDTO, metric models.MetricDTO) bool {
+	select {
+	case metricCh <- metric:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// pollLoop вызывает produce раз в tickerTime до отмены ctx
+func pollLoop(ctx context.Context, wg *sync.WaitGroup, tickerTime time.Duration, produce func()) {
+	defer wg.Done()
+
+	ticker := time.NewTicker(tickerTime)
+	defer ticker.Stop()
+
+	for {
+		select {
+		// выход по ctx
+		case <-ctx.Done():
+			return
+		// собираем метрики, пишем их в канал
+		case <-ticker.C:
+			produce()
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/AntonPashechko/yametrix/internal/agent/config"
+	"github.com/AntonPashechko/yametrix/internal/models"
+)
+
+const (
+	processCPU     = "ProcessCPU"
+	processRSS     = "ProcessRSS"
+	processOpenFDs = "ProcessOpenFDs"
+)
+
+// ProcessMetricsProducer - CPU, RSS и дескрипторы процессов по /proc/[pid].
+// Смотрим процессы с заданными именами, если имен нет - только сам агент
+type ProcessMetricsProducer struct {
+	tickerTime time.Duration
+	names      map[string]bool
+	prevTicks  map[string]uint64 //utime+stime по pid с прошлого опроса
+	prevTotal  uint64            //общие jiffies CPU с прошлого опроса
+}
+
+func init() {
+	RegisterLinux("process", func(cfg *config.Config, tickerTime time.Duration) Collector {
+		return NewProcessMetricsProducer(cfg, tickerTime)
+	})
+}
+
+func NewProcessMetricsProducer(cfg *config.Config, tickerTime time.Duration) *ProcessMetricsProducer {
+	names := make(map[string]bool, len(cfg.ProcessNames))
+	for _, name := range cfg.ProcessNames {
+		names[name] = true
+	}
+
+	return &ProcessMetricsProducer{
+		tickerTime: tickerTime,
+		names:      names,
+		prevTicks:  make(map[string]uint64),
+	}
+}
+
+// pids - идентификаторы процессов, за которыми следим
+func (m *ProcessMetricsProducer) pids() ([]string, error) {
+	if len(m.names) == 0 {
+		return []string{strconv.Itoa(os.Getpid())}, nil
+	}
+
+	entries, err := os.ReadDir(procRoot)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %s: %w", procRoot, err)
+	}
+
+	var pids []string
+	for _, entry := range entries {
+		if _, err := strconv.Atoi(entry.Name()); err == nil && entry.IsDir() {
+			pids = append(pids, entry.Name())
+		}
+	}
+
+	return pids, nil
+}
+
+// processUsage - суммарное потребление процессов с одним именем
+type processUsage struct {
+	rss    uint64
+	fds    int
+	hasFDs bool //дескрипторы чужих процессов без прав не прочитать
+	cpu    float64
+	hasCPU bool //загрузку считаем со второго опроса процесса
+}
+
+func (m *ProcessMetricsProducer) produceMetrics(ctx context.Context, metricCh chan<- models.MetricDTO) {
+	total, err := readProcFile(parseCPUTotal, "stat")
+	if err != nil {
+		fmt.Printf("cannot get cpu stat: %s\n", err)
+		return
+	}
+
+	pids, err := m.pids()
+	if err != nil {
+		fmt.Printf("cannot get processes: %s\n", err)
+		return
+	}
+
+	ticks := make(map[string]uint64)
+
+	//Ряды по имени процесса, а не по pid: иначе каждый перезапуск оставлял бы на сервере
+	//новые ряды навсегда. Процессы с одним именем (например, воркеры) суммируются
+	usage := make(map[string]*processUsage)
+
+	for _, pid := range pids {
+		//Процесс мог уже завершиться - просто пропускаем
+		stat, err := readProcFile(parseProcStat, pid, "stat")
+		if err != nil || (len(m.names) != 0 && !m.names[stat.comm]) {
+			continue
+		}
+		ticks[pid] = stat.ticks
+
+		u, ok := usage[stat.comm]
+		if !ok {
+			u = new(processUsage)
+			usage[stat.comm] = u
+		}
+		u.rss += stat.rss * uint64(os.Getpagesize())
+
+		//Загрузка как в top: 100% - одно ядро целиком
+		if prev, ok := m.prevTicks[pid]; ok && total > m.prevTotal && stat.ticks >= prev {
+			u.cpu += float64(stat.ticks-prev) / float64(total-m.prevTotal) * 100 * float64(runtime.NumCPU())
+			u.hasCPU = true
+		}
+
+		if fds, err := countFDs(pid); err == nil {
+			u.fds += fds
+			u.hasFDs = true
+		}
+	}
+
+	for name, u := range usage {
+		metrics := []models.MetricDTO{
+			models.NewGaugeMetric(processRSS, float64(u.rss)),
+		}
+		if u.hasFDs {
+			metrics = append(metrics, models.NewGaugeMetric(processOpenFDs, float64(u.fds)))
+		}
+		if u.hasCPU {
+			metrics = append(metrics, models.NewGaugeMetric(processCPU, u.cpu))
+		}
+
+		labels := map[string]string{"process": name}
+		for _, metric := range metrics {
+			metric.Labels = labels
+			if !send(ctx, metricCh, metric) {
+				return
+			}
+		}
+	}
+
+	m.prevTicks = ticks
+	m.prevTotal = total
+}
+
+func (m *ProcessMetricsProducer) Work(ctx context.Context, wg *sync.WaitGroup, metricCh chan<- models.MetricDTO) {
+	pollLoop(ctx, wg, m.tickerTime, func() { m.produceMetrics(ctx, metricCh) })
+}
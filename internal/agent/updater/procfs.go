@@ -0,0 +1,244 @@
+package updater
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// procRoot - корень procfs, в тестах подменяется
+var procRoot = "/proc"
+
+func procPath(elem ...string) string {
+	return filepath.Join(append([]string{procRoot}, elem...)...)
+}
+
+// readProcFile открывает файл procfs и разбирает его переданной функцией
+func readProcFile[T any](parse func(io.Reader) (T, error), elem ...string) (T, error) {
+	var res T
+
+	file, err := os.Open(procPath(elem...))
+	if err != nil {
+		return res, fmt.Errorf("cannot open %s: %w", procPath(elem...), err)
+	}
+	defer file.Close()
+
+	return parse(file)
+}
+
+// Псевдо файловые системы, по которым нет смысла слать занятость
+var pseudoFS = map[string]bool{
+	"proc": true, "sysfs": true, "devtmpfs": true, "devpts": true, "tmpfs": true,
+	"cgroup": true, "cgroup2": true, "mqueue": true, "debugfs": true, "tracefs": true,
+	"securityfs": true, "pstore": true, "bpf": true, "autofs": true, "hugetlbfs": true,
+	"configfs": true, "fusectl": true, "binfmt_misc": true, "nsfs": true, "rpc_pipefs": true,
+}
+
+type mountInfo struct {
+	device string
+	path   string
+	fsType string
+}
+
+// unescapeMount - пробелы и прочие спецсимволы в /proc/mounts записаны как \040
+func unescapeMount(value string) string {
+	if !strings.Contains(value, `\`) {
+		return value
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+3 < len(value) {
+			if code, err := strconv.ParseUint(value[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(code))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(value[i])
+	}
+
+	return b.String()
+}
+
+// parseMounts разбирает /proc/mounts, оставляя реальные файловые системы без повторов точек монтирования
+func parseMounts(r io.Reader) ([]mountInfo, error) {
+	var mounts []mountInfo
+	seen := make(map[string]bool)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+
+		mount := mountInfo{
+			device: unescapeMount(fields[0]),
+			path:   unescapeMount(fields[1]),
+			fsType: fields[2],
+		}
+
+		if pseudoFS[mount.fsType] || seen[mount.path] {
+			continue
+		}
+		seen[mount.path] = true
+
+		mounts = append(mounts, mount)
+	}
+
+	return mounts, scanner.Err()
+}
+
+type netStats struct {
+	rxBytes   uint64
+	rxPackets uint64
+	rxErrors  uint64
+	txBytes   uint64
+	txPackets uint64
+	txErrors  uint64
+}
+
+// parseNetDev разбирает /proc/net/dev, счетчики по интерфейсам
+func parseNetDev(r io.Reader) (map[string]netStats, error) {
+	stats := make(map[string]netStats)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		name, values, found := strings.Cut(scanner.Text(), ":")
+		//Первые две строки - заголовок
+		if !found {
+			continue
+		}
+
+		fields := strings.Fields(values)
+		if len(fields) < 16 {
+			return nil, fmt.Errorf("bad net dev line: %s", scanner.Text())
+		}
+
+		var nums [16]uint64
+		for i := range nums {
+			num, err := strconv.ParseUint(fields[i], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad net dev value %s: %w", fields[i], err)
+			}
+			nums[i] = num
+		}
+
+		stats[strings.TrimSpace(name)] = netStats{
+			rxBytes:   nums[0],
+			rxPackets: nums[1],
+			rxErrors:  nums[2],
+			txBytes:   nums[8],
+			txPackets: nums[9],
+			txErrors:  nums[10],
+		}
+	}
+
+	return stats, scanner.Err()
+}
+
+// parseFloatFields разбирает первые n чисел строки, например /proc/loadavg
+func parseFloatFields(r io.Reader, n int) ([]float64, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) < n {
+		return nil, fmt.Errorf("expected %d fields, got %d", n, len(fields))
+	}
+
+	values := make([]float64, n)
+	for i := range values {
+		if values[i], err = strconv.ParseFloat(fields[i], 64); err != nil {
+			return nil, fmt.Errorf("bad value %s: %w", fields[i], err)
+		}
+	}
+
+	return values, nil
+}
+
+func parseLoadAvg(r io.Reader) ([]float64, error) {
+	return parseFloatFields(r, 3)
+}
+
+// parseFileNr - /proc/sys/fs/file-nr: выделено дескрипторов, свободно, максимум
+func parseFileNr(r io.Reader) ([]float64, error) {
+	return parseFloatFields(r, 3)
+}
+
+// parseCPUTotal - сумма всех jiffies из строки cpu файла /proc/stat
+func parseCPUTotal(r io.Reader) (uint64, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) < 2 || fields[0] != "cpu" {
+		return 0, fmt.Errorf("bad cpu line: %s", line)
+	}
+
+	var total uint64
+	for _, field := range fields[1:] {
+		value, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("bad cpu value %s: %w", field, err)
+		}
+		total += value
+	}
+
+	return total, nil
+}
+
+type procStat struct {
+	comm  string
+	ticks uint64 //utime + stime
+	rss   uint64 //в страницах
+}
+
+// parseProcStat разбирает /proc/[pid]/stat
+func parseProcStat(r io.Reader) (procStat, error) {
+	var stat procStat
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return stat, err
+	}
+
+	//Имя процесса в скобках и может содержать пробелы, поэтому ищем последнюю скобку
+	line := string(data)
+	start, end := strings.IndexByte(line, '('), strings.LastIndexByte(line, ')')
+	if start < 0 || end < start {
+		return stat, fmt.Errorf("bad proc stat: %s", line)
+	}
+	stat.comm = line[start+1 : end]
+
+	//Поля после имени, начиная с 3-го (state)
+	fields := strings.Fields(line[end+1:])
+	if len(fields) < 22 {
+		return stat, fmt.Errorf("bad proc stat: %s", line)
+	}
+
+	utime, err := strconv.ParseUint(fields[11], 10, 64)
+	if err != nil {
+		return stat, fmt.Errorf("bad utime: %w", err)
+	}
+	stime, err := strconv.ParseUint(fields[12], 10, 64)
+	if err != nil {
+		return stat, fmt.Errorf("bad stime: %w", err)
+	}
+	stat.ticks = utime + stime
+
+	if stat.rss, err = strconv.ParseUint(fields[21], 10, 64); err != nil {
+		return stat, fmt.Errorf("bad rss: %w", err)
+	}
+
+	return stat, nil
+}
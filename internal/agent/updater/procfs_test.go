@@ -0,0 +1,204 @@
+package updater
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AntonPashechko/yametrix/internal/agent/config"
+	"github.com/AntonPashechko/yametrix/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMounts(t *testing.T) {
+	data := `proc /proc proc rw,relatime 0 0
+/dev/vda1 / ext4 rw,relatime 0 0
+tmpfs /dev/shm tmpfs rw,relatime 0 0
+/dev/vdb1 /mnt/my\040disk xfs rw 0 0
+/dev/vda1 / ext4 rw,relatime 0 0
+`
+	mounts, err := parseMounts(strings.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, []mountInfo{
+		{device: "/dev/vda1", path: "/", fsType: "ext4"},
+		{device: "/dev/vdb1", path: "/mnt/my disk", fsType: "xfs"},
+	}, mounts)
+}
+
+func TestParseNetDev(t *testing.T) {
+	data := `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo: 100    2    0    0    0     0          0         0 100    2    0    0    0     0       0          0
+  eth0: 5000   40   1    0    0     0          0         0 3000   30   2    0    0     0       0          0
+`
+	stats, err := parseNetDev(strings.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, netStats{rxBytes: 5000, rxPackets: 40, rxErrors: 1, txBytes: 3000, txPackets: 30, txErrors: 2}, stats["eth0"])
+	assert.Len(t, stats, 2)
+
+	_, err = parseNetDev(strings.NewReader("eth0: 1 2 3\n"))
+	assert.Error(t, err)
+}
+
+func TestParseProcStat(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    procStat
+		wantErr bool
+	}{
+		{
+			name: "simple",
+			data: "42 (agent) S 1 42 42 0 -1 4194560 100 0 0 0 150 50 0 0 20 0 8 0 1000 10000 300 18446744073709551615",
+			want: procStat{comm: "agent", ticks: 200, rss: 300},
+		},
+		{
+			name: "comm_with_spaces",
+			data: "7 (my (cool) app) R 1 7 7 0 -1 0 0 0 0 0 1 2 0 0 20 0 1 0 1 1 5 0",
+			want: procStat{comm: "my (cool) app", ticks: 3, rss: 5},
+		},
+		{
+			name:    "short",
+			data:    "7 (app) R 1",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stat, err := parseProcStat(strings.NewReader(tt.data))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, stat)
+		})
+	}
+}
+
+func TestParseSystemFiles(t *testing.T) {
+	load, err := parseLoadAvg(strings.NewReader("0.59 0.49 0.33 2/72 13577\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []float64{0.59, 0.49, 0.33}, load)
+
+	total, err := parseCPUTotal(strings.NewReader("cpu  10 0 20 70 0 0 0 0 0 0\ncpu0 10 0 20 70 0 0 0 0 0 0\n"))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(100), total)
+
+	_, err = parseCPUTotal(strings.NewReader("intr 1 2 3\n"))
+	assert.Error(t, err)
+}
+
+func TestNetworkMetricsProducer(t *testing.T) {
+	root := t.TempDir()
+	old := procRoot
+	procRoot = root
+	defer func() { procRoot = old }()
+
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "net"), 0755))
+	writeNetDev := func(rx string) {
+		data := "h\nh\n  eth0: " + rx + " 1 0 0 0 0 0 0 10 1 0 0 0 0 0 0\n"
+		require.NoError(t, os.WriteFile(filepath.Join(root, "net", "dev"), []byte(data), 0644))
+	}
+
+	producer := NewNetworkMetricsProducer(&config.Config{}, time.Second)
+	metricCh := make(chan models.MetricDTO, 100)
+
+	//Первый опрос только запоминает значения
+	writeNetDev("100")
+	producer.produceMetrics(context.Background(), metricCh)
+	assert.Len(t, metricCh, 0)
+
+	writeNetDev("150")
+	producer.produceMetrics(context.Background(), metricCh)
+	close(metricCh)
+
+	got := make(map[string]int64)
+	for metric := range metricCh {
+		assert.Equal(t, map[string]string{"interface": "eth0"}, metric.Labels)
+		got[metric.ID] = *metric.Delta
+	}
+	assert.Equal(t, int64(50), got[netRxBytes])
+	assert.Equal(t, int64(0), got[netTxBytes])
+}
+
+func TestProcessMetricsProducer(t *testing.T) {
+	root := t.TempDir()
+	old := procRoot
+	procRoot = root
+	defer func() { procRoot = old }()
+
+	require.NoError(t, os.WriteFile(filepath.Join(root, "stat"), []byte("cpu  10 0 20 70 0 0 0 0 0 0\n"), 0644))
+	writeStat := func(pid string, comm string, rss string) {
+		require.NoError(t, os.MkdirAll(filepath.Join(root, pid, "fd"), 0755))
+		data := pid + " (" + comm + ") S 1 1 1 0 -1 0 0 0 0 0 1 1 0 0 20 0 1 0 1 1 " + rss + " 0"
+		require.NoError(t, os.WriteFile(filepath.Join(root, pid, "stat"), []byte(data), 0644))
+	}
+	writeStat("10", "worker", "1")
+	writeStat("11", "worker", "2")
+	writeStat("12", "other", "4")
+
+	producer := NewProcessMetricsProducer(&config.Config{ProcessNames: []string{"worker"}}, time.Second)
+	metricCh := make(chan models.MetricDTO, 100)
+	producer.produceMetrics(context.Background(), metricCh)
+	close(metricCh)
+
+	//Процессы с одним именем дают один ряд без pid
+	got := make(map[string]float64)
+	for metric := range metricCh {
+		assert.Equal(t, map[string]string{"process": "worker"}, metric.Labels)
+		got[metric.ID] = *metric.Value
+	}
+	assert.Equal(t, map[string]float64{
+		processRSS:     float64(3 * os.Getpagesize()),
+		processOpenFDs: 0,
+	}, got)
+}
+
+func TestPollLoop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	called := make(chan struct{}, 1)
+	go pollLoop(ctx, &wg, 1, func() {
+		select {
+		case called <- struct{}{}:
+		default:
+		}
+	})
+
+	<-called
+	cancel()
+	wg.Wait()
+}
+
+func TestCollectorStopsWithoutConsumer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	//Канал никто не читает, как после выхода потребителя по ctx
+	metricCh := make(chan models.MetricDTO)
+	go NewRuntimeMetricsProducer(&config.Config{}, time.Millisecond).Work(ctx, &wg, metricCh)
+
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("collector is blocked on send after ctx cancel")
+	}
+}
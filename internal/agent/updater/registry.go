@@ -0,0 +1,96 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/AntonPashechko/yametrix/internal/agent/config"
+	"github.com/AntonPashechko/yametrix/internal/models"
+)
+
+// Collector - поставщик метрик агента, пишет их в канал до отмены ctx
+type Collector interface {
+	Work(ctx context.Context, wg *sync.WaitGroup, metricCh chan<- models.MetricDTO)
+}
+
+// Factory создает коллектор с заданным интервалом опроса
+type Factory func(cfg *config.Config, tickerTime time.Duration) Collector
+
+var (
+	registry  = make(map[string]Factory)
+	linuxOnly = make(map[string]bool) //коллекторы, читающие /proc
+)
+
+// Register добавляет коллектор в реестр, вызывается из init файла коллектора
+func Register(name string, factory Factory) {
+	if _, exist := registry[name]; exist {
+		panic(fmt.Sprintf("collector %s already registered", name))
+	}
+
+	registry[name] = factory
+}
+
+// RegisterLinux добавляет коллектор, читающий /proc. По умолчанию он включается только на Linux,
+// на других системах его можно включить явно
+func RegisterLinux(name string, factory Factory) {
+	Register(name, factory)
+	linuxOnly[name] = true
+}
+
+// Names - имена зарегистрированных коллекторов по алфавиту
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// defaultNames - коллекторы, включенные без настройки на системе goos
+func defaultNames(goos string) []string {
+	names := make([]string, 0, len(registry))
+	for _, name := range Names() {
+		if goos == "linux" || !linuxOnly[name] {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// NewCollectors создает включенные в конфиге коллекторы
+func NewCollectors(cfg *config.Config) ([]Collector, error) {
+	names := cfg.Collectors
+	if len(names) == 0 {
+		names = defaultNames(runtime.GOOS)
+	}
+
+	for name := range cfg.CollectorIntervals {
+		if _, exist := registry[name]; !exist {
+			return nil, fmt.Errorf("interval for unknown collector %s", name)
+		}
+	}
+
+	collectors := make([]Collector, 0, len(names))
+	for _, name := range names {
+		factory, exist := registry[name]
+		if !exist {
+			return nil, fmt.Errorf("unknown collector %s, available: %v", name, Names())
+		}
+
+		tickerTime, exist := cfg.CollectorIntervals[name]
+		if !exist {
+			tickerTime = time.Duration(cfg.PollInterval) * time.Second
+		}
+
+		collectors = append(collectors, factory(cfg, tickerTime))
+	}
+
+	return collectors, nil
+}
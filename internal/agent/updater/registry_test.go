@@ -0,0 +1,79 @@
+package updater
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AntonPashechko/yametrix/internal/agent/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCollectors(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       config.Config
+		wantCount int
+		wantErr   bool
+	}{
+		{
+			name:      "all_by_default",
+			cfg:       config.Config{PollInterval: 2},
+			wantCount: len(Names()),
+		},
+		{
+			name:      "enabled_only",
+			cfg:       config.Config{PollInterval: 2, Collectors: []string{"runtime", "disk"}},
+			wantCount: 2,
+		},
+		{
+			name:    "unknown_collector",
+			cfg:     config.Config{PollInterval: 2, Collectors: []string{"gpu"}},
+			wantErr: true,
+		},
+		{
+			name:    "interval_for_unknown_collector",
+			cfg:     config.Config{PollInterval: 2, CollectorIntervals: map[string]time.Duration{"gpu": time.Second}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			collectors, err := NewCollectors(&tt.cfg)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, collectors, tt.wantCount)
+		})
+	}
+}
+
+func TestDefaultNames(t *testing.T) {
+	assert.Equal(t, Names(), defaultNames("linux"))
+
+	//На других системах нет /proc, коллекторы по нему сами не включаются
+	assert.ElementsMatch(t, []string{"another", "exec", "runtime", "scrape"}, defaultNames("windows"))
+}
+
+func TestCollectorIntervals(t *testing.T) {
+	cfg := config.Config{
+		PollInterval:       2,
+		Collectors:         []string{"disk", "system"},
+		CollectorIntervals: map[string]time.Duration{"disk": 30 * time.Second},
+	}
+
+	collectors, err := NewCollectors(&cfg)
+	require.NoError(t, err)
+	require.Len(t, collectors, 2)
+
+	assert.Equal(t, 30*time.Second, collectors[0].(*DiskMetricsProducer).tickerTime)
+	assert.Equal(t, 2*time.Second, collectors[1].(*SystemMetricsProducer).tickerTime)
+}
+
+func TestRegisterDuplicate(t *testing.T) {
+	assert.Panics(t, func() {
+		Register("runtime", nil)
+	})
+}
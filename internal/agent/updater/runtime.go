@@ -37,13 +37,19 @@ type RuntimeMetricsProducer struct {
 	tickerTime time.Duration
 }
 
-func NewRuntimeMetricsProducer(cfg *config.Config) *RuntimeMetricsProducer {
+func init() {
+	Register("runtime", func(cfg *config.Config, tickerTime time.Duration) Collector {
+		return NewRuntimeMetricsProducer(cfg, tickerTime)
+	})
+}
+
+func NewRuntimeMetricsProducer(cfg *config.Config, tickerTime time.Duration) *RuntimeMetricsProducer {
 	return &RuntimeMetricsProducer{
-		tickerTime: time.Duration(cfg.PollInterval) * time.Second,
+		tickerTime: tickerTime,
 	}
 }
 
-func (m *RuntimeMetricsProducer) produceMetrics(metricCh chan<- models.MetricDTO) {
+func (m *RuntimeMetricsProducer) produceMetrics(ctx context.Context, metricCh chan<- models.MetricDTO) {
 	mem := new(runtime.MemStats)
 	runtime.ReadMemStats(mem)
 
@@ -59,27 +65,19 @@ func (m *RuntimeMetricsProducer) produceMetrics(metricCh chan<- models.MetricDTO
 		fmt.Printf("cannot unmarshal json: %s\n", err)
 	}
 
+	metrics := make([]models.MetricDTO, 0, len(RuntimeGaugesName)+2)
 	for _, gaugeName := range RuntimeGaugesName {
-		metricCh <- models.NewGaugeMetric(gaugeName, fields[gaugeName].(float64))
+		metrics = append(metrics, models.NewGaugeMetric(gaugeName, fields[gaugeName].(float64)))
 	}
+	metrics = append(metrics, models.NewCounterMetric(pollCount, 1), models.NewGaugeMetric(randomValue, randFloats()))
 
-	metricCh <- models.NewCounterMetric(pollCount, 1)
-	metricCh <- models.NewGaugeMetric(randomValue, randFloats())
-}
-
-func (m *RuntimeMetricsProducer) Work(ctx context.Context, wg *sync.WaitGroup, metricCh chan<- models.MetricDTO) {
-	defer wg.Done()
-
-	ticker := time.NewTicker(m.tickerTime)
-
-	for {
-		select {
-		// выход по ctx
-		case <-ctx.Done():
+	for _, metric := range metrics {
+		if !send(ctx, metricCh, metric) {
 			return
-		// собираем метрики, пишем их в канал
-		case <-ticker.C:
-			m.produceMetrics(metricCh)
 		}
 	}
 }
+
+func (m *RuntimeMetricsProducer) Work(ctx context.Context, wg *sync.WaitGroup, metricCh chan<- models.MetricDTO) {
+	pollLoop(ctx, wg, m.tickerTime, func() { m.produceMetrics(ctx, metricCh) })
+}
@@ -0,0 +1,186 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AntonPashechko/yametrix/internal/agent/config"
+	"github.com/AntonPashechko/yametrix/internal/models"
+	"github.com/AntonPashechko/yametrix/internal/prometheus"
+)
+
+const (
+	scrapeTimeout = 5 * time.Second
+	instanceLabel = "instance"
+)
+
+func init() {
+	Register("scrape", func(cfg *config.Config, tickerTime time.Duration) Collector {
+		return NewScrapeMetricsProducer(cfg, tickerTime)
+	})
+}
+
+// ScrapeMetricsProducer опрашивает Prometheus эндпоинты приложений.
+// Counter и histogram там накопленные, а на сервере суммируются - поэтому шлем прирост с прошлого опроса
+type ScrapeMetricsProducer struct {
+	tickerTime time.Duration
+	targets    []string
+	client     *http.Client
+	//Часть накопленного counter, уже отправленная приростом. Прирост на сервере целый,
+	//поэтому дробный остаток не теряется, а переходит в следующий опрос
+	prevCounters   map[string]float64
+	prevHistograms map[string]*models.Histogram
+}
+
+func NewScrapeMetricsProducer(cfg *config.Config, tickerTime time.Duration) *ScrapeMetricsProducer {
+	targets := make([]string, 0, len(cfg.ScrapeTargets))
+	for _, target := range cfg.ScrapeTargets {
+		if !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://") {
+			target = "http://" + target
+		}
+		targets = append(targets, target)
+	}
+
+	return &ScrapeMetricsProducer{
+		tickerTime:     tickerTime,
+		targets:        targets,
+		client:         &http.Client{Timeout: scrapeTimeout},
+		prevCounters:   make(map[string]float64),
+		prevHistograms: make(map[string]*models.Histogram),
+	}
+}
+
+// scrape забирает и разбирает метрики одного эндпоинта
+func (m *ScrapeMetricsProducer) scrape(ctx context.Context, target string) ([]models.MetricDTO, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create request: %w", err)
+	}
+	req.Header.Set("Accept", prometheus.ContentType)
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot do request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	families, err := prometheus.ParseText(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse metrics: %w", err)
+	}
+
+	return prometheus.ToMetrics(families)
+}
+
+// histogramDelta - прирост гистограммы, nil если границы поменялись или был сброс
+func histogramDelta(cur *models.Histogram, prev *models.Histogram) *models.Histogram {
+	if len(cur.Bounds) != len(prev.Bounds) || len(cur.Counts) != len(prev.Counts) || cur.Count < prev.Count {
+		return nil
+	}
+
+	for i := range cur.Bounds {
+		if cur.Bounds[i] != prev.Bounds[i] {
+			return nil
+		}
+	}
+
+	res := cur.Copy()
+	for i := range res.Counts {
+		if cur.Counts[i] < prev.Counts[i] {
+			return nil
+		}
+		res.Counts[i] -= prev.Counts[i]
+	}
+	res.Sum -= prev.Sum
+	res.Count -= prev.Count
+
+	return res
+}
+
+// delta переводит накопленные значения в прирост, запоминая текущие.
+// Для нового ряда прироста нет - только запоминаем
+func (m *ScrapeMetricsProducer) delta(metric models.MetricDTO) (models.MetricDTO, bool) {
+	key := metric.SeriesKey()
+
+	switch metric.MType {
+	case models.CounterType:
+		cur := *metric.Value
+		metric.Value = nil
+
+		sent, ok := m.prevCounters[key]
+		if !ok {
+			m.prevCounters[key] = cur
+			return metric, false
+		}
+
+		//Приложение перезапустилось - счет пошел с нуля
+		if cur < sent {
+			sent = 0
+		}
+
+		delta := int64(cur - sent)
+		m.prevCounters[key] = sent + float64(delta)
+		metric.SetDelta(delta)
+	case models.HistogramType:
+		cur := metric.Histogram
+		prev, ok := m.prevHistograms[key]
+		m.prevHistograms[key] = cur
+		if !ok {
+			return metric, false
+		}
+
+		if delta := histogramDelta(cur, prev); delta != nil {
+			metric.Histogram = delta
+		}
+	}
+
+	return metric, true
+}
+
+// targetInstance - host:port эндпоинта, им помечаются ряды, что бы приложения не смешивались
+func targetInstance(target string) string {
+	if u, err := url.Parse(target); err == nil && u.Host != "" {
+		return u.Host
+	}
+
+	return target
+}
+
+func (m *ScrapeMetricsProducer) produceMetrics(ctx context.Context, metricCh chan<- models.MetricDTO) {
+	for _, target := range m.targets {
+		metrics, err := m.scrape(ctx, target)
+		if err != nil {
+			fmt.Printf("cannot scrape %s: %s\n", target, err)
+			continue
+		}
+
+		instance := targetInstance(target)
+		for _, metric := range metrics {
+			if _, ok := metric.Labels[instanceLabel]; !ok {
+				labels := make(map[string]string, len(metric.Labels)+1)
+				for k, v := range metric.Labels {
+					labels[k] = v
+				}
+				labels[instanceLabel] = instance
+				metric.Labels = labels
+			}
+
+			if metric, ok := m.delta(metric); ok && !send(ctx, metricCh, metric) {
+				return
+			}
+		}
+	}
+}
+
+func (m *ScrapeMetricsProducer) Work(ctx context.Context, wg *sync.WaitGroup, metricCh chan<- models.MetricDTO) {
+	pollLoop(ctx, wg, m.tickerTime, func() { m.produceMetrics(ctx, metricCh) })
+}
@@ -0,0 +1,129 @@
+package updater
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AntonPashechko/yametrix/internal/agent/config"
+	"github.com/AntonPashechko/yametrix/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScrapeMetricsProducer(t *testing.T) {
+	responses := []string{
+		`# TYPE requests_total counter
+requests_total{code="200"} 10
+# TYPE latency histogram
+latency_bucket{le="1"} 2
+latency_bucket{le="+Inf"} 3
+latency_sum 4
+latency_count 3
+queue_size 5
+`,
+		`# TYPE requests_total counter
+requests_total{code="200"} 15
+# TYPE latency histogram
+latency_bucket{le="1"} 3
+latency_bucket{le="+Inf"} 5
+latency_sum 10
+latency_count 5
+queue_size 7
+`,
+	}
+
+	var call int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(responses[call]))
+		call++
+	}))
+	defer server.Close()
+
+	instance := strings.TrimPrefix(server.URL, "http://")
+	producer := NewScrapeMetricsProducer(&config.Config{ScrapeTargets: []string{instance}}, time.Second)
+
+	collect := func() map[string]models.MetricDTO {
+		metricCh := make(chan models.MetricDTO, 10)
+		producer.produceMetrics(context.Background(), metricCh)
+		close(metricCh)
+
+		metrics := make(map[string]models.MetricDTO)
+		for metric := range metricCh {
+			assert.Equal(t, instance, metric.Labels["instance"])
+			metrics[metric.ID] = metric
+		}
+		return metrics
+	}
+
+	//Первый опрос: накопленные значения только запоминаются, gauge уходит сразу
+	first := collect()
+	require.Len(t, first, 1)
+	assert.Equal(t, 5.0, *first["queue_size"].Value)
+
+	second := collect()
+	require.Len(t, second, 3)
+	assert.Equal(t, int64(5), *second["requests_total"].Delta)
+	assert.Equal(t, &models.Histogram{Bounds: []float64{1}, Counts: []uint64{1, 1}, Sum: 6, Count: 2}, second["latency"].Histogram)
+	assert.Equal(t, 7.0, *second["queue_size"].Value)
+}
+
+func TestScrapeMetricsProducer_fractionalCounter(t *testing.T) {
+	producer := NewScrapeMetricsProducer(&config.Config{}, time.Second)
+
+	counter := func(value float64) models.MetricDTO {
+		metric := models.MetricDTO{ID: "cpu_seconds_total", MType: models.CounterType}
+		metric.SetValue(value)
+		return metric
+	}
+
+	//Дробный остаток копится между опросами, а не теряется
+	_, ok := producer.delta(counter(0.4))
+	require.False(t, ok)
+
+	var sum int64
+	for _, value := range []float64{1.1, 1.8, 2.5, 3.2} {
+		metric, ok := producer.delta(counter(value))
+		require.True(t, ok)
+		assert.Nil(t, metric.Value)
+		sum += *metric.Delta
+	}
+	assert.Equal(t, int64(2), sum)
+
+	//Сброс счетчика: шлем накопленное после перезапуска
+	metric, ok := producer.delta(counter(1.5))
+	require.True(t, ok)
+	assert.Equal(t, int64(1), *metric.Delta)
+}
+
+func TestHistogramDelta(t *testing.T) {
+	prev := &models.Histogram{Bounds: []float64{1}, Counts: []uint64{2, 1}, Sum: 4, Count: 3}
+
+	tests := []struct {
+		name string
+		cur  *models.Histogram
+		want *models.Histogram
+	}{
+		{
+			name: "growth",
+			cur:  &models.Histogram{Bounds: []float64{1}, Counts: []uint64{3, 1}, Sum: 4.5, Count: 4},
+			want: &models.Histogram{Bounds: []float64{1}, Counts: []uint64{1, 0}, Sum: 0.5, Count: 1},
+		},
+		{
+			name: "reset",
+			cur:  &models.Histogram{Bounds: []float64{1}, Counts: []uint64{1, 0}, Sum: 0.5, Count: 1},
+		},
+		{
+			name: "other_bounds",
+			cur:  &models.Histogram{Bounds: []float64{2}, Counts: []uint64{3, 1}, Sum: 4.5, Count: 4},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, histogramDelta(tt.cur, prev))
+		})
+	}
+}
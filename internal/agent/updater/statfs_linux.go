@@ -0,0 +1,14 @@
+package updater
+
+import "syscall"
+
+// diskUsage - размер и свободное место файловой системы в байтах
+func diskUsage(path string) (total uint64, free uint64, err error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, 0, err
+	}
+
+	//Bavail - доступно непривилегированным пользователям, как показывает df
+	return st.Blocks * uint64(st.Bsize), st.Bavail * uint64(st.Bsize), nil
+}
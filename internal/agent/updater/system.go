@@ -0,0 +1,81 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/AntonPashechko/yametrix/internal/agent/config"
+	"github.com/AntonPashechko/yametrix/internal/models"
+)
+
+const (
+	load1  = "Load1"
+	load5  = "Load5"
+	load15 = "Load15"
+
+	fileDescriptorsAllocated = "FileDescriptorsAllocated"
+	fileDescriptorsMax       = "FileDescriptorsMax"
+)
+
+// SystemMetricsProducer - средняя загрузка и открытые файловые дескрипторы хоста
+type SystemMetricsProducer struct {
+	tickerTime time.Duration
+}
+
+func init() {
+	RegisterLinux("system", func(cfg *config.Config, tickerTime time.Duration) Collector {
+		return NewSystemMetricsProducer(cfg, tickerTime)
+	})
+}
+
+func NewSystemMetricsProducer(cfg *config.Config, tickerTime time.Duration) *SystemMetricsProducer {
+	return &SystemMetricsProducer{
+		tickerTime: tickerTime,
+	}
+}
+
+func (m *SystemMetricsProducer) produceMetrics(ctx context.Context, metricCh chan<- models.MetricDTO) {
+	if load, err := readProcFile(parseLoadAvg, "loadavg"); err != nil {
+		fmt.Printf("cannot get load average: %s\n", err)
+	} else {
+		for _, metric := range []models.MetricDTO{
+			models.NewGaugeMetric(load1, load[0]),
+			models.NewGaugeMetric(load5, load[1]),
+			models.NewGaugeMetric(load15, load[2]),
+		} {
+			if !send(ctx, metricCh, metric) {
+				return
+			}
+		}
+	}
+
+	if fds, err := readProcFile(parseFileNr, "sys", "fs", "file-nr"); err != nil {
+		fmt.Printf("cannot get file descriptors: %s\n", err)
+	} else {
+		for _, metric := range []models.MetricDTO{
+			models.NewGaugeMetric(fileDescriptorsAllocated, fds[0]-fds[1]),
+			models.NewGaugeMetric(fileDescriptorsMax, fds[2]),
+		} {
+			if !send(ctx, metricCh, metric) {
+				return
+			}
+		}
+	}
+}
+
+func (m *SystemMetricsProducer) Work(ctx context.Context, wg *sync.WaitGroup, metricCh chan<- models.MetricDTO) {
+	pollLoop(ctx, wg, m.tickerTime, func() { m.produceMetrics(ctx, metricCh) })
+}
+
+// countFDs - количество открытых дескрипторов процесса
+func countFDs(pid string) (int, error) {
+	entries, err := os.ReadDir(procPath(pid, "fd"))
+	if err != nil {
+		return 0, err
+	}
+
+	return len(entries), nil
+}
@@ -0,0 +1,237 @@
+package alerting
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/AntonPashechko/yametrix/internal/logger"
+	"github.com/AntonPashechko/yametrix/internal/models"
+	"github.com/AntonPashechko/yametrix/internal/storage"
+	"github.com/AntonPashechko/yametrix/internal/tenant"
+)
+
+// Состояния алерта
+const (
+	StatePending  = "pending"
+	StateFiring   = "firing"
+	StateResolved = "resolved"
+)
+
+// Alert - текущее состояние сработавшего правила
+type Alert struct {
+	Name       string            `json:"name"`
+	Expr       string            `json:"expr"`
+	Tenant     string            `json:"tenant,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	State      string            `json:"state"`
+	Value      float64           `json:"value"`
+	ActiveAt   time.Time         `json:"active_at"`
+	FiredAt    *time.Time        `json:"fired_at,omitempty"`
+	ResolvedAt *time.Time        `json:"resolved_at,omitempty"`
+}
+
+// sample - значение метрики на момент прошлой проверки, нужно для rate()
+type sample struct {
+	value float64
+	ts    time.Time
+}
+
+/*Движок алертинга - периодически проверяет правила по хранилищу метрик, реализует scheduler.RecurringWorker*/
+type Engine struct {
+	sync.Mutex
+
+	storage storage.MetricsStorage
+	rules   []Rule
+	alerts  map[string]*Alert //активные алерты по имени правила
+	samples map[string]sample //прошлые значения для rate()
+	now     func() time.Time
+
+	notifier Notifier
+}
+
+func NewEngine(storage storage.MetricsStorage, rules []Rule) *Engine {
+	return &Engine{
+		storage: storage,
+		rules:   rules,
+		alerts:  make(map[string]*Alert),
+		samples: make(map[string]sample),
+		now:     time.Now,
+	}
+}
+
+// SetNotifier задает получателя сработавших и закрытых алертов
+func (m *Engine) SetNotifier(notifier Notifier) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.notifier = notifier
+}
+
+func (m *Engine) notify(alert Alert) {
+	if m.notifier != nil {
+		m.notifier.Notify(alert)
+	}
+}
+
+// HasRules сообщает, есть ли что проверять
+func (m *Engine) HasRules() bool {
+	m.Lock()
+	defer m.Unlock()
+
+	return len(m.rules) != 0
+}
+
+// tenantValues получает значения gauge и counter тенанта по идентификаторам рядов.
+// Если у gauge и counter один ряд - берем gauge
+func (m *Engine) tenantValues(name string) (map[string]float64, error) {
+	metrics, err := m.storage.GetMetrics(tenant.WithTenant(context.Background(), name), nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get metrics of tenant %q: %w", name, err)
+	}
+
+	values := make(map[string]float64, len(metrics))
+	for _, metric := range metrics {
+		key := metric.SeriesKey()
+
+		switch metric.MType {
+		case models.GaugeType:
+			if metric.Value != nil {
+				values[key] = *metric.Value
+			}
+		case models.CounterType:
+			if _, exist := values[key]; !exist && metric.Delta != nil {
+				values[key] = float64(*metric.Delta)
+			}
+		}
+	}
+
+	return values, nil
+}
+
+// ruleValue вычисляет значение выражения правила, ok = false - данных для проверки пока нет
+func (m *Engine) ruleValue(rule Rule, value float64, now time.Time) (float64, bool) {
+	if !rule.Rate {
+		return value, true
+	}
+
+	prev, exist := m.samples[rule.Name]
+	m.samples[rule.Name] = sample{value: value, ts: now}
+
+	//Для скорости нужны два замера
+	if !exist || !now.After(prev.ts) {
+		return 0, false
+	}
+
+	return (value - prev.value) / now.Sub(prev.ts).Seconds(), true
+}
+
+// resolve закрывает алерт правила, сработавший алерт уходит получателю как resolved
+func (m *Engine) resolve(rule Rule, now time.Time) {
+	alert, active := m.alerts[rule.Name]
+	if !active {
+		return
+	}
+
+	if alert.State == StateFiring {
+		alert.State = StateResolved
+		alert.ResolvedAt = &now
+		logger.Info("alert %s resolved", rule.Name)
+		m.notify(*alert)
+	}
+	delete(m.alerts, rule.Name)
+}
+
+// evaluate проверяет одно правило по значениям тенанта и переводит алерт в нужное состояние
+func (m *Engine) evaluate(rule Rule, values map[string]float64, now time.Time) {
+	metricValue, exist := values[rule.seriesKey()]
+	if !exist {
+		//Метрики больше нет - проверять нечего, алерт не должен висеть вечно
+		delete(m.samples, rule.Name)
+		m.resolve(rule, now)
+		return
+	}
+
+	value, ok := m.ruleValue(rule, metricValue, now)
+	if !ok {
+		return
+	}
+
+	if !rule.check(value) {
+		//Условие перестало выполняться
+		if alert, active := m.alerts[rule.Name]; active {
+			alert.Value = value
+		}
+		m.resolve(rule, now)
+		return
+	}
+
+	alert, active := m.alerts[rule.Name]
+	if !active {
+		alert = &Alert{
+			Name:     rule.Name,
+			Expr:     rule.Expr,
+			Tenant:   rule.Tenant,
+			Labels:   rule.Labels,
+			State:    StatePending,
+			ActiveAt: now,
+		}
+		m.alerts[rule.Name] = alert
+	}
+
+	alert.Value = value
+
+	if alert.State == StatePending && now.Sub(alert.ActiveAt) >= rule.For {
+		alert.State = StateFiring
+		alert.FiredAt = &now
+		logger.Info("alert %s is firing, value %v", rule.Name, value)
+		m.notify(*alert)
+	}
+}
+
+// Work проверяет все правила, реализует scheduler.RecurringWorker.
+// Метрики каждого тенанта читаются один раз за проверку
+func (m *Engine) Work() error {
+	m.Lock()
+	defer m.Unlock()
+
+	now := m.now()
+	tenants := make(map[string]map[string]float64)
+
+	for _, rule := range m.rules {
+		values, loaded := tenants[rule.Tenant]
+		if !loaded {
+			var err error
+			values, err = m.tenantValues(rule.Tenant)
+			if err != nil {
+				//Хранилище недоступно - это не повод закрывать алерты
+				logger.Error("cannot evaluate alert rule %s: %s", rule.Name, err)
+				continue
+			}
+			tenants[rule.Tenant] = values
+		}
+
+		m.evaluate(rule, values, now)
+	}
+
+	return nil
+}
+
+// ActiveAlerts возвращает pending и firing алерты, отсортированные по имени
+func (m *Engine) ActiveAlerts() []Alert {
+	m.Lock()
+	defer m.Unlock()
+
+	alerts := make([]Alert, 0, len(m.alerts))
+	for _, alert := range m.alerts {
+		alerts = append(alerts, *alert)
+	}
+
+	sort.Slice(alerts, func(i, j int) bool {
+		return alerts[i].Name < alerts[j].Name
+	})
+
+	return alerts
+}
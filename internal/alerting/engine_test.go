@@ -0,0 +1,99 @@
+package alerting
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/AntonPashechko/yametrix/internal/models"
+	"github.com/AntonPashechko/yametrix/internal/storage/memstorage"
+	"github.com/AntonPashechko/yametrix/internal/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngine_Work(t *testing.T) {
+	storage := memstorage.NewStorage()
+
+	rules, err := NewRules([]RuleConfig{
+		{Name: "LowMemory", Expr: "FreeMemory < 500MB for 2m"},
+		{Name: "Stalled", Expr: "rate(PollCount) == 0"},
+	})
+	require.NoError(t, err)
+
+	engine := NewEngine(storage, rules)
+
+	now := time.Now()
+	engine.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	storage.SetGauge(ctx, models.NewGaugeMetric("FreeMemory", 100<<20))
+	storage.AddCounter(ctx, models.NewCounterMetric("PollCount", 1))
+
+	//Первая проверка - память заканчивается, для rate пока нет данных
+	engine.Work()
+	alerts := engine.ActiveAlerts()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, StatePending, alerts[0].State)
+
+	//Прошла минута - PollCount не менялся, память все еще мало, но for еще не прошел
+	now = now.Add(time.Minute)
+	engine.Work()
+	alerts = engine.ActiveAlerts()
+	require.Len(t, alerts, 2)
+	assert.Equal(t, StatePending, alerts[0].State)
+	assert.Equal(t, StateFiring, alerts[1].State)
+
+	//Через две минуты алерт по памяти срабатывает, а агент ожил
+	now = now.Add(time.Minute)
+	storage.AddCounter(ctx, models.NewCounterMetric("PollCount", 1))
+	engine.Work()
+	alerts = engine.ActiveAlerts()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "LowMemory", alerts[0].Name)
+	assert.Equal(t, StateFiring, alerts[0].State)
+
+	//Память освободилась, агент продолжает работать
+	storage.SetGauge(ctx, models.NewGaugeMetric("FreeMemory", 1<<30))
+	storage.AddCounter(ctx, models.NewCounterMetric("PollCount", 1))
+	now = now.Add(time.Minute)
+	engine.Work()
+	assert.Empty(t, engine.ActiveAlerts())
+}
+
+func TestEngine_WorkTenantLabels(t *testing.T) {
+	storage := memstorage.NewStorage()
+
+	rules, err := NewRules([]RuleConfig{
+		{Name: "LowMemory", Expr: "FreeMemory < 500MB", Tenant: "team-a", Labels: map[string]string{"host": "a"}},
+	})
+	require.NoError(t, err)
+
+	engine := NewEngine(storage, rules)
+
+	//Метрика с тем же именем без тенанта и другого хоста правило не касается
+	storage.SetGauge(context.Background(), models.NewGaugeMetric("FreeMemory", 100<<20))
+	ctx := tenant.WithTenant(context.Background(), "team-a")
+	other := models.NewGaugeMetric("FreeMemory", 100<<20)
+	other.Labels = map[string]string{"host": "b"}
+	storage.SetGauge(ctx, other)
+
+	engine.Work()
+	assert.Empty(t, engine.ActiveAlerts())
+
+	metric := models.NewGaugeMetric("FreeMemory", 100<<20)
+	metric.Labels = map[string]string{"host": "a"}
+	storage.SetGauge(ctx, metric)
+
+	engine.Work()
+	alerts := engine.ActiveAlerts()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, StateFiring, alerts[0].State)
+	assert.Equal(t, "team-a", alerts[0].Tenant)
+	assert.Equal(t, map[string]string{"host": "a"}, alerts[0].Labels)
+
+	//Метрика пропала (например, сервер перезапустили без восстановления) - алерт закрывается
+	engine.storage = memstorage.NewStorage()
+	engine.Work()
+	assert.Empty(t, engine.ActiveAlerts())
+}
@@ -0,0 +1,151 @@
+package alerting
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/AntonPashechko/yametrix/internal/logger"
+	"github.com/go-resty/resty/v2"
+)
+
+const (
+	notifyQueueSize = 100
+	//Один запрос к webhook, зависший адрес не должен держать очередь уведомлений
+	notifyTimeout = 5 * time.Second
+)
+
+// Notifier получает алерты, перешедшие в состояние firing или resolved
+type Notifier interface {
+	Notify(Alert)
+}
+
+// WebhookNotifier отправляет алерты POST запросом с JSON телом на заданные адреса
+type WebhookNotifier struct {
+	urls               []string
+	client             *resty.Client
+	retriableIntervals []time.Duration
+
+	queue chan Alert
+	sent  map[string]string //последнее доставленное состояние по имени алерта
+	done  chan struct{}
+
+	//Отменяет отправку, если при остановке очередь не успела разойтись
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewWebhookNotifier(urls []string) *WebhookNotifier {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &WebhookNotifier{
+		urls:               urls,
+		client:             resty.New().SetTimeout(notifyTimeout),
+		retriableIntervals: []time.Duration{time.Second, 3 * time.Second, 5 * time.Second, time.Nanosecond},
+		queue:              make(chan Alert, notifyQueueSize),
+		sent:               make(map[string]string),
+		done:               make(chan struct{}),
+		ctx:                ctx,
+		cancel:             cancel,
+	}
+}
+
+// Notify ставит алерт в очередь на отправку, не блокирует движок алертинга
+func (m *WebhookNotifier) Notify(alert Alert) {
+	select {
+	case m.queue <- alert:
+	default:
+		logger.Error("notify queue is full, alert %s (%s) is dropped", alert.Name, alert.State)
+	}
+}
+
+// Start запускает доставку уведомлений, завершается после Stop
+func (m *WebhookNotifier) Start() {
+	defer close(m.done)
+
+	for alert := range m.queue {
+		m.deliver(alert)
+	}
+}
+
+// Stop дожидается отправки уже поставленных в очередь уведомлений, но не дольше ctx -
+// потом оставшиеся отправки отменяются. Вызывается только после Start
+func (m *WebhookNotifier) Stop(ctx context.Context) {
+	close(m.queue)
+
+	select {
+	case <-m.done:
+	case <-ctx.Done():
+		logger.Error("notify queue is not delivered before shutdown: %s", ctx.Err())
+		m.cancel()
+		<-m.done
+	}
+
+	m.cancel()
+}
+
+// deliver отправляет алерт на все адреса, повторные уведомления о том же состоянии не отправляются
+func (m *WebhookNotifier) deliver(alert Alert) {
+	key := fmt.Sprintf("%s/%d", alert.State, alert.ActiveAt.UnixNano())
+	if m.sent[alert.Name] == key {
+		return
+	}
+
+	body, err := json.Marshal(alert)
+	if err != nil {
+		logger.Error("cannot marshal alert %s: %s", alert.Name, err)
+		return
+	}
+
+	for _, webhook := range m.urls {
+		if err := m.retriablePost(webhook, body); err != nil {
+			logger.Error("cannot notify %s about alert %s: %s", webhook, alert.Name, err)
+		}
+	}
+
+	//Для закрытого алерта помнить больше нечего
+	if alert.State == StateResolved {
+		delete(m.sent, alert.Name)
+	} else {
+		m.sent[alert.Name] = key
+	}
+}
+
+func (m *WebhookNotifier) retriablePost(postURL string, body []byte) error {
+	var err error
+	var urlErr *url.Error
+
+	for _, interval := range m.retriableIntervals {
+		var resp *resty.Response
+		resp, err = m.client.R().
+			SetContext(m.ctx).
+			SetHeader("Content-Type", "application/json").
+			SetBody(body).
+			Post(postURL)
+
+		if err == nil {
+			if resp.StatusCode() < http.StatusInternalServerError {
+				if resp.IsError() {
+					return fmt.Errorf("webhook respond %s", resp.Status())
+				}
+				return nil
+			}
+			//Сервер временно не справляется - пробуем еще
+			err = fmt.Errorf("webhook respond %s", resp.Status())
+		} else if !errors.As(err, &urlErr) || m.ctx.Err() != nil {
+			break
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-m.ctx.Done():
+			return fmt.Errorf("cannot retriable post alert: %w", m.ctx.Err())
+		}
+	}
+
+	return fmt.Errorf("cannot retriable post alert: %w", err)
+}
@@ -0,0 +1,81 @@
+package alerting
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	var mu sync.Mutex
+	received := make([]Alert, 0)
+	calls := 0
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		//Первый запрос отвечаем ошибкой, что бы проверить повтор
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var alert Alert
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&alert))
+		received = append(received, alert)
+	}))
+	defer ts.Close()
+
+	notifier := NewWebhookNotifier([]string{ts.URL})
+	notifier.retriableIntervals = []time.Duration{time.Millisecond, time.Millisecond}
+	go notifier.Start()
+
+	activeAt := time.Now()
+	firing := Alert{Name: "LowMemory", State: StateFiring, ActiveAt: activeAt}
+	resolved := Alert{Name: "LowMemory", State: StateResolved, ActiveAt: activeAt}
+
+	notifier.Notify(firing)
+	//Повтор того же состояния не должен уйти второй раз
+	notifier.Notify(firing)
+	notifier.Notify(resolved)
+	notifier.Stop(context.Background())
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	assert.Equal(t, 3, calls)
+	if assert.Len(t, received, 2) {
+		assert.Equal(t, StateFiring, received[0].State)
+		assert.Equal(t, StateResolved, received[1].State)
+	}
+}
+
+func TestWebhookNotifierStopTimeout(t *testing.T) {
+	//Webhook не отвечает - остановка не ждет его дольше переданного контекста
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	notifier := NewWebhookNotifier([]string{ts.URL})
+	go notifier.Start()
+	notifier.Notify(Alert{Name: "LowMemory", State: StateFiring, ActiveAt: time.Now()})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	notifier.Stop(ctx)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
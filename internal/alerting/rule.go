@@ -0,0 +1,181 @@
+package alerting
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/AntonPashechko/yametrix/internal/models"
+	"github.com/AntonPashechko/yametrix/internal/tenant"
+	"github.com/AntonPashechko/yametrix/pkg/utils"
+)
+
+// Операторы сравнения, допустимые в выражении правила
+const (
+	opLess         = "<"
+	opLessEqual    = "<="
+	opGreater      = ">"
+	opGreaterEqual = ">="
+	opEqual        = "=="
+	opNotEqual     = "!="
+)
+
+// Множители для значений с единицами измерения объема
+var units = map[string]float64{
+	"":   1,
+	"B":  1,
+	"KB": 1 << 10,
+	"MB": 1 << 20,
+	"GB": 1 << 30,
+	"TB": 1 << 40,
+}
+
+// Выражение вида: [rate(]Metric[)] op Value[unit] [for Duration]
+var exprRegexp = regexp.MustCompile(`^\s*(rate\(\s*([^()\s]+)\s*\)|[^()\s<>=!]+)\s*(<=|>=|==|!=|<|>)\s*(-?[0-9.]+(?:[eE][-+]?[0-9]+)?)\s*([KMGT]?B)?\s*(?:for\s+(\S+))?\s*$`)
+
+// RuleConfig - описание правила в файле правил
+type RuleConfig struct {
+	Name   string            `json:"name" yaml:"name"`                         // имя алерта
+	Expr   string            `json:"expr" yaml:"expr"`                         // условие, например "FreeMemory < 500MB for 2m"
+	For    string            `json:"for,omitempty" yaml:"for,omitempty"`       // сколько условие должно выполняться до срабатывания
+	Tenant string            `json:"tenant,omitempty" yaml:"tenant,omitempty"` // тенант метрики, пусто - метрики без тенанта
+	Labels map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"` // метки ряда метрики
+}
+
+// Rule - разобранное правило алертинга
+type Rule struct {
+	Name      string
+	Expr      string
+	Tenant    string
+	MetricID  string
+	Labels    map[string]string
+	Rate      bool //сравниваем скорость изменения метрики в секунду, а не значение
+	Operator  string
+	Threshold float64
+	For       time.Duration
+}
+
+func NewRule(cfg RuleConfig) (Rule, error) {
+	rule := Rule{
+		Name:   cfg.Name,
+		Expr:   cfg.Expr,
+		Tenant: cfg.Tenant,
+		Labels: cfg.Labels,
+	}
+
+	if rule.Name == "" {
+		return rule, fmt.Errorf("rule name is empty")
+	}
+
+	if rule.Tenant != tenant.Default {
+		if err := tenant.Validate(rule.Tenant); err != nil {
+			return rule, fmt.Errorf("rule %s: %w", cfg.Name, err)
+		}
+	}
+
+	if err := models.ValidateLabels(rule.Labels); err != nil {
+		return rule, fmt.Errorf("rule %s: %w", cfg.Name, err)
+	}
+
+	match := exprRegexp.FindStringSubmatch(cfg.Expr)
+	if match == nil {
+		return rule, fmt.Errorf("rule %s: bad expression %q", cfg.Name, cfg.Expr)
+	}
+
+	if match[2] != "" {
+		rule.Rate = true
+		rule.MetricID = match[2]
+	} else {
+		rule.MetricID = match[1]
+	}
+
+	rule.Operator = match[3]
+
+	threshold, err := utils.StrToFloat64(match[4])
+	if err != nil {
+		return rule, fmt.Errorf("rule %s: bad threshold %s: %w", cfg.Name, match[4], err)
+	}
+	rule.Threshold = threshold * units[strings.ToUpper(match[5])]
+
+	//Длительность можно задать как в выражении, так и отдельным полем
+	forStr := match[6]
+	if cfg.For != "" {
+		if forStr != "" {
+			return rule, fmt.Errorf("rule %s: duration is set twice", cfg.Name)
+		}
+		forStr = cfg.For
+	}
+
+	if forStr != "" {
+		rule.For, err = time.ParseDuration(forStr)
+		if err != nil {
+			return rule, fmt.Errorf("rule %s: bad duration %s: %w", cfg.Name, forStr, err)
+		}
+	}
+
+	return rule, nil
+}
+
+func NewRules(configs []RuleConfig) ([]Rule, error) {
+	rules := make([]Rule, 0, len(configs))
+	names := make(map[string]struct{}, len(configs))
+
+	for _, cfg := range configs {
+		rule, err := NewRule(cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, exist := names[rule.Name]; exist {
+			return nil, fmt.Errorf("duplicate rule name %s", rule.Name)
+		}
+		names[rule.Name] = struct{}{}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// LoadRules читает правила из JSON файла
+func LoadRules(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read rules file: %w", err)
+	}
+
+	var configs []RuleConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal rules: %w", err)
+	}
+
+	return NewRules(configs)
+}
+
+// seriesKey - идентификатор ряда метрики правила в хранилище
+func (m Rule) seriesKey() string {
+	return models.SeriesKey(m.MetricID, m.Labels)
+}
+
+// check проверяет условие правила для значения
+func (m Rule) check(value float64) bool {
+	switch m.Operator {
+	case opLess:
+		return value < m.Threshold
+	case opLessEqual:
+		return value <= m.Threshold
+	case opGreater:
+		return value > m.Threshold
+	case opGreaterEqual:
+		return value >= m.Threshold
+	case opEqual:
+		return value == m.Threshold
+	case opNotEqual:
+		return value != m.Threshold
+	}
+
+	return false
+}
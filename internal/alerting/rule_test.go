@@ -0,0 +1,75 @@
+package alerting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRule(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     RuleConfig
+		want    Rule
+		wantErr bool
+	}{
+		{
+			name: "units and duration in expression",
+			cfg:  RuleConfig{Name: "LowMemory", Expr: "FreeMemory < 500MB for 2m"},
+			want: Rule{Name: "LowMemory", Expr: "FreeMemory < 500MB for 2m", MetricID: "FreeMemory", Operator: "<", Threshold: 500 << 20, For: 2 * time.Minute},
+		},
+		{
+			name: "rate with separate duration",
+			cfg:  RuleConfig{Name: "Stalled", Expr: "rate(PollCount) == 0", For: "1m"},
+			want: Rule{Name: "Stalled", Expr: "rate(PollCount) == 0", MetricID: "PollCount", Rate: true, Operator: "==", Threshold: 0, For: time.Minute},
+		},
+		{
+			name: "without duration",
+			cfg:  RuleConfig{Name: "HighCPU", Expr: "CPUutilization1>=90.5"},
+			want: Rule{Name: "HighCPU", Expr: "CPUutilization1>=90.5", MetricID: "CPUutilization1", Operator: ">=", Threshold: 90.5},
+		},
+		{
+			name:    "bad operator",
+			cfg:     RuleConfig{Name: "Bad", Expr: "FreeMemory ~ 1"},
+			wantErr: true,
+		},
+		{
+			name:    "duration set twice",
+			cfg:     RuleConfig{Name: "Bad", Expr: "FreeMemory < 1 for 1m", For: "2m"},
+			wantErr: true,
+		},
+		{
+			name: "tenant and labels",
+			cfg:  RuleConfig{Name: "LowMemory", Expr: "FreeMemory < 1", Tenant: "team-a", Labels: map[string]string{"host": "a"}},
+			want: Rule{Name: "LowMemory", Expr: "FreeMemory < 1", Tenant: "team-a", MetricID: "FreeMemory", Labels: map[string]string{"host": "a"}, Operator: "<", Threshold: 1},
+		},
+		{
+			name:    "bad tenant",
+			cfg:     RuleConfig{Name: "Bad", Expr: "FreeMemory < 1", Tenant: "team a"},
+			wantErr: true,
+		},
+		{
+			name:    "bad label",
+			cfg:     RuleConfig{Name: "Bad", Expr: "FreeMemory < 1", Labels: map[string]string{"1host": "a"}},
+			wantErr: true,
+		},
+		{
+			name:    "empty name",
+			cfg:     RuleConfig{Expr: "FreeMemory < 1"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewRule(tt.cfg)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+// ErrUnknownToken - токена нет в хранилище
+var ErrUnknownToken = errors.New("unknown token")
+
+// Identity - владелец токена и что ему разрешено
+type Identity struct {
+	Name   string
+	Scopes []string
+	Tenant string //пусто - тенант выбирается заголовком
+}
+
+type identityKey struct{}
+
+// WithIdentity кладет владельца токена в контекст запроса
+func WithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// FromContext - владелец токена запроса, nil - авторизация выключена или не требовалась
+func FromContext(ctx context.Context) *Identity {
+	identity, _ := ctx.Value(identityKey{}).(*Identity)
+	return identity
+}
+
+func (m *Identity) HasScope(scope string) bool {
+	for _, s := range m.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenStore - хранилище токенов: файл или БД
+type TokenStore interface {
+	Lookup(ctx context.Context, token string) (*Identity, error)
+	Close()
+}
+
+// MetricsTokens - токены сервера, nil - авторизация выключена
+var MetricsTokens TokenStore
+
+func Initialize(store TokenStore) {
+	MetricsTokens = store
+}
+
+// hashToken - в памяти и в БД держим только хэши токенов
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// validScope - известные области доступа
+func validScope(scope string) bool {
+	return scope == ScopeRead || scope == ScopeWrite
+}
+
+// parseScopes разбирает области доступа через запятую
+func parseScopes(value string) []string {
+	var scopes []string
+	for _, scope := range strings.Split(value, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testTokens = `[
+	{"name": "agent-1", "token": "agent-token", "scopes": ["write"]},
+	{"name": "grafana", "token": "reader-token", "scopes": ["read"]},
+	{"name": "admin", "token": "admin-token", "scopes": ["read", "write"]}
+]`
+
+func writeTokens(t *testing.T, data string) string {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	require.NoError(t, os.WriteFile(path, []byte(data), 0600))
+	return path
+}
+
+func TestLoadFileStore(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{"ok", testTokens, false},
+		{"bad_json", `{`, true},
+		{"no_token", `[{"name": "a", "scopes": ["read"]}]`, true},
+		{"unknown_scope", `[{"name": "a", "token": "t", "scopes": ["admin"]}]`, true},
+		{"duplicate", `[{"name": "a", "token": "t"}, {"name": "b", "token": "t"}]`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadFileStore(writeTokens(t, tt.data))
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	store, err := LoadFileStore(writeTokens(t, testTokens))
+	require.NoError(t, err)
+	Initialize(store)
+	defer func() { MetricsTokens = nil }()
+
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		header   string
+		wantCode int
+	}{
+		{"ping_without_token", http.MethodGet, "/ping", "", http.StatusOK},
+		{"update_without_token", http.MethodPost, "/updates/", "", http.StatusUnauthorized},
+		{"update_basic_auth", http.MethodPost, "/updates/", "Basic YTpi", http.StatusUnauthorized},
+		{"update_unknown_token", http.MethodPost, "/updates/", "Bearer other", http.StatusUnauthorized},
+		{"update_write_token", http.MethodPost, "/updates/", "Bearer agent-token", http.StatusOK},
+		{"update_read_token", http.MethodPost, "/update/gauge/Alloc/1", "Bearer reader-token", http.StatusForbidden},
+		{"value_read_token", http.MethodPost, "/value/", "Bearer reader-token", http.StatusOK},
+		{"value_write_token", http.MethodGet, "/value/gauge/Alloc", "Bearer agent-token", http.StatusForbidden},
+		{"list_admin_token", http.MethodGet, "/", "bearer admin-token", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.wantCode == http.StatusUnauthorized {
+				assert.Equal(t, "Bearer", w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
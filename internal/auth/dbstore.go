@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	createTokensSQL = `
+        CREATE TABLE IF NOT EXISTS api_tokens (
+            token_hash varchar(64) PRIMARY KEY,
+			name varchar(128) NOT NULL,
+			scopes varchar(128) NOT NULL DEFAULT ''
+        )
+    `
+	addTenantSQL   = "ALTER TABLE api_tokens ADD COLUMN IF NOT EXISTS tenant varchar(64) NOT NULL DEFAULT ''"
+	selectTokenSQL = "SELECT name, scopes, tenant FROM api_tokens WHERE token_hash = $1"
+
+	lookupTimeout = time.Second
+)
+
+// DBStore - токены в таблице api_tokens, хранятся sha256 хэши, scopes через запятую.
+// Токены читаются на каждый запрос, поэтому выдача и отзыв работают без рестарта
+type DBStore struct {
+	conn *sql.DB
+}
+
+func NewDBStore(dns string) (*DBStore, error) {
+	conn, err := sql.Open("pgx", dns)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create connection db: %w", err)
+	}
+
+	if _, err := conn.ExecContext(context.Background(), createTokensSQL); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("cannot create tokens table: %w", err)
+	}
+	if _, err := conn.ExecContext(context.Background(), addTenantSQL); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("cannot add tenant to tokens table: %w", err)
+	}
+
+	return &DBStore{conn: conn}, nil
+}
+
+func (m *DBStore) Lookup(ctx context.Context, token string) (*Identity, error) {
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+
+	var name, scopes, tenant string
+	err := m.conn.QueryRowContext(ctx, selectTokenSQL, hashToken(token)).Scan(&name, &scopes, &tenant)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUnknownToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot select token: %w", err)
+	}
+
+	return &Identity{Name: name, Scopes: parseScopes(scopes), Tenant: tenant}, nil
+}
+
+func (m *DBStore) Close() {
+	m.conn.Close()
+}
@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// fileToken - запись файла токенов
+type fileToken struct {
+	Name   string   `json:"name"`
+	Token  string   `json:"token"`
+	Scopes []string `json:"scopes"`
+	Tenant string   `json:"tenant,omitempty"`
+}
+
+// FileStore - токены из JSON файла, загружаются при старте
+type FileStore struct {
+	tokens map[string]*Identity //по хэшу токена
+}
+
+// LoadFileStore читает файл токенов - JSON массив {"name", "token", "scopes", "tenant"}
+func LoadFileStore(path string) (*FileStore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read tokens file: %w", err)
+	}
+
+	var entries []fileToken
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("cannot parse tokens file: %w", err)
+	}
+
+	tokens := make(map[string]*Identity, len(entries))
+	for i, entry := range entries {
+		if entry.Name == "" || entry.Token == "" {
+			return nil, fmt.Errorf("token #%d: name and token are required", i+1)
+		}
+		for _, scope := range entry.Scopes {
+			if !validScope(scope) {
+				return nil, fmt.Errorf("token %s: unknown scope %s", entry.Name, scope)
+			}
+		}
+
+		hash := hashToken(entry.Token)
+		if _, ok := tokens[hash]; ok {
+			return nil, fmt.Errorf("token %s: duplicate token", entry.Name)
+		}
+		tokens[hash] = &Identity{Name: entry.Name, Scopes: entry.Scopes, Tenant: entry.Tenant}
+	}
+
+	return &FileStore{tokens: tokens}, nil
+}
+
+func (m *FileStore) Lookup(ctx context.Context, token string) (*Identity, error) {
+	identity, ok := m.tokens[hashToken(token)]
+	if !ok {
+		return nil, ErrUnknownToken
+	}
+
+	return identity, nil
+}
+
+func (m *FileStore) Close() {}
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/AntonPashechko/yametrix/internal/logger"
+)
+
+// requiredScope - какая область доступа нужна запросу, пусто - доступен без токена
+func requiredScope(r *http.Request) string {
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/ping"):
+		return ""
+	case strings.HasPrefix(r.URL.Path, "/update"):
+		return ScopeWrite
+	default:
+		//POST /value/ тоже чтение
+		return ScopeRead
+	}
+}
+
+// bearerToken достает токен из заголовка Authorization: Bearer <token>
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// Authorize проверяет токен и область доступа, возвращает HTTP код ошибки
+func Authorize(ctx context.Context, token string, scope string) (*Identity, int, error) {
+	identity, err := MetricsTokens.Lookup(ctx, token)
+	if errors.Is(err, ErrUnknownToken) {
+		return nil, http.StatusUnauthorized, err
+	}
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	if !identity.HasScope(scope) {
+		return identity, http.StatusForbidden, fmt.Errorf("%s has no %s scope", identity.Name, scope)
+	}
+
+	return identity, http.StatusOK, nil
+}
+
+// Middleware пускает запросы только с токеном нужной области доступа
+func Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scope := requiredScope(r)
+		if scope == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := bearerToken(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		identity, code, err := Authorize(r.Context(), token, scope)
+		if identity != nil {
+			logger.SetIdentity(r.Context(), identity.Name)
+		}
+		if err != nil {
+			logger.Error(fmt.Sprintf("request %s %s is not authorized: %s", r.Method, r.URL.Path, err))
+			if code == http.StatusUnauthorized {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+			}
+			w.WriteHeader(code)
+			return
+		}
+
+		//Вызов целевого handler
+		h.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), identity)))
+	})
+}
@@ -0,0 +1,113 @@
+package configfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Value - скалярное значение из файла. Числа и bool храним текстом, как будто они пришли из env,
+// тогда разбор и проверка у файла, env и флагов общие
+type Value string
+
+func (m *Value) UnmarshalJSON(data []byte) error {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case string:
+		*m = Value(v)
+	case float64, bool:
+		//Число берем как есть, без перевода в float64 и обратно
+		*m = Value(data)
+	default:
+		return fmt.Errorf("expected string, number or bool, got %s", data)
+	}
+
+	return nil
+}
+
+func (m *Value) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.ScalarNode {
+		return fmt.Errorf("line %d: expected string, number or bool", node.Line)
+	}
+
+	*m = Value(node.Value)
+	return nil
+}
+
+// Load читает файл конфигурации в v, формат выбирается по расширению: .json, .yaml или .yml.
+// Неизвестные ключи - ошибка, что бы опечатка не проходила молча
+func Load(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(v)
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(v)
+	default:
+		return fmt.Errorf("unsupported config file format %s, expected .json, .yaml or .yml", path)
+	}
+
+	if err != nil {
+		return fmt.Errorf("cannot parse config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// SetFlag выставляет значение из файла флагу, если ключ задан в файле.
+// Флаг сам проверяет значение, например int64
+func SetFlag(key string, name string, value *Value) error {
+	if value == nil {
+		return nil
+	}
+
+	if err := flag.Set(name, string(*value)); err != nil {
+		return fmt.Errorf("bad option %s %q: %w", key, string(*value), err)
+	}
+
+	return nil
+}
+
+// List склеивает список из файла в строку, как его задают во флаге
+func List(values []string, sep string) *Value {
+	if values == nil {
+		return nil
+	}
+
+	value := Value(strings.Join(values, sep))
+	return &value
+}
+
+// Map склеивает словарь из файла в строку вида a=1,b=2, как его задают во флаге
+func Map[V any](values map[string]V) *Value {
+	if values == nil {
+		return nil
+	}
+
+	items := make([]string, 0, len(values))
+	for key, val := range values {
+		items = append(items, fmt.Sprintf("%s=%v", key, val))
+	}
+	sort.Strings(items)
+
+	return List(items, ",")
+}
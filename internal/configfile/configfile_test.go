@@ -0,0 +1,89 @@
+package configfile
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testOptions struct {
+	Address   *Value           `json:"address" yaml:"address"`
+	Interval  *Value           `json:"interval" yaml:"interval"`
+	Restore   *Value           `json:"restore" yaml:"restore"`
+	Targets   []string         `json:"targets" yaml:"targets"`
+	Intervals map[string]Value `json:"intervals" yaml:"intervals"`
+}
+
+func writeConfig(t *testing.T, name string, data string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(data), 0600))
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		data    string
+		wantErr bool
+	}{
+		{"json", "config.json", `{"address": "localhost:8080", "interval": 10, "restore": true,
+			"targets": ["a", "b"], "intervals": {"disk": "30s", "cpu": 5}}`, false},
+		{"yaml", "config.yaml", "address: localhost:8080\ninterval: 10\nrestore: true\n" +
+			"targets: [a, b]\nintervals:\n  disk: 30s\n  cpu: 5\n", false},
+		{"yml", "config.yml", "address: localhost:8080\n", false},
+		{"unknown_json_key", "config.json", `{"adress": "localhost:8080"}`, true},
+		{"unknown_yaml_key", "config.yaml", "adress: localhost:8080\n", true},
+		{"not_scalar_json", "config.json", `{"address": ["localhost:8080"]}`, true},
+		{"not_scalar_yaml", "config.yaml", "address:\n  host: localhost\n", true},
+		{"bad_json", "config.json", `{`, true},
+		{"unsupported", "config.toml", `address = "localhost:8080"`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opt testOptions
+			err := Load(writeConfig(t, tt.file, tt.data), &opt)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, Value("localhost:8080"), *opt.Address)
+			if tt.name == "yml" {
+				return
+			}
+			assert.Equal(t, Value("10"), *opt.Interval)
+			assert.Equal(t, Value("true"), *opt.Restore)
+			assert.Equal(t, Value("a,b"), *List(opt.Targets, ","))
+			assert.Equal(t, Value("cpu=5,disk=30s"), *Map(opt.Intervals))
+		})
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	var opt testOptions
+	assert.Error(t, Load(filepath.Join(t.TempDir(), "config.json"), &opt))
+}
+
+func TestSetFlag(t *testing.T) {
+	limit := flag.Int64("configfile-test-limit", 1, "")
+
+	value := Value("10")
+	require.NoError(t, SetFlag("limit", "configfile-test-limit", &value))
+	assert.Equal(t, int64(10), *limit)
+
+	//Не заданный в файле ключ флаг не меняет
+	require.NoError(t, SetFlag("limit", "configfile-test-limit", nil))
+	assert.Equal(t, int64(10), *limit)
+
+	value = Value("ten")
+	assert.ErrorContains(t, SetFlag("limit", "configfile-test-limit", &value), "bad option limit")
+
+	assert.Nil(t, List(nil, ","))
+	assert.Nil(t, Map[int](nil))
+}
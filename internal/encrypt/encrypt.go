@@ -0,0 +1,130 @@
+package encrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+)
+
+// Header - заголовок зашифрованного запроса, значение - схема шифрования
+const (
+	Header = "Encryption"
+	Scheme = "rsa-oaep-aes256-gcm"
+)
+
+const aesKeySize = 32
+
+// Шифрование гибридное: тело шифруется случайным ключом AES-256-GCM,
+// а сам ключ - открытым ключом RSA-OAEP сервера.
+// Формат: [длина зашифрованного ключа, 2 байта][зашифрованный ключ][nonce][шифротекст]
+
+var (
+	MetricsEncryptor *Encryptor
+	MetricsDecryptor *Decryptor
+)
+
+type Encryptor struct {
+	key *rsa.PublicKey
+}
+
+type Decryptor struct {
+	key *rsa.PrivateKey
+}
+
+// InitializeEncryptor загружает открытый ключ сервера для агента
+func InitializeEncryptor(path string) error {
+	key, err := LoadPublicKey(path)
+	if err != nil {
+		return fmt.Errorf("cannot load public key: %w", err)
+	}
+
+	MetricsEncryptor = &Encryptor{key: key}
+	return nil
+}
+
+// InitializeDecryptor загружает закрытый ключ для сервера
+func InitializeDecryptor(path string) error {
+	key, err := LoadPrivateKey(path)
+	if err != nil {
+		return fmt.Errorf("cannot load private key: %w", err)
+	}
+
+	MetricsDecryptor = &Decryptor{key: key}
+	return nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create cipher: %w", err)
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func (m *Encryptor) Encrypt(data []byte) ([]byte, error) {
+	aesKey := make([]byte, aesKeySize)
+	if _, err := rand.Read(aesKey); err != nil {
+		return nil, fmt.Errorf("cannot generate key: %w", err)
+	}
+
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, m.key, aesKey, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encrypt key: %w", err)
+	}
+
+	gcm, err := newGCM(aesKey)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("cannot generate nonce: %w", err)
+	}
+
+	res := make([]byte, 2, 2+len(encryptedKey)+len(nonce)+len(data)+gcm.Overhead())
+	binary.BigEndian.PutUint16(res, uint16(len(encryptedKey)))
+	res = append(res, encryptedKey...)
+	res = append(res, nonce...)
+
+	return gcm.Seal(res, nonce, data, nil), nil
+}
+
+func (m *Decryptor) Decrypt(data []byte) ([]byte, error) {
+	if len(data) < 2 {
+		return nil, fmt.Errorf("encrypted data is too short")
+	}
+
+	keyLen := int(binary.BigEndian.Uint16(data))
+	data = data[2:]
+	if len(data) < keyLen {
+		return nil, fmt.Errorf("encrypted data is too short")
+	}
+
+	aesKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, m.key, data[:keyLen], nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt key: %w", err)
+	}
+	data = data[keyLen:]
+
+	gcm, err := newGCM(aesKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("encrypted data is too short")
+	}
+
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt data: %w", err)
+	}
+
+	return plain, nil
+}
@@ -0,0 +1,123 @@
+package encrypt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeKeys создает пару ключей и пишет их в PEM файлы
+func writeKeys(t *testing.T) (string, string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	privatePath := filepath.Join(dir, "private.pem")
+	publicPath := filepath.Join(dir, "public.pem")
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}), 0600))
+
+	publicDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), 0644))
+
+	return publicPath, privatePath
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	publicPath, privatePath := writeKeys(t)
+	require.NoError(t, InitializeEncryptor(publicPath))
+	require.NoError(t, InitializeDecryptor(privatePath))
+
+	data := []byte(`[{"id":"Alloc","type":"gauge","value":1.5}]`)
+
+	encrypted, err := MetricsEncryptor.Encrypt(data)
+	require.NoError(t, err)
+	assert.NotContains(t, string(encrypted), "Alloc")
+
+	plain, err := MetricsDecryptor.Decrypt(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, data, plain)
+
+	//Испорченный шифротекст не расшифровывается
+	encrypted[len(encrypted)-1] ^= 0xff
+	_, err = MetricsDecryptor.Decrypt(encrypted)
+	assert.Error(t, err)
+
+	_, err = MetricsDecryptor.Decrypt([]byte{1})
+	assert.Error(t, err)
+}
+
+func TestLoadKeyErrors(t *testing.T) {
+	publicPath, privatePath := writeKeys(t)
+
+	//Перепутанные ключи
+	_, err := LoadPublicKey(privatePath)
+	assert.Error(t, err)
+	_, err = LoadPrivateKey(publicPath)
+	assert.Error(t, err)
+
+	_, err = LoadPublicKey(filepath.Join(t.TempDir(), "missing.pem"))
+	assert.Error(t, err)
+
+	notPEM := filepath.Join(t.TempDir(), "key.pem")
+	require.NoError(t, os.WriteFile(notPEM, []byte("not a key"), 0600))
+	assert.Error(t, InitializeDecryptor(notPEM))
+}
+
+func TestMiddleware(t *testing.T) {
+	publicPath, privatePath := writeKeys(t)
+	require.NoError(t, InitializeEncryptor(publicPath))
+	require.NoError(t, InitializeDecryptor(privatePath))
+
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write(body)
+	}))
+
+	encrypted, err := MetricsEncryptor.Encrypt([]byte("payload"))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		path     string
+		scheme   string
+		body     []byte
+		wantCode int
+		wantBody string
+	}{
+		{"encrypted", "/updates/", Scheme, encrypted, http.StatusOK, "payload"},
+		{"plain_update", "/updates/", "", []byte("plain"), http.StatusBadRequest, ""},
+		{"plain_update_url", "/update/gauge/Alloc/1", "", nil, http.StatusBadRequest, ""},
+		{"plain_value", "/value/", "", []byte("plain"), http.StatusOK, "plain"},
+		{"unknown_scheme", "/updates/", "rot13", encrypted, http.StatusBadRequest, ""},
+		{"broken", "/updates/", Scheme, []byte("garbage"), http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, tt.path, bytes.NewReader(tt.body))
+			if tt.scheme != "" {
+				r.Header.Set(Header, tt.scheme)
+			}
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.wantBody, w.Body.String())
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package encrypt
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/AntonPashechko/yametrix/internal/logger"
+)
+
+// Middleware расшифровывает тело запроса, если агент его зашифровал. Обновления метрик
+// (/update, /updates) без шифрования не принимаются - иначе закрытый ключ ничего не защищает.
+// Это касается и /update/{type}/{name}/{value}: тела у него нет, шифровать нечего, поэтому с ключом он недоступен.
+// Должен стоять до compress.Middleware - агент шифрует уже сжатое тело
+func Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scheme := r.Header.Get(Header)
+		if scheme == `` {
+			if strings.HasPrefix(r.URL.Path, "/update") {
+				logger.Error(fmt.Sprintf("request %s %s is not encrypted", r.Method, r.URL.Path))
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		if scheme != Scheme {
+			logger.Error(fmt.Sprintf("unknown encryption scheme: %s", scheme))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		buf, err := io.ReadAll(r.Body)
+		if err != nil {
+			logger.Error(fmt.Sprintf("cannot read request body: %s", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		plain, err := MetricsDecryptor.Decrypt(buf)
+		if err != nil {
+			logger.Error(fmt.Sprintf("cannot decrypt request body: %s", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(plain))
+		r.ContentLength = int64(len(plain))
+		r.Header.Del(Header)
+
+		//Вызов целевого handler
+		h.ServeHTTP(w, r)
+	})
+}
@@ -4,19 +4,22 @@ import (
 	"fmt"
 
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 // Тут мне не нравится инициализация синглтона, я бы использовал once.Do, если бы писал сам, но это я стырил с лекции и не стал переделывать
 var log *zap.Logger = zap.NewNop()
 
-func Initialize(level string) error {
-	lvl, err := zap.ParseAtomicLevel(level)
-	if err != nil {
-		return fmt.Errorf("cannot parse log level: %w", err)
+// Уровень общий для всех построенных логеров, меняется на лету через SetLevel
+var level = zap.NewAtomicLevel()
+
+func Initialize(lvl string) error {
+	if err := SetLevel(lvl); err != nil {
+		return err
 	}
 
 	cfg := zap.NewProductionConfig()
-	cfg.Level = lvl
+	cfg.Level = level
 	zl, err := cfg.Build()
 	if err != nil {
 		return fmt.Errorf("cannot build log: %w", err)
@@ -26,6 +29,17 @@ func Initialize(level string) error {
 	return nil
 }
 
+// SetLevel меняет уровень логирования без пересоздания логера
+func SetLevel(lvl string) error {
+	parsed, err := zapcore.ParseLevel(lvl)
+	if err != nil {
+		return fmt.Errorf("cannot parse log level: %w", err)
+	}
+
+	level.SetLevel(parsed)
+	return nil
+}
+
 func Info(msg string, opt ...any) {
 	log.Info(fmt.Sprintf(msg, opt...))
 }
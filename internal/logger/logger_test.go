@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
 )
 
 func TestInitialize(t *testing.T) {
@@ -87,3 +88,17 @@ func TestError(t *testing.T) {
 		})
 	}
 }
+
+func TestSetLevel(t *testing.T) {
+	defer SetLevel("info")
+
+	assert.NoError(t, SetLevel("error"))
+	assert.False(t, level.Enabled(zapcore.InfoLevel))
+	assert.True(t, level.Enabled(zapcore.ErrorLevel))
+
+	assert.NoError(t, SetLevel("debug"))
+	assert.True(t, level.Enabled(zapcore.DebugLevel))
+
+	assert.Error(t, SetLevel("verbose"))
+	assert.True(t, level.Enabled(zapcore.DebugLevel))
+}
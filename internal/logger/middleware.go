@@ -1,6 +1,7 @@
 package logger
 
 import (
+	"context"
 	"net/http"
 	"time"
 
@@ -19,8 +20,22 @@ type (
 		http.ResponseWriter // встраиваем оригинальный http.ResponseWriter
 		responseData        *responseData
 	}
+
+	// Данные, которые заполняют middleware внутри, например кто сделал запрос
+	requestData struct {
+		identity string
+	}
+
+	requestDataKey struct{}
 )
 
+// SetIdentity запоминает, кто сделал запрос, попадет в лог запроса
+func SetIdentity(ctx context.Context, identity string) {
+	if data, ok := ctx.Value(requestDataKey{}).(*requestData); ok {
+		data.identity = identity
+	}
+}
+
 /*Реализовываем интерфейс*/
 func (m *loggingResponseWriter) Write(b []byte) (int, error) {
 	// записываем ответ, используя оригинальный http.ResponseWriter
@@ -49,6 +64,9 @@ func Middleware(h http.Handler) http.Handler {
 			responseData:   responseData,
 		}
 
+		requestData := &requestData{}
+		r = r.WithContext(context.WithValue(r.Context(), requestDataKey{}, requestData))
+
 		//Вызов целевого handler
 		h.ServeHTTP(&lw, r)
 
@@ -61,6 +79,7 @@ func Middleware(h http.Handler) http.Handler {
 			zap.Duration("duration", duration),
 			zap.Int("status", responseData.status),
 			zap.Int("size", responseData.size),
+			zap.String("identity", requestData.identity),
 		)
 	})
 }
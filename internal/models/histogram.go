@@ -0,0 +1,108 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// ErrHistogramBounds - границы корзин гистограмм не совпадают, слить их нельзя
+var ErrHistogramBounds = errors.New("histogram bounds mismatch")
+
+// Histogram - распределение значений по корзинам
+type Histogram struct {
+	Bounds []float64 `json:"bounds"` // верхние границы корзин по возрастанию, корзина +Inf подразумевается
+	Counts []uint64  `json:"counts"` // количество значений в каждой корзине, последняя - +Inf
+	Sum    float64   `json:"sum"`    // сумма всех значений
+	Count  uint64    `json:"count"`  // количество значений
+}
+
+func NewHistogram(bounds []float64) *Histogram {
+	sorted := make([]float64, len(bounds))
+	copy(sorted, bounds)
+	sort.Float64s(sorted)
+
+	return &Histogram{
+		Bounds: sorted,
+		Counts: make([]uint64, len(sorted)+1),
+	}
+}
+
+func NewHistogramMetric(id string, histogram *Histogram) MetricDTO {
+	return MetricDTO{
+		ID:        id,
+		MType:     HistogramType,
+		Histogram: histogram,
+	}
+}
+
+// Observe учитывает значение в гистограмме
+func (m *Histogram) Observe(value float64) {
+	i := sort.SearchFloat64s(m.Bounds, value)
+	m.Counts[i]++
+	m.Sum += value
+	m.Count++
+}
+
+// Validate проверяет согласованность гистограммы
+func (m *Histogram) Validate() error {
+	if len(m.Counts) != len(m.Bounds)+1 {
+		return fmt.Errorf("histogram must have %d counts for %d bounds, got %d", len(m.Bounds)+1, len(m.Bounds), len(m.Counts))
+	}
+
+	for i, bound := range m.Bounds {
+		if math.IsNaN(bound) || math.IsInf(bound, 0) {
+			return fmt.Errorf("bad histogram bound %v", bound)
+		}
+		if i > 0 && bound <= m.Bounds[i-1] {
+			return fmt.Errorf("histogram bounds must be strictly increasing")
+		}
+	}
+
+	var count uint64
+	for _, c := range m.Counts {
+		count += c
+	}
+	if count != m.Count {
+		return fmt.Errorf("histogram count %d does not match sum of buckets %d", m.Count, count)
+	}
+
+	return nil
+}
+
+// Merge добавляет к гистограмме значения другой гистограммы с теми же границами
+func (m *Histogram) Merge(other *Histogram) error {
+	if len(m.Bounds) != len(other.Bounds) || len(m.Counts) != len(other.Counts) {
+		return ErrHistogramBounds
+	}
+
+	for i := range m.Bounds {
+		if m.Bounds[i] != other.Bounds[i] {
+			return ErrHistogramBounds
+		}
+	}
+
+	for i := range m.Counts {
+		m.Counts[i] += other.Counts[i]
+	}
+	m.Sum += other.Sum
+	m.Count += other.Count
+
+	return nil
+}
+
+// Copy возвращает независимую копию гистограммы
+func (m *Histogram) Copy() *Histogram {
+	res := &Histogram{
+		Bounds: make([]float64, len(m.Bounds)),
+		Counts: make([]uint64, len(m.Counts)),
+		Sum:    m.Sum,
+		Count:  m.Count,
+	}
+
+	copy(res.Bounds, m.Bounds)
+	copy(res.Counts, m.Counts)
+
+	return res
+}
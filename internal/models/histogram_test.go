@@ -0,0 +1,82 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogram_Observe(t *testing.T) {
+	histogram := NewHistogram([]float64{1, 0.1})
+	for _, value := range []float64{0.05, 0.1, 0.5, 5} {
+		histogram.Observe(value)
+	}
+
+	assert.Equal(t, []float64{0.1, 1}, histogram.Bounds)
+	assert.Equal(t, []uint64{2, 1, 1}, histogram.Counts)
+	assert.Equal(t, uint64(4), histogram.Count)
+	assert.InDelta(t, 5.65, histogram.Sum, 1e-9)
+	assert.NoError(t, histogram.Validate())
+}
+
+func TestHistogram_Merge(t *testing.T) {
+	tests := []struct {
+		name    string
+		other   *Histogram
+		want    []uint64
+		wantErr bool
+	}{
+		{
+			name:  "same bounds",
+			other: &Histogram{Bounds: []float64{0.1, 1}, Counts: []uint64{1, 2, 3}, Sum: 10, Count: 6},
+			want:  []uint64{2, 3, 4},
+		},
+		{
+			name:    "other bounds",
+			other:   &Histogram{Bounds: []float64{0.2, 1}, Counts: []uint64{1, 2, 3}, Sum: 10, Count: 6},
+			wantErr: true,
+		},
+		{
+			name:    "other bounds count",
+			other:   &Histogram{Bounds: []float64{1}, Counts: []uint64{1, 2}, Sum: 10, Count: 3},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			histogram := &Histogram{Bounds: []float64{0.1, 1}, Counts: []uint64{1, 1, 1}, Sum: 1, Count: 3}
+
+			err := histogram.Merge(tt.other)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrHistogramBounds)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, histogram.Counts)
+			assert.Equal(t, uint64(9), histogram.Count)
+		})
+	}
+}
+
+func TestHistogram_Validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		histogram Histogram
+		wantErr   bool
+	}{
+		{"valid", Histogram{Bounds: []float64{1}, Counts: []uint64{1, 1}, Count: 2}, false},
+		{"counts length", Histogram{Bounds: []float64{1}, Counts: []uint64{1}, Count: 1}, true},
+		{"unsorted bounds", Histogram{Bounds: []float64{2, 1}, Counts: []uint64{0, 0, 0}}, true},
+		{"bad count", Histogram{Bounds: []float64{1}, Counts: []uint64{1, 1}, Count: 3}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantErr {
+				assert.Error(t, tt.histogram.Validate())
+			} else {
+				assert.NoError(t, tt.histogram.Validate())
+			}
+		})
+	}
+}
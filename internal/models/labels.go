@@ -0,0 +1,148 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+var labelNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Экранирование значений меток, как в текстовом формате Prometheus
+var (
+	labelEscaper   = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	labelUnescaper = strings.NewReplacer(`\\`, `\`, `\"`, `"`, `\n`, "\n")
+)
+
+// hasControl - есть ли в строке управляющие символы
+func hasControl(str string) bool {
+	return strings.IndexFunc(str, unicode.IsControl) >= 0
+}
+
+// ValidateID проверяет имя метрики: управляющие символы в нем запрещены,
+// фигурные скобки тоже - с них начинаются метки в идентификаторе ряда (см. SplitSeriesKey)
+func ValidateID(id string) error {
+	if hasControl(id) {
+		return fmt.Errorf("bad metric id %q: control characters are not allowed", id)
+	}
+
+	if strings.ContainsAny(id, "{}") {
+		return fmt.Errorf("bad metric id %q: braces are not allowed", id)
+	}
+
+	return nil
+}
+
+// ValidateLabels проверяет имена меток и значения: управляющие символы в значениях запрещены
+func ValidateLabels(labels map[string]string) error {
+	for name, value := range labels {
+		if !labelNameRegexp.MatchString(name) {
+			return fmt.Errorf("bad label name %q", name)
+		}
+		if hasControl(value) {
+			return fmt.Errorf("bad label %s value %q: control characters are not allowed", name, value)
+		}
+	}
+
+	return nil
+}
+
+// EscapeLabelValue экранирует значение метки
+func EscapeLabelValue(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+// LabelsString возвращает каноническое представление меток {a="x",b="y"}, для пустого набора - пустую строку
+func LabelsString(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, name, EscapeLabelValue(labels[name])))
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// ParseLabels разбирает каноническое представление меток, обратная к LabelsString
+func ParseLabels(str string) (map[string]string, error) {
+	if str == "" {
+		return nil, nil
+	}
+
+	if !strings.HasPrefix(str, "{") || !strings.HasSuffix(str, "}") {
+		return nil, fmt.Errorf("bad labels %s", str)
+	}
+
+	labels := make(map[string]string)
+	rest := str[1 : len(str)-1]
+
+	for rest != "" {
+		eq := strings.Index(rest, `="`)
+		if eq <= 0 {
+			return nil, fmt.Errorf("bad labels %s", str)
+		}
+		name := rest[:eq]
+		rest = rest[eq+2:]
+
+		//Ищем закрывающую кавычку, пропуская экранированные символы
+		end := -1
+		for i := 0; i < len(rest); i++ {
+			if rest[i] == '\\' {
+				i++
+				continue
+			}
+			if rest[i] == '"' {
+				end = i
+				break
+			}
+		}
+		if end < 0 {
+			return nil, fmt.Errorf("bad labels %s", str)
+		}
+
+		labels[name] = labelUnescaper.Replace(rest[:end])
+		rest = strings.TrimPrefix(rest[end+1:], ",")
+	}
+
+	if err := ValidateLabels(labels); err != nil {
+		return nil, err
+	}
+
+	return labels, nil
+}
+
+// SeriesKey - идентификатор временного ряда: имя метрики и ее метки
+func SeriesKey(id string, labels map[string]string) string {
+	return id + LabelsString(labels)
+}
+
+// SplitSeriesKey разделяет идентификатор ряда на имя метрики и каноническое представление меток
+func SplitSeriesKey(key string) (string, string) {
+	if i := strings.Index(key, "{"); i >= 0 {
+		return key[:i], key[i:]
+	}
+
+	return key, ""
+}
+
+// MatchLabels проверяет, что метки содержат все пары фильтра
+func MatchLabels(labels map[string]string, filter map[string]string) bool {
+	for name, value := range filter {
+		if v, ok := labels[name]; !ok || v != value {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLabelsString(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   string
+	}{
+		{"empty", nil, ""},
+		{"sorted", map[string]string{"service": "api", "host": "a"}, `{host="a",service="api"}`},
+		{"escaped", map[string]string{"path": `c:\tmp "x"`}, `{path="c:\\tmp \"x\""}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := LabelsString(tt.labels)
+			assert.Equal(t, tt.want, got)
+
+			//Разбор обратно дает исходные метки
+			parsed, err := ParseLabels(got)
+			assert.NoError(t, err)
+			if len(tt.labels) == 0 {
+				assert.Empty(t, parsed)
+			} else {
+				assert.Equal(t, tt.labels, parsed)
+			}
+		})
+	}
+}
+
+func TestParseLabels_bad(t *testing.T) {
+	for _, str := range []string{`host="a"`, `{host}`, `{host="a}`, `{1host="a"}`} {
+		t.Run(str, func(t *testing.T) {
+			_, err := ParseLabels(str)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestValidateControl(t *testing.T) {
+	assert.NoError(t, ValidateID("Alloc"))
+	assert.Error(t, ValidateID("team-a\x00Alloc"))
+	assert.Error(t, ValidateID("Alloc{host"))
+	assert.Error(t, ValidateID("Alloc}"))
+
+	assert.NoError(t, ValidateLabels(map[string]string{"host": "a b"}))
+	assert.Error(t, ValidateLabels(map[string]string{"host": "a\nb"}))
+}
+
+func TestSplitSeriesKey(t *testing.T) {
+	id, labels := SplitSeriesKey(SeriesKey("Alloc", map[string]string{"host": "a"}))
+	assert.Equal(t, "Alloc", id)
+	assert.Equal(t, `{host="a"}`, labels)
+
+	id, labels = SplitSeriesKey("Alloc")
+	assert.Equal(t, "Alloc", id)
+	assert.Equal(t, "", labels)
+}
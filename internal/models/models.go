@@ -2,20 +2,107 @@ package models
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"time"
 )
 
 const (
-	GaugeType   = "gauge"
-	CounterType = "counter"
+	GaugeType     = "gauge"
+	CounterType   = "counter"
+	HistogramType = "histogram"
+	SummaryType   = "summary"
 )
 
+// ErrUnknownType - тип метрики не поддерживается
+var ErrUnknownType = errors.New("unknown metric type")
+
 type MetricDTO struct {
-	ID    string   `json:"id"`              // имя метрики
-	MType string   `json:"type"`            // параметр, принимающий значение gauge или counter
-	Delta *int64   `json:"delta,omitempty"` // значение метрики в случае передачи counter
-	Value *float64 `json:"value,omitempty"` // значение метрики в случае передачи gauge
+	ID     string            `json:"id"`               // имя метрики
+	MType  string            `json:"type"`             // параметр, принимающий значение gauge, counter, histogram или summary
+	Delta  *int64            `json:"delta,omitempty"`  // значение метрики в случае передачи counter
+	Value  *float64          `json:"value,omitempty"`  // значение метрики в случае передачи gauge
+	Labels map[string]string `json:"labels,omitempty"` // метки, входят в идентификатор ряда
+
+	Histogram *Histogram `json:"histogram,omitempty"` // значение метрики в случае передачи histogram
+
+	Observations []float64 `json:"observations,omitempty"` // наблюдения в случае передачи summary
+	Summary      *Summary  `json:"summary,omitempty"`      // значение summary в ответе
+	Quantile     *float64  `json:"quantile,omitempty"`     // запрошенный квантиль summary, его значение отдается в value
+}
+
+// SeriesKey - идентификатор ряда метрики с учетом меток
+func (m MetricDTO) SeriesKey() string {
+	return SeriesKey(m.ID, m.Labels)
+}
+
+// MetricPoint - значение метрики, зафиксированное в момент времени
+type MetricPoint struct {
+	Timestamp time.Time `json:"ts"`              // время фиксации значения
+	Delta     *int64    `json:"delta,omitempty"` // накопленное значение counter
+	Value     *float64  `json:"value,omitempty"` // значение gauge
+}
+
+// ValidateMetric проверяет пришедшую на сохранение метрику: имя, метки и значение ее типа.
+// Общая для HTTP и gRPC, хранилища рассчитывают, что значение есть
+func ValidateMetric(metric MetricDTO) error {
+	if metric.ID == "" {
+		return fmt.Errorf("metric id is empty")
+	}
+
+	if err := ValidateID(metric.ID); err != nil {
+		return err
+	}
+
+	if err := ValidateLabels(metric.Labels); err != nil {
+		return fmt.Errorf("bad labels: %w", err)
+	}
+
+	switch metric.MType {
+	case GaugeType:
+		if metric.Value == nil {
+			return fmt.Errorf("gauge value is nil")
+		}
+	case CounterType:
+		if metric.Delta == nil {
+			return fmt.Errorf("counter delta is nil")
+		}
+	case HistogramType:
+		if metric.Histogram == nil {
+			return fmt.Errorf("histogram is nil")
+		}
+		if err := metric.Histogram.Validate(); err != nil {
+			return fmt.Errorf("bad histogram: %w", err)
+		}
+	case SummaryType:
+		if len(metric.Observations) == 0 {
+			return fmt.Errorf("summary observations are empty")
+		}
+	default:
+		return fmt.Errorf("%w %s", ErrUnknownType, metric.MType)
+	}
+
+	return nil
+}
+
+func NewMetricPoint(metric MetricDTO, ts time.Time) MetricPoint {
+	point := MetricPoint{
+		Timestamp: ts,
+	}
+
+	//Копируем значения, что бы точка не менялась вместе с метрикой
+	if metric.Delta != nil {
+		delta := *metric.Delta
+		point.Delta = &delta
+	}
+
+	if metric.Value != nil {
+		value := *metric.Value
+		point.Value = &value
+	}
+
+	return point
 }
 
 func NewMetricFromJSON(r io.Reader) (MetricDTO, error) {
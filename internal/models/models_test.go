@@ -0,0 +1,37 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateMetric(t *testing.T) {
+	tests := []struct {
+		name    string
+		metric  MetricDTO
+		wantErr bool
+	}{
+		{"gauge", NewGaugeMetric("Alloc", 1), false},
+		{"counter", NewCounterMetric("PollCount", 1), false},
+		{"summary", NewSummaryMetric("latency", 0.5), false},
+		{"gauge_without_value", MetricDTO{ID: "Alloc", MType: GaugeType}, true},
+		{"counter_without_delta", MetricDTO{ID: "PollCount", MType: CounterType}, true},
+		{"histogram_without_value", MetricDTO{ID: "latency", MType: HistogramType}, true},
+		{"summary_without_observations", MetricDTO{ID: "latency", MType: SummaryType}, true},
+		{"empty_id", MetricDTO{MType: GaugeType, Value: new(float64)}, true},
+		{"bad_labels", MetricDTO{ID: "Alloc", MType: GaugeType, Value: new(float64), Labels: map[string]string{"1host": "a"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateMetric(tt.metric)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+
+	assert.ErrorIs(t, ValidateMetric(MetricDTO{ID: "Alloc", MType: "meter"}), ErrUnknownType)
+}
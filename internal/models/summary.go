@@ -0,0 +1,36 @@
+package models
+
+// Квантили, которые считаются для summary, если не запрошены другие
+var DefaultQuantiles = []float64{0.5, 0.9, 0.99}
+
+// Quantile - значение квантиля
+type Quantile struct {
+	Quantile float64 `json:"quantile"`
+	Value    float64 `json:"value"`
+}
+
+// Summary - квантили, сумма и количество наблюдений за скользящее окно
+type Summary struct {
+	Quantiles []Quantile `json:"quantiles,omitempty"` // пусто, если наблюдений в окне нет
+	Sum       float64    `json:"sum"`
+	Count     uint64     `json:"count"`
+}
+
+func NewSummaryMetric(id string, observations ...float64) MetricDTO {
+	return MetricDTO{
+		ID:           id,
+		MType:        SummaryType,
+		Observations: observations,
+	}
+}
+
+// QuantileValue ищет значение квантиля среди посчитанных
+func (m *Summary) QuantileValue(q float64) (float64, bool) {
+	for _, quantile := range m.Quantiles {
+		if quantile.Quantile == q {
+			return quantile.Value, true
+		}
+	}
+
+	return 0, false
+}
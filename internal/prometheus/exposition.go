@@ -0,0 +1,300 @@
+package prometheus
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/AntonPashechko/yametrix/internal/models"
+)
+
+// ContentType - тип содержимого текстового формата Prometheus
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// SanitizeName приводит имя метрики к виду [a-zA-Z_:][a-zA-Z0-9_:]*, недопустимые символы заменяются на _
+func SanitizeName(name string) string {
+	if name == "" {
+		return "_"
+	}
+
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == ':':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			//Имя не может начинаться с цифры
+			if i == 0 {
+				b.WriteRune('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+
+	return b.String()
+}
+
+// FormatFloat форматирует значение так, как его ожидает Prometheus
+func FormatFloat(f64 float64) string {
+	switch {
+	case math.IsNaN(f64):
+		return "NaN"
+	case math.IsInf(f64, 1):
+		return "+Inf"
+	case math.IsInf(f64, -1):
+		return "-Inf"
+	}
+
+	return strconv.FormatFloat(f64, 'g', -1, 64)
+}
+
+// formatLabels форматирует метки ряда, имена меток приводятся к допустимому виду
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	sanitized := make(map[string]string, len(labels))
+	for name, value := range labels {
+		sanitized[SanitizeName(name)] = value
+	}
+
+	return models.LabelsString(sanitized)
+}
+
+// withLabel возвращает копию меток с дополнительной меткой
+func withLabel(labels map[string]string, name string, value string) map[string]string {
+	res := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		res[k] = v
+	}
+	res[name] = value
+
+	return res
+}
+
+// writeHistogram пишет ряды _bucket с накопленными значениями, _sum и _count
+func writeHistogram(w io.Writer, name string, labels map[string]string, histogram *models.Histogram) {
+	var cumulative uint64
+	for i, count := range histogram.Counts {
+		cumulative += count
+
+		le := "+Inf"
+		if i < len(histogram.Bounds) {
+			le = FormatFloat(histogram.Bounds[i])
+		}
+
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, formatLabels(withLabel(labels, "le", le)), cumulative)
+	}
+
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, formatLabels(labels), FormatFloat(histogram.Sum))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, formatLabels(labels), histogram.Count)
+}
+
+// writeSummary пишет ряды квантилей, _sum и _count
+func writeSummary(w io.Writer, name string, labels map[string]string, summary *models.Summary) {
+	for _, quantile := range summary.Quantiles {
+		fmt.Fprintf(w, "%s%s %s\n", name, formatLabels(withLabel(labels, "quantile", FormatFloat(quantile.Quantile))), FormatFloat(quantile.Value))
+	}
+
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, formatLabels(labels), FormatFloat(summary.Sum))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, formatLabels(labels), summary.Count)
+}
+
+// typeOrder - порядок типов с одинаковым именем: имя остается за первым, остальные получают суффикс типа
+var typeOrder = map[string]int{
+	models.GaugeType:     0,
+	models.CounterType:   1,
+	models.HistogramType: 2,
+	models.SummaryType:   3,
+}
+
+// family - ряды одной метрики: одно имя после приведения и один тип
+type family struct {
+	name    string
+	mType   string
+	metrics []models.MetricDTO
+}
+
+// hasValue - есть ли у метрики значение ее типа
+func hasValue(metric models.MetricDTO) bool {
+	switch metric.MType {
+	case models.GaugeType:
+		return metric.Value != nil
+	case models.CounterType:
+		return metric.Delta != nil
+	case models.HistogramType:
+		return metric.Histogram != nil
+	case models.SummaryType:
+		return metric.Summary != nil
+	}
+
+	return false
+}
+
+// families группирует метрики по имени после приведения и типу, отсортированными по имени.
+// Prometheus не допускает одно имя у разных типов, поэтому такие метрики получают суффикс типа,
+// а метрики, чьи имена все равно совпали с чужими рядами, пропускаются
+func families(metrics []models.MetricDTO) []*family {
+	byKey := make(map[string]*family)
+	res := make([]*family, 0)
+	for _, metric := range metrics {
+		if !hasValue(metric) {
+			continue
+		}
+
+		name := SanitizeName(metric.ID)
+		key := name + " " + metric.MType
+		f, ok := byKey[key]
+		if !ok {
+			f = &family{name: name, mType: metric.MType}
+			byKey[key] = f
+			res = append(res, f)
+		}
+		f.metrics = append(f.metrics, metric)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].name != res[j].name {
+			return res[i].name < res[j].name
+		}
+		return typeOrder[res[i].mType] < typeOrder[res[j].mType]
+	})
+
+	//Сначала имена занимают первые по порядку типы, затем остальные пробуют имя с суффиксом типа.
+	//Имя, уже занятое другой метрикой или ее рядами _bucket, _sum, _count, дало бы неверный вывод - такую метрику пропускаем
+	renamed := make([]bool, len(res))
+	for i := 1; i < len(res); i++ {
+		renamed[i] = res[i].name == res[i-1].name
+	}
+
+	reserved := make(map[string]struct{}, len(res))
+	claimed := make([]bool, len(res))
+	for i, f := range res {
+		if !renamed[i] {
+			claimed[i] = claim(reserved, f.name, f.mType)
+		}
+	}
+	for i, f := range res {
+		if renamed[i] {
+			f.name += "_" + f.mType
+			claimed[i] = claim(reserved, f.name, f.mType)
+		}
+	}
+
+	filtered := make([]*family, 0, len(res))
+	for i, f := range res {
+		if claimed[i] {
+			filtered = append(filtered, f)
+		}
+	}
+
+	return filtered
+}
+
+// seriesNames возвращает имена рядов, которые пишет метрика этого типа
+func seriesNames(name string, mType string) []string {
+	switch mType {
+	case models.HistogramType:
+		return []string{name, name + "_bucket", name + "_sum", name + "_count"}
+	case models.SummaryType:
+		return []string{name, name + "_sum", name + "_count"}
+	}
+
+	return []string{name}
+}
+
+// claim занимает имена рядов метрики, если ни одно из них еще не занято
+func claim(reserved map[string]struct{}, name string, mType string) bool {
+	names := seriesNames(name, mType)
+	for _, n := range names {
+		if _, ok := reserved[n]; ok {
+			return false
+		}
+	}
+	for _, n := range names {
+		reserved[n] = struct{}{}
+	}
+
+	return true
+}
+
+// hasLabel - есть ли среди меток после приведения метка с этим именем
+func hasLabel(labels map[string]string, name string) bool {
+	for k := range labels {
+		if SanitizeName(k) == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// reservedLabel возвращает метку, которую формат добавляет к рядам метрики этого типа
+func reservedLabel(mType string) string {
+	switch mType {
+	case models.HistogramType:
+		return "le"
+	case models.SummaryType:
+		return "quantile"
+	}
+
+	return ""
+}
+
+// WriteText пишет метрики в текстовом формате Prometheus: по метрике на имя и тип,
+// строка # TYPE перед ее рядами, ряды отсортированы по меткам
+func WriteText(w io.Writer, metrics []models.MetricDTO) error {
+	bw := bufio.NewWriter(w)
+
+	for _, f := range families(metrics) {
+		//Ряды с одинаковыми после приведения метками Prometheus не примет, пишем первый
+		series := make(map[string]models.MetricDTO, len(f.metrics))
+		keys := make([]string, 0, len(f.metrics))
+		for _, metric := range f.metrics {
+			//Собственная метка le или quantile совпала бы с меткой корзины или квантиля
+			if label := reservedLabel(f.mType); label != "" && hasLabel(metric.Labels, label) {
+				continue
+			}
+
+			key := formatLabels(metric.Labels)
+			if _, ok := series[key]; ok {
+				continue
+			}
+			series[key] = metric
+			keys = append(keys, key)
+		}
+		if len(keys) == 0 {
+			continue
+		}
+		sort.Strings(keys)
+
+		fmt.Fprintf(bw, "# TYPE %s %s\n", f.name, f.mType)
+		for _, labels := range keys {
+			metric := series[labels]
+
+			switch metric.MType {
+			case models.GaugeType:
+				fmt.Fprintf(bw, "%s%s %s\n", f.name, labels, FormatFloat(*metric.Value))
+			case models.CounterType:
+				fmt.Fprintf(bw, "%s%s %d\n", f.name, labels, *metric.Delta)
+			case models.HistogramType:
+				writeHistogram(bw, f.name, metric.Labels, metric.Histogram)
+			case models.SummaryType:
+				writeSummary(bw, f.name, metric.Labels, metric.Summary)
+			}
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("cannot write metrics: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,155 @@
+package prometheus
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/AntonPashechko/yametrix/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitizeName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"HeapAlloc", "HeapAlloc"},
+		{"http.requests-total", "http_requests_total"},
+		{"1st", "_1st"},
+		{"ns:metric", "ns:metric"},
+		{"", "_"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, SanitizeName(tt.name))
+		})
+	}
+}
+
+func TestFormatFloat(t *testing.T) {
+	tests := []struct {
+		name string
+		f64  float64
+		want string
+	}{
+		{"simple", 9.99, "9.99"},
+		{"integer", 100, "100"},
+		{"nan", math.NaN(), "NaN"},
+		{"inf", math.Inf(1), "+Inf"},
+		{"minus inf", math.Inf(-1), "-Inf"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, FormatFloat(tt.f64))
+		})
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	hostA := models.NewGaugeMetric("Alloc", 2)
+	hostA.Labels = map[string]string{"host": "a", "service": `api "v2"`}
+	hostB := models.NewGaugeMetric("Alloc", 3)
+	hostB.Labels = map[string]string{"host": "b"}
+
+	metrics := []models.MetricDTO{
+		models.NewGaugeMetric("Heap.Alloc", 1.5),
+		models.NewCounterMetric("PollCount", 3),
+		hostB,
+		hostA,
+	}
+
+	buf := new(bytes.Buffer)
+	assert.NoError(t, WriteText(buf, metrics))
+	assert.Equal(t, "# TYPE Alloc gauge\n"+
+		"Alloc{host=\"a\",service=\"api \\\"v2\\\"\"} 2\n"+
+		"Alloc{host=\"b\"} 3\n"+
+		"# TYPE Heap_Alloc gauge\nHeap_Alloc 1.5\n"+
+		"# TYPE PollCount counter\nPollCount 3\n", buf.String())
+}
+
+func TestWriteText_families(t *testing.T) {
+	labeled := models.NewGaugeMetric("a.b", 2)
+	labeled.Labels = map[string]string{"host": "a"}
+
+	metrics := []models.MetricDTO{
+		models.NewGaugeMetric("a_b", 1),
+		models.NewCounterMetric("Requests", 5),
+		labeled,
+		models.NewGaugeMetric("Requests", 0.5),
+		models.NewGaugeMetric("a.b", 3),
+	}
+
+	buf := new(bytes.Buffer)
+	assert.NoError(t, WriteText(buf, metrics))
+	assert.Equal(t, "# TYPE Requests gauge\nRequests 0.5\n"+
+		"# TYPE Requests_counter counter\nRequests_counter 5\n"+
+		"# TYPE a_b gauge\n"+
+		"a_b 1\n"+
+		"a_b{host=\"a\"} 2\n", buf.String())
+}
+
+func TestWriteText_histogram(t *testing.T) {
+	histogram := models.NewHistogram([]float64{0.1, 1})
+	for _, value := range []float64{0.05, 0.5, 0.7, 5} {
+		histogram.Observe(value)
+	}
+
+	buf := new(bytes.Buffer)
+	assert.NoError(t, WriteText(buf, []models.MetricDTO{models.NewHistogramMetric("latency", histogram)}))
+	assert.Equal(t, "# TYPE latency histogram\n"+
+		"latency_bucket{le=\"0.1\"} 1\n"+
+		"latency_bucket{le=\"1\"} 3\n"+
+		"latency_bucket{le=\"+Inf\"} 4\n"+
+		"latency_sum 6.25\n"+
+		"latency_count 4\n", buf.String())
+}
+
+func TestWriteText_nameCollisions(t *testing.T) {
+	histogram := models.NewHistogram([]float64{1})
+	histogram.Observe(0.5)
+
+	metrics := []models.MetricDTO{
+		models.NewGaugeMetric("Requests", 0.5),
+		models.NewCounterMetric("Requests", 5),
+		models.NewGaugeMetric("Requests_counter", 7),
+		models.NewHistogramMetric("latency", histogram),
+		models.NewGaugeMetric("latency_sum", 1),
+	}
+
+	buf := new(bytes.Buffer)
+	assert.NoError(t, WriteText(buf, metrics))
+	assert.Equal(t, "# TYPE Requests gauge\nRequests 0.5\n"+
+		"# TYPE Requests_counter gauge\nRequests_counter 7\n"+
+		"# TYPE latency histogram\n"+
+		"latency_bucket{le=\"1\"} 1\n"+
+		"latency_bucket{le=\"+Inf\"} 1\n"+
+		"latency_sum 0.5\n"+
+		"latency_count 1\n", buf.String())
+}
+
+func TestWriteText_reservedLabels(t *testing.T) {
+	histogram := models.NewHistogram([]float64{1})
+	histogram.Observe(0.5)
+
+	own := models.NewHistogramMetric("latency", histogram)
+	own.Labels = map[string]string{"le": "5"}
+	labeled := models.NewHistogramMetric("latency", histogram)
+	labeled.Labels = map[string]string{"host": "a"}
+	gauge := models.NewGaugeMetric("temp", 1)
+	gauge.Labels = map[string]string{"le": "5"}
+
+	buf := new(bytes.Buffer)
+	assert.NoError(t, WriteText(buf, []models.MetricDTO{own, labeled, gauge}))
+	assert.Equal(t, "# TYPE latency histogram\n"+
+		"latency_bucket{host=\"a\",le=\"1\"} 1\n"+
+		"latency_bucket{host=\"a\",le=\"+Inf\"} 1\n"+
+		"latency_sum{host=\"a\"} 0.5\n"+
+		"latency_count{host=\"a\"} 1\n"+
+		"# TYPE temp gauge\n"+
+		"temp{le=\"5\"} 1\n", buf.String())
+
+	buf.Reset()
+	assert.NoError(t, WriteText(buf, []models.MetricDTO{own}))
+	assert.Empty(t, buf.String())
+}
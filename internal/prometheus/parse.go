@@ -0,0 +1,327 @@
+package prometheus
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/AntonPashechko/yametrix/internal/models"
+)
+
+const untypedType = "untyped"
+
+// Sample - одно значение ряда из текстового формата
+type Sample struct {
+	Name   string
+	Labels map[string]string
+	Value  float64
+}
+
+// Family - метрика с типом из строки # TYPE и ее ряды.
+// Ряды _bucket, _sum и _count гистограмм и summary относятся к семейству с базовым именем
+type Family struct {
+	Name    string
+	Type    string
+	Samples []Sample
+}
+
+// parseLabels разбирает метки ряда {a="x",b="y"}, возвращает остаток строки после }
+func parseLabels(str string) (map[string]string, string, error) {
+	labels := make(map[string]string)
+	str = strings.TrimPrefix(str, "{")
+
+	for {
+		str = strings.TrimLeft(str, " \t")
+		if strings.HasPrefix(str, "}") {
+			return labels, str[1:], nil
+		}
+
+		eq := strings.IndexByte(str, '=')
+		if eq < 0 {
+			return nil, "", fmt.Errorf("expected label name")
+		}
+		name := strings.TrimSpace(str[:eq])
+		str = strings.TrimLeft(str[eq+1:], " \t")
+
+		if !strings.HasPrefix(str, `"`) {
+			return nil, "", fmt.Errorf("expected quoted value of label %s", name)
+		}
+
+		//Значение до неэкранированной кавычки
+		var value strings.Builder
+		i := 1
+		for ; i < len(str) && str[i] != '"'; i++ {
+			if str[i] == '\\' && i+1 < len(str) {
+				i++
+				switch str[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(str[i])
+				}
+				continue
+			}
+			value.WriteByte(str[i])
+		}
+		if i == len(str) {
+			return nil, "", fmt.Errorf("unclosed value of label %s", name)
+		}
+		labels[name] = value.String()
+
+		str = strings.TrimLeft(str[i+1:], " \t")
+		str = strings.TrimPrefix(str, ",")
+	}
+}
+
+// parseSample разбирает строку name{labels} value [timestamp]
+func parseSample(line string) (Sample, error) {
+	var sample Sample
+
+	end := strings.IndexAny(line, "{ \t")
+	if end <= 0 {
+		return sample, fmt.Errorf("expected metric name")
+	}
+	sample.Name = line[:end]
+
+	rest := line[end:]
+	if strings.HasPrefix(rest, "{") {
+		labels, tail, err := parseLabels(rest)
+		if err != nil {
+			return sample, err
+		}
+		if len(labels) != 0 {
+			sample.Labels = labels
+		}
+		rest = tail
+	}
+
+	//Метку времени, если есть, игнорируем - значение берем на момент опроса
+	fields := strings.Fields(rest)
+	if len(fields) == 0 || len(fields) > 2 {
+		return sample, fmt.Errorf("expected value")
+	}
+
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return sample, fmt.Errorf("bad value %s", fields[0])
+	}
+	sample.Value = value
+
+	return sample, nil
+}
+
+// familyName ищет семейство ряда с учетом суффиксов гистограмм и summary
+func familyName(name string, types map[string]string) string {
+	if _, ok := types[name]; ok {
+		return name
+	}
+
+	for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+		base := strings.TrimSuffix(name, suffix)
+		if base == name {
+			continue
+		}
+
+		switch types[base] {
+		case models.HistogramType:
+			return base
+		case models.SummaryType:
+			if suffix != "_bucket" {
+				return base
+			}
+		}
+	}
+
+	return name
+}
+
+// ParseText разбирает текстовый формат Prometheus, семейства в порядке появления
+func ParseText(r io.Reader) ([]Family, error) {
+	types := make(map[string]string)
+	index := make(map[string]int)
+	var families []Family
+
+	scanner := bufio.NewScanner(r)
+	for num := 1; scanner.Scan(); num++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		//Из комментариев нужен только # TYPE
+		if strings.HasPrefix(line, "#") {
+			fields := strings.Fields(line)
+			if len(fields) == 4 && fields[1] == "TYPE" {
+				types[fields[2]] = fields[3]
+			}
+			continue
+		}
+
+		sample, err := parseSample(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", num, err)
+		}
+
+		name := familyName(sample.Name, types)
+		i, ok := index[name]
+		if !ok {
+			mType, typed := types[name]
+			if !typed {
+				mType = untypedType
+			}
+
+			i = len(families)
+			index[name] = i
+			families = append(families, Family{Name: name, Type: mType})
+		}
+		families[i].Samples = append(families[i].Samples, sample)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read metrics: %w", err)
+	}
+
+	return families, nil
+}
+
+type bucket struct {
+	le    float64
+	count float64
+}
+
+type histogramSeries struct {
+	labels  map[string]string
+	buckets []bucket
+	sum     float64
+	count   float64
+}
+
+// withoutLabel возвращает копию меток без указанной, пустой набор - nil
+func withoutLabel(labels map[string]string, name string) map[string]string {
+	var res map[string]string
+	for k, v := range labels {
+		if k == name {
+			continue
+		}
+		if res == nil {
+			res = make(map[string]string, len(labels))
+		}
+		res[k] = v
+	}
+
+	return res
+}
+
+// toHistograms собирает ряды гистограммы по меткам без le, накопленные корзины переводятся в обычные
+func toHistograms(family Family) ([]models.MetricDTO, error) {
+	series := make(map[string]*histogramSeries)
+	var keys []string
+
+	get := func(labels map[string]string) *histogramSeries {
+		key := models.LabelsString(labels)
+		if _, ok := series[key]; !ok {
+			series[key] = &histogramSeries{labels: labels}
+			keys = append(keys, key)
+		}
+		return series[key]
+	}
+
+	for _, sample := range family.Samples {
+		switch sample.Name {
+		case family.Name + "_bucket":
+			le, err := strconv.ParseFloat(sample.Labels["le"], 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad le of %s: %s", family.Name, sample.Labels["le"])
+			}
+			s := get(withoutLabel(sample.Labels, "le"))
+			s.buckets = append(s.buckets, bucket{le: le, count: sample.Value})
+		case family.Name + "_sum":
+			get(sample.Labels).sum = sample.Value
+		case family.Name + "_count":
+			get(sample.Labels).count = sample.Value
+		}
+	}
+
+	metrics := make([]models.MetricDTO, 0, len(keys))
+	for _, key := range keys {
+		s := series[key]
+		sort.Slice(s.buckets, func(i, j int) bool { return s.buckets[i].le < s.buckets[j].le })
+
+		//Корзина +Inf обязательна, но если ее нет - это _count
+		if len(s.buckets) == 0 || !math.IsInf(s.buckets[len(s.buckets)-1].le, 1) {
+			s.buckets = append(s.buckets, bucket{le: math.Inf(1), count: s.count})
+		}
+
+		histogram := &models.Histogram{
+			Bounds: make([]float64, 0, len(s.buckets)-1),
+			Counts: make([]uint64, 0, len(s.buckets)),
+		}
+		if !math.IsNaN(s.sum) && !math.IsInf(s.sum, 0) {
+			histogram.Sum = s.sum
+		}
+
+		var prev float64
+		for _, b := range s.buckets {
+			if b.count < prev {
+				return nil, fmt.Errorf("buckets of %s are not cumulative", family.Name)
+			}
+			if !math.IsInf(b.le, 1) {
+				histogram.Bounds = append(histogram.Bounds, b.le)
+			}
+			histogram.Counts = append(histogram.Counts, uint64(b.count-prev))
+			histogram.Count += uint64(b.count - prev)
+			prev = b.count
+		}
+
+		metric := models.NewHistogramMetric(family.Name, histogram)
+		metric.Labels = s.labels
+		metrics = append(metrics, metric)
+	}
+
+	return metrics, nil
+}
+
+// ToMetrics переводит семейства в метрики.
+// Значения counter и histogram накопленные, как их отдает приложение - прирост считает вызывающий.
+// Накопленный counter бывает дробным, поэтому он отдается в Value, а целый прирост в Delta переводит вызывающий.
+// У summary нет наблюдений, поэтому его ряды (квантили, _sum, _count) отдаются как gauge
+func ToMetrics(families []Family) ([]models.MetricDTO, error) {
+	var metrics []models.MetricDTO
+
+	for _, family := range families {
+		switch family.Type {
+		case models.CounterType:
+			for _, sample := range family.Samples {
+				if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+					continue
+				}
+				metric := models.MetricDTO{ID: sample.Name, MType: models.CounterType}
+				metric.SetValue(sample.Value)
+				metric.Labels = sample.Labels
+				metrics = append(metrics, metric)
+			}
+		case models.HistogramType:
+			histograms, err := toHistograms(family)
+			if err != nil {
+				return nil, err
+			}
+			metrics = append(metrics, histograms...)
+		default:
+			for _, sample := range family.Samples {
+				//NaN и Inf не передать в JSON
+				if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+					continue
+				}
+				metric := models.NewGaugeMetric(sample.Name, sample.Value)
+				metric.Labels = sample.Labels
+				metrics = append(metrics, metric)
+			}
+		}
+	}
+
+	return metrics, nil
+}
@@ -0,0 +1,117 @@
+package prometheus
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/AntonPashechko/yametrix/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseText(t *testing.T) {
+	text := `# HELP http_requests_total Total requests.
+# TYPE http_requests_total counter
+http_requests_total{method="post",path="/a \"b\""} 1027 1395066363000
+http_requests_total{method="get"} 3
+# TYPE latency histogram
+latency_bucket{le="0.1"} 2
+latency_bucket{le="+Inf"} 3
+latency_sum 1.5
+latency_count 3
+no_type_metric 42
+`
+	families, err := ParseText(strings.NewReader(text))
+	require.NoError(t, err)
+	require.Len(t, families, 3)
+
+	assert.Equal(t, Family{
+		Name: "http_requests_total",
+		Type: models.CounterType,
+		Samples: []Sample{
+			{Name: "http_requests_total", Labels: map[string]string{"method": "post", "path": `/a "b"`}, Value: 1027},
+			{Name: "http_requests_total", Labels: map[string]string{"method": "get"}, Value: 3},
+		},
+	}, families[0])
+
+	assert.Equal(t, "latency", families[1].Name)
+	assert.Len(t, families[1].Samples, 4)
+
+	assert.Equal(t, Family{
+		Name:    "no_type_metric",
+		Type:    untypedType,
+		Samples: []Sample{{Name: "no_type_metric", Value: 42}},
+	}, families[2])
+}
+
+func TestParseTextErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"no_value", "metric\n"},
+		{"bad_value", "metric abc\n"},
+		{"unclosed_label", `metric{a="b} 1`},
+		{"unquoted_label", `metric{a=b} 1`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseText(strings.NewReader(tt.text))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestToMetricsRoundTrip(t *testing.T) {
+	histogram := models.NewHistogram([]float64{0.1, 1})
+	histogram.Observe(0.05)
+	histogram.Observe(0.5)
+	histogram.Observe(5)
+	histogramMetric := models.NewHistogramMetric("latency", histogram)
+	histogramMetric.Labels = map[string]string{"handler": "update"}
+
+	gauge := models.NewGaugeMetric("Alloc", 1.5)
+	gauge.Labels = map[string]string{"host": "a"}
+
+	metrics := []models.MetricDTO{
+		gauge,
+		models.NewCounterMetric("PollCount", 5),
+		histogramMetric,
+	}
+
+	buf := new(bytes.Buffer)
+	require.NoError(t, WriteText(buf, metrics))
+
+	families, err := ParseText(buf)
+	require.NoError(t, err)
+
+	//Накопленный counter приходит в Value
+	counter := models.MetricDTO{ID: "PollCount", MType: models.CounterType}
+	counter.SetValue(5)
+
+	got, err := ToMetrics(families)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []models.MetricDTO{gauge, counter, histogramMetric}, got)
+}
+
+func TestToMetricsSummary(t *testing.T) {
+	text := `# TYPE rpc summary
+rpc{quantile="0.5"} 0.2
+rpc_sum 10
+rpc_count 4
+`
+	families, err := ParseText(strings.NewReader(text))
+	require.NoError(t, err)
+
+	got, err := ToMetrics(families)
+	require.NoError(t, err)
+
+	quantile := models.NewGaugeMetric("rpc", 0.2)
+	quantile.Labels = map[string]string{"quantile": "0.5"}
+	assert.Equal(t, []models.MetricDTO{
+		quantile,
+		models.NewGaugeMetric("rpc_sum", 10),
+		models.NewGaugeMetric("rpc_count", 4),
+	}, got)
+}
@@ -0,0 +1,73 @@
+package proto
+
+import (
+	"github.com/AntonPashechko/yametrix/internal/models"
+)
+
+// FromDTO переводит метрику во внутреннем представлении в сообщение gRPC
+func FromDTO(metric models.MetricDTO) *Metric {
+	res := &Metric{
+		Id:           metric.ID,
+		Type:         metric.MType,
+		Delta:        metric.Delta,
+		Value:        metric.Value,
+		Labels:       metric.Labels,
+		Observations: metric.Observations,
+		Quantile:     metric.Quantile,
+	}
+
+	if metric.Histogram != nil {
+		res.Histogram = &Histogram{
+			Bounds: metric.Histogram.Bounds,
+			Counts: metric.Histogram.Counts,
+			Sum:    metric.Histogram.Sum,
+			Count:  metric.Histogram.Count,
+		}
+	}
+
+	if metric.Summary != nil {
+		res.Summary = &Summary{
+			Sum:   metric.Summary.Sum,
+			Count: metric.Summary.Count,
+		}
+		for _, q := range metric.Summary.Quantiles {
+			res.Summary.Quantiles = append(res.Summary.Quantiles, &Quantile{Quantile: q.Quantile, Value: q.Value})
+		}
+	}
+
+	return res
+}
+
+// ToDTO переводит сообщение gRPC во внутреннее представление метрики
+func ToDTO(metric *Metric) models.MetricDTO {
+	res := models.MetricDTO{
+		ID:           metric.GetId(),
+		MType:        metric.GetType(),
+		Delta:        metric.Delta,
+		Value:        metric.Value,
+		Labels:       metric.GetLabels(),
+		Observations: metric.GetObservations(),
+		Quantile:     metric.Quantile,
+	}
+
+	if h := metric.GetHistogram(); h != nil {
+		res.Histogram = &models.Histogram{
+			Bounds: h.GetBounds(),
+			Counts: h.GetCounts(),
+			Sum:    h.GetSum(),
+			Count:  h.GetCount(),
+		}
+	}
+
+	if s := metric.GetSummary(); s != nil {
+		res.Summary = &models.Summary{
+			Sum:   s.GetSum(),
+			Count: s.GetCount(),
+		}
+		for _, q := range s.GetQuantiles() {
+			res.Summary.Quantiles = append(res.Summary.Quantiles, models.Quantile{Quantile: q.GetQuantile(), Value: q.GetValue()})
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,17 @@
+package proto
+
+import (
+	gproto "google.golang.org/protobuf/proto"
+)
+
+// SignMetadataKey - ключ метаданных gRPC с подписью запроса, аналог заголовка HashSHA256
+const SignMetadataKey = "hashsha256"
+
+// KeyIDMetadataKey - ключ метаданных с ID ключа агента, аналог заголовка HashKeyID
+const KeyIDMetadataKey = "hashkeyid"
+
+// SignData - байты сообщения для подписи.
+// Маршалинг детерминированный, иначе порядок меток в map у агента и сервера может не совпасть
+func SignData(msg gproto.Message) ([]byte, error) {
+	return gproto.MarshalOptions{Deterministic: true}.Marshal(msg)
+}
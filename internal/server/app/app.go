@@ -2,82 +2,349 @@ package app
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/AntonPashechko/yametrix/internal/alerting"
+	"github.com/AntonPashechko/yametrix/internal/auth"
 	"github.com/AntonPashechko/yametrix/internal/compress"
+	"github.com/AntonPashechko/yametrix/internal/encrypt"
 	"github.com/AntonPashechko/yametrix/internal/logger"
+	"github.com/AntonPashechko/yametrix/internal/scheduler"
 	"github.com/AntonPashechko/yametrix/internal/server/config"
+	"github.com/AntonPashechko/yametrix/internal/server/grpcserver"
 	"github.com/AntonPashechko/yametrix/internal/server/handlers"
 	"github.com/AntonPashechko/yametrix/internal/server/restorer"
+	"github.com/AntonPashechko/yametrix/internal/server/statsd"
 	"github.com/AntonPashechko/yametrix/internal/sign"
 	"github.com/AntonPashechko/yametrix/internal/storage"
 	"github.com/AntonPashechko/yametrix/internal/storage/memstorage"
 	"github.com/AntonPashechko/yametrix/internal/storage/sqlstorage"
+	"github.com/AntonPashechko/yametrix/internal/subnet"
+	"github.com/AntonPashechko/yametrix/internal/tenant"
+	"github.com/AntonPashechko/yametrix/internal/tlsconfig"
 	"github.com/go-chi/chi/v5"
 	_ "github.com/jackc/pgx/v5/stdlib"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 const (
 	shutdownTime = 5 * time.Second
 )
 
+// liveFields - настройки, которые применяются по SIGHUP без рестарта
+var liveFields = map[string]bool{
+	"LogLevel":      true,
+	"SignKey":       true,
+	"StoreInterval": true,
+	"StorePath":     true,
+	"TrustedSubnet": true,
+}
+
 type App struct {
-	server     *http.Server
-	storage    storage.MetricsStorage
-	notifyStop context.CancelFunc
+	cfg            *config.Config
+	server         *http.Server
+	storage        storage.MetricsStorage
+	alertScheduler scheduler.Scheduler
+	alertNotifier  *alerting.WebhookNotifier
+	statsdListener *statsd.Listener
+	grpcServer     *grpc.Server
+	grpcListener   net.Listener
+	reloadCh       chan os.Signal //SIGHUP - перечитать конфигурацию и ключи агентов
+	notifyStop     context.CancelFunc
 }
 
 func Create(cfg *config.Config) (*App, error) {
 
+	//Квоты рядов тенантов
+	quotas := tenant.Quotas{Default: cfg.TenantSeries, Tenants: cfg.TenantQuotas}
+
 	var storage storage.MetricsStorage
 	if cfg.DataBaseDNS != "" {
-		var err error
-		storage, err = sqlstorage.NewStorage(cfg.DataBaseDNS)
+		dbStorage, err := sqlstorage.NewStorage(cfg.DataBaseDNS, cfg.HistoryRetention, cfg.SummaryWindow)
 		if err != nil {
 			return nil, fmt.Errorf("cannot create db store: %w", err)
 		}
+		dbStorage.SetQuotas(quotas)
 
+		storage = dbStorage
 	} else {
 		//Хранилище метрик в памяти
 		memStorage := memstorage.NewStorage()
-		//Сторер
-		restorer.Initialize(memStorage, restorer.FileRestorer, cfg)
+		memStorage.SetHistoryRetention(cfg.HistoryRetention)
+		memStorage.SetSummaryWindow(cfg.SummaryWindow)
+		memStorage.SetQuotas(quotas)
+		//Сторер, с журналом обновлений - снимки по StoreInterval
+		restorerType := restorer.FileRestorer
+		if cfg.StoreWAL {
+			restorerType = restorer.WALRestorer
+		}
+		if err := restorer.Initialize(memStorage, restorerType, cfg); err != nil {
+			return nil, fmt.Errorf("cannot initialize metrics restorer: %w", err)
+		}
 
 		storage = memStorage
 	}
 
+	//API токены из файла или из БД
+	var tokens auth.TokenStore
+	if cfg.TokensPath != "" {
+		var err error
+		tokens, err = auth.LoadFileStore(cfg.TokensPath)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load api tokens: %w", err)
+		}
+	} else if cfg.TokensDB {
+		var err error
+		tokens, err = auth.NewDBStore(cfg.DataBaseDNS)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create api tokens store: %w", err)
+		}
+	}
+
+	//TLS для http и gRPC, если задан сертификат; с CA клиентов - mTLS
+	var tlsConfig *tls.Config
+	if cfg.TLSCert != "" {
+		var err error
+		tlsConfig, err = tlsconfig.NewServerConfig(cfg.TLSCert, cfg.TLSKey, cfg.TLSClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create tls config: %w", err)
+		}
+	}
+
 	//Наш роутер, регистрируем хэндлеры
 	router := chi.NewRouter()
 	//Подключаем middleware логирования
 	router.Use(logger.Middleware)
+	//API токены, если заданы - без токена нужной области доступа запросы не принимаем
+	if tokens != nil {
+		auth.Initialize(tokens)
+		router.Use(auth.Middleware)
+	}
+	//Тенант из токена или заголовка X-Tenant, без них - общее пространство
+	router.Use(tenant.Middleware)
+	//Если задан закрытый ключ - расшифровываем тело запросов, до декомпрессии
+	if cfg.CryptoKey != "" {
+		if err := encrypt.InitializeDecryptor(cfg.CryptoKey); err != nil {
+			return nil, fmt.Errorf("cannot initialize decryptor: %w", err)
+		}
+		router.Use(encrypt.Middleware)
+	}
 	//Подключаем middleware декомпрессии
 	router.Use(compress.Middleware)
 
 	//Если задан ключ для подписи - инициализируем объект, добавляем Middleware
 	if cfg.SignKey != `` {
-		sign.Initialize([]byte(cfg.SignKey))
-		router.Use(sign.Middleware)
+		sign.Initialize("", []byte(cfg.SignKey))
+	}
+	//Ключи агентов по ID, файл перечитывается по SIGHUP
+	if cfg.SignKeysPath != `` {
+		if err := sign.InitializeKeyring(cfg.SignKeysPath); err != nil {
+			return nil, fmt.Errorf("cannot load sign keys: %w", err)
+		}
+		logger.Info("Loaded %d agent sign keys", sign.MetricsKeyring.Len())
+	}
+	//Подключаем всегда - ключ могут задать при перечитывании конфигурации, без ключа Middleware ничего не делает
+	router.Use(sign.Middleware)
+
+	//Если задана доверенная подсеть - обновления принимаем только из нее
+	if err := subnet.Initialize(cfg.TrustedSubnet); err != nil {
+		return nil, fmt.Errorf("cannot initialize trusted subnet: %w", err)
 	}
 
 	metricsHandler := handlers.NewMetricsHandler(storage)
 	metricsHandler.Register(router)
 
+	//Правила алертинга, если заданы - из отдельного файла или из файла конфигурации
+	rules := cfg.AlertRules
+	if cfg.AlertRulesPath != "" {
+		var err error
+		rules, err = alerting.LoadRules(cfg.AlertRulesPath)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load alert rules: %w", err)
+		}
+	}
+
+	alertEngine := alerting.NewEngine(storage, rules)
+
+	//Уведомления о сработавших алертах, если заданы адреса
+	var alertNotifier *alerting.WebhookNotifier
+	if len(cfg.AlertWebhooks) != 0 {
+		alertNotifier = alerting.NewWebhookNotifier(cfg.AlertWebhooks)
+		alertEngine.SetNotifier(alertNotifier)
+		go alertNotifier.Start()
+	}
+
+	alertsHandler := handlers.NewAlertsHandler(alertEngine)
+	alertsHandler.Register(router)
+
+	//Проверяем правила только если есть что проверять
+	var alertScheduler scheduler.Scheduler
+	if alertEngine.HasRules() {
+		alertScheduler = scheduler.NewScheduler(int64(cfg.AlertInterval), alertEngine)
+		go alertScheduler.Start()
+	}
+
+	//Прием метрик StatsD, если задан адрес
+	var statsdListener *statsd.Listener
+	if cfg.StatsdEndpoint != "" {
+		var err error
+		statsdListener, err = statsd.NewListener(cfg.StatsdEndpoint, storage)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create statsd listener: %w", err)
+		}
+	}
+
+	//gRPC API на отдельном порту, если задан адрес
+	var grpcServer *grpc.Server
+	var grpcListener net.Listener
+	if cfg.GRPCEndpoint != "" {
+		var err error
+		grpcListener, err = net.Listen("tcp", cfg.GRPCEndpoint)
+		if err != nil {
+			return nil, fmt.Errorf("cannot listen grpc address: %w", err)
+		}
+
+		opts := []grpc.ServerOption{
+			grpc.ChainUnaryInterceptor(grpcserver.LoggerInterceptor, grpcserver.SubnetInterceptor, grpcserver.AuthInterceptor, grpcserver.TenantInterceptor, grpcserver.SignInterceptor),
+			grpc.ChainStreamInterceptor(grpcserver.AuthStreamInterceptor, grpcserver.TenantStreamInterceptor),
+		}
+		if tlsConfig != nil {
+			opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+		}
+
+		grpcServer = grpc.NewServer(opts...)
+		grpcserver.NewMetricsServer(storage).Register(grpcServer)
+	}
+
+	//По SIGHUP перечитываем конфигурацию и ключи агентов
+	reloadCh := make(chan os.Signal, 1)
+	signal.Notify(reloadCh, syscall.SIGHUP)
+
 	return &App{
+		cfg: cfg,
 		server: &http.Server{
-			Addr:    cfg.Endpoint,
-			Handler: router,
+			Addr:      cfg.Endpoint,
+			Handler:   router,
+			TLSConfig: tlsConfig,
 		},
-		storage: storage,
+		storage:        storage,
+		alertScheduler: alertScheduler,
+		alertNotifier:  alertNotifier,
+		statsdListener: statsdListener,
+		grpcServer:     grpcServer,
+		grpcListener:   grpcListener,
+		reloadCh:       reloadCh,
 	}, nil
 }
 
+// reload перечитывает по сигналу ключи агентов и конфигурацию, при ошибке остаются прежние
+func (m *App) reload() {
+	for range m.reloadCh {
+		if sign.MetricsKeyring != nil {
+			if err := sign.MetricsKeyring.Reload(); err != nil {
+				logger.Error("cannot reload sign keys: %s", err)
+			} else {
+				logger.Info("Reloaded %d agent sign keys", sign.MetricsKeyring.Len())
+			}
+		}
+
+		m.reloadConfig()
+	}
+}
+
+// reloadConfig применяет изменения конфигурации, которые можно применить на лету.
+// Остальные изменения только логируются, действуют прежние значения до рестарта
+func (m *App) reloadConfig() {
+	cfg, err := config.Reload()
+	if err != nil {
+		logger.Error("cannot reload config: %s", err)
+		return
+	}
+
+	changed := config.Diff(m.cfg, cfg)
+	if len(changed) == 0 {
+		logger.Info("Config reloaded, nothing changed")
+		return
+	}
+
+	for _, field := range changed {
+		if !liveFields[field] {
+			logger.Error("cannot apply %s without restart, keep current value", field)
+		}
+	}
+
+	if cfg.LogLevel != m.cfg.LogLevel {
+		if err := logger.SetLevel(cfg.LogLevel); err != nil {
+			logger.Error("cannot apply LogLevel: %s", err)
+		} else {
+			m.cfg.LogLevel = cfg.LogLevel
+			logger.Info("Applied LogLevel: %s", cfg.LogLevel)
+		}
+	}
+
+	if cfg.SignKey != m.cfg.SignKey {
+		//Пустой ключ выключает подпись общим ключом, значение ключа не логируем
+		sign.Initialize("", []byte(cfg.SignKey))
+		m.cfg.SignKey = cfg.SignKey
+		logger.Info("Applied SignKey")
+	}
+
+	if cfg.TrustedSubnet != m.cfg.TrustedSubnet {
+		if err := subnet.Initialize(cfg.TrustedSubnet); err != nil {
+			logger.Error("cannot apply TrustedSubnet: %s", err)
+		} else {
+			m.cfg.TrustedSubnet = cfg.TrustedSubnet
+			logger.Info("Applied TrustedSubnet: %s", cfg.TrustedSubnet)
+		}
+	}
+
+	if cfg.StorePath != m.cfg.StorePath || cfg.StoreInterval != m.cfg.StoreInterval {
+		if err := restorer.Reconfigure(cfg.StorePath, cfg.StoreInterval); err != nil {
+			logger.Error("cannot apply StorePath and StoreInterval: %s", err)
+		} else {
+			m.cfg.StorePath = cfg.StorePath
+			m.cfg.StoreInterval = cfg.StoreInterval
+			logger.Info("Applied StorePath: %s, StoreInterval: %d", cfg.StorePath, cfg.StoreInterval)
+		}
+	}
+}
+
 func (m *App) Run() {
-	if err := m.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	go m.reload()
+
+	if m.statsdListener != nil {
+		go m.statsdListener.Run()
+		logger.Info("Running statsd listener: address %s", m.statsdListener.Addr())
+	}
+
+	if m.grpcServer != nil {
+		go func() {
+			if err := m.grpcServer.Serve(m.grpcListener); err != nil {
+				logger.Error("grpc server stopped: %s", err)
+			}
+		}()
+		logger.Info("Running grpc server: address %s", m.grpcListener.Addr())
+	}
+
+	//Сертификаты уже в TLSConfig, поэтому пути не передаем
+	var err error
+	if m.server.TLSConfig != nil {
+		logger.Info("Running https server: address %s", m.server.Addr)
+		err = m.server.ListenAndServeTLS("", "")
+	} else {
+		err = m.server.ListenAndServe()
+	}
+
+	if err != nil && err != http.ErrServerClosed {
 		log.Fatalf("cannot listen: %s\n", err)
 	}
 }
@@ -89,12 +356,36 @@ func (m *App) ServerDone() <-chan struct{} {
 }
 
 func (m *App) Shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTime)
+	defer cancel()
+
 	defer m.notifyStop()
 	defer m.storage.Close()
 	defer restorer.Shutdown()
 
-	ctx, cancel := context.WithTimeout(context.Background(), shutdownTime)
-	defer cancel()
+	if auth.MetricsTokens != nil {
+		defer auth.MetricsTokens.Close()
+	}
+
+	//Стопаем если вообще был запущен
+	if m.alertScheduler != (scheduler.Scheduler{}) {
+		m.alertScheduler.Stop()
+	}
+
+	if m.alertNotifier != nil {
+		m.alertNotifier.Stop(ctx)
+	}
+
+	if m.statsdListener != nil {
+		m.statsdListener.Close()
+	}
+
+	signal.Stop(m.reloadCh)
+	close(m.reloadCh)
+
+	if m.grpcServer != nil {
+		m.grpcServer.GracefulStop()
+	}
 
 	if err := m.server.Shutdown(ctx); err != nil {
 		return fmt.Errorf("server shutdown failed: %w", err)
@@ -4,88 +4,356 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"reflect"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/AntonPashechko/yametrix/internal/alerting"
 	"github.com/AntonPashechko/yametrix/internal/logger"
 
 	"github.com/AntonPashechko/yametrix/pkg/utils"
+	"go.uber.org/zap/zapcore"
 )
 
 type Config struct {
-	Endpoint      string
-	StoreInterval uint64 //0 - синхронная запись
-	StorePath     string
-	Restore       bool
-	DataBaseDNS   string
-	SignKey       string
+	Endpoint         string
+	LogLevel         string
+	StatsdEndpoint   string //пусто - прием StatsD выключен
+	GRPCEndpoint     string //пусто - gRPC сервер не запускается
+	StoreInterval    uint64 //0 - синхронная запись
+	StorePath        string
+	StoreWAL         bool //журнал обновлений, StoreInterval - периодичность снимков
+	Restore          bool
+	DataBaseDNS      string
+	SignKey          string
+	SignKeysPath     string //файл ключей агентов по ID, пусто - только общий ключ
+	CryptoKey        string //путь к закрытому ключу, пусто - тело запросов не шифруется
+	TLSCert          string //сертификат сервера, пусто - http без TLS
+	TLSKey           string
+	TLSClientCA      string //CA клиентских сертификатов, если задан - агенты обязаны предъявить сертификат
+	TrustedSubnet    string //CIDR агентов, пусто - метрики принимаются от всех
+	TokensPath       string //файл API токенов
+	TokensDB         bool   //API токены в таблице api_tokens БД
+	TenantSeries     int    //квота рядов тенанта по умолчанию, 0 - без ограничения
+	TenantQuotas     map[string]int
+	HistoryRetention time.Duration //0 - история метрик не ведется
+	SummaryWindow    time.Duration
+	AlertRulesPath   string
+	AlertRules       []alerting.Rule //правила из файла конфигурации
+	AlertInterval    uint64
+	AlertWebhooks    []string
 }
 
 func newConfig(opt options) (*Config, error) {
 	cfg := &Config{
-		Endpoint:    opt.endpoint,
-		StorePath:   opt.storePath,
-		DataBaseDNS: opt.dbDNS,
-		SignKey:     opt.signKey,
+		Endpoint:       opt.endpoint,
+		LogLevel:       opt.logLevel,
+		StatsdEndpoint: opt.statsdEndpoint,
+		GRPCEndpoint:   opt.grpcEndpoint,
+		StorePath:      opt.storePath,
+		DataBaseDNS:    opt.dbDNS,
+		SignKey:        opt.signKey,
+		SignKeysPath:   opt.signKeysPath,
+		CryptoKey:      opt.cryptoKey,
+		TLSCert:        opt.tlsCert,
+		TLSKey:         opt.tlsKey,
+		TLSClientCA:    opt.tlsClientCA,
+		TrustedSubnet:  opt.trustedSubnet,
+		TokensPath:     opt.tokensPath,
+
+		AlertRulesPath: opt.alertRulesPath,
+	}
+
+	if len(opt.alertRules) != 0 {
+		if cfg.AlertRulesPath != "" {
+			return nil, fmt.Errorf("bad params ALERT_RULES and alert_rules: only one of them can be set")
+		}
+
+		rules, err := alerting.NewRules(opt.alertRules)
+		if err != nil {
+			return nil, fmt.Errorf("bad param alert_rules: %w", err)
+		}
+		cfg.AlertRules = rules
+	}
+
+	if _, err := zapcore.ParseLevel(cfg.LogLevel); err != nil {
+		return nil, fmt.Errorf("bad param LOG_LEVEL: %w", err)
+	}
+
+	for _, webhook := range strings.Split(opt.alertWebhooks, ",") {
+		if webhook = strings.TrimSpace(webhook); webhook != "" {
+			cfg.AlertWebhooks = append(cfg.AlertWebhooks, webhook)
+		}
+	}
+
+	if (cfg.TLSCert == "") != (cfg.TLSKey == "") {
+		return nil, fmt.Errorf("bad params TLS_CERT and TLS_KEY: must be set both")
+	}
+	if cfg.TLSClientCA != "" && cfg.TLSCert == "" {
+		return nil, fmt.Errorf("bad param TLS_CLIENT_CA: requires TLS_CERT and TLS_KEY")
+	}
+	//gRPC тела не шифруются CRYPTO_KEY: без TLS обновления по нему шли бы открытыми в обход ключа
+	if cfg.CryptoKey != "" && cfg.GRPCEndpoint != "" && cfg.TLSCert == "" {
+		return nil, fmt.Errorf("bad params GRPC_ADDRESS and CRYPTO_KEY: grpc updates are not encrypted with CRYPTO_KEY, set TLS_CERT and TLS_KEY")
 	}
 
+	tokensDB, err := strconv.ParseBool(opt.tokensDB)
+	if err != nil {
+		return nil, fmt.Errorf("bad param TOKENS_DB: %w", err)
+	}
+	if tokensDB && cfg.DataBaseDNS == "" {
+		return nil, fmt.Errorf("bad param TOKENS_DB: requires DATABASE_DSN")
+	}
+	if tokensDB && cfg.TokensPath != "" {
+		return nil, fmt.Errorf("bad params TOKENS_DB and TOKENS_FILE: only one of them can be set")
+	}
+	cfg.TokensDB = tokensDB
+
+	cfg.TenantSeries, err = strconv.Atoi(opt.tenantSeries)
+	if err != nil || cfg.TenantSeries < 0 {
+		return nil, fmt.Errorf("bad param TENANT_SERIES_LIMIT: %s", opt.tenantSeries)
+	}
+
+	cfg.TenantQuotas, err = parseQuotas(opt.tenantQuotas)
+	if err != nil {
+		return nil, fmt.Errorf("bad param TENANT_QUOTAS: %w", err)
+	}
+
+	storeWAL, err := strconv.ParseBool(opt.storeWAL)
+	if err != nil {
+		return nil, fmt.Errorf("bad param STORE_WAL: %w", err)
+	}
+	cfg.StoreWAL = storeWAL
+
 	restore, err := strconv.ParseBool(opt.restore)
 	if err != nil {
 		return nil, fmt.Errorf("bad param RESTORE: %w", err)
 	}
 	cfg.Restore = restore
 
+	historyRetention, err := time.ParseDuration(opt.historyRetention)
+	if err != nil {
+		return nil, fmt.Errorf("bad param HISTORY_RETENTION: %w", err)
+	}
+	cfg.HistoryRetention = historyRetention
+
+	summaryWindow, err := time.ParseDuration(opt.summaryWindow)
+	if err != nil {
+		return nil, fmt.Errorf("bad param SUMMARY_WINDOW: %w", err)
+	}
+	if summaryWindow <= 0 {
+		return nil, fmt.Errorf("bad param SUMMARY_WINDOW: must be positive")
+	}
+	cfg.SummaryWindow = summaryWindow
+
+	cfg.StoreInterval, err = parseInterval(opt.storeInterval)
+	if err != nil {
+		return nil, fmt.Errorf("bad param STORE_INTERVAL: %w", err)
+	}
+
+	cfg.AlertInterval, err = parseInterval(opt.alertInterval)
+	if err != nil {
+		return nil, fmt.Errorf("bad param ALERT_INTERVAL: %w", err)
+	}
+	if cfg.AlertInterval == 0 {
+		return nil, fmt.Errorf("bad param ALERT_INTERVAL: must be positive")
+	}
+
+	if cfg.StoreWAL && cfg.StorePath == "" {
+		return nil, fmt.Errorf("bad param STORE_WAL: requires FILE_STORAGE_PATH")
+	}
+	if cfg.StoreWAL && cfg.StoreInterval == 0 {
+		return nil, fmt.Errorf("bad param STORE_INTERVAL: must be positive with STORE_WAL, it sets snapshot interval")
+	}
+
+	return cfg, nil
+}
+
+// Diff возвращает имена полей, которые отличаются в двух конфигурациях
+func Diff(old *Config, cur *Config) []string {
+	var fields []string
+
+	oldValue, curValue := reflect.ValueOf(*old), reflect.ValueOf(*cur)
+	for i := 0; i < oldValue.NumField(); i++ {
+		if !reflect.DeepEqual(oldValue.Field(i).Interface(), curValue.Field(i).Interface()) {
+			fields = append(fields, oldValue.Type().Field(i).Name)
+		}
+	}
+
+	return fields
+}
+
+// parseInterval разбирает интервал в секундах, заданный как 10 или 10s
+func parseInterval(value string) (uint64, error) {
 	//В тестах на гитхаб данный параметр от инкремента к инкременту задается по разному, или 10 или 10s
 	//Буду тогда по очереди пытаться его разобрать, сперва как 10s
-	duration, err := time.ParseDuration(opt.storeInterval)
+	duration, err := time.ParseDuration(value)
 	if err != nil {
 		//Теперь как 10
-		duration, err := utils.StrToInt64(opt.storeInterval)
+		duration, err := utils.StrToInt64(value)
 		if err != nil {
-			return nil, fmt.Errorf("bad param STORE_INTERVAL: %w", err)
+			return 0, err
 		}
-		cfg.StoreInterval = uint64(duration)
-	} else {
-		cfg.StoreInterval = uint64(duration.Seconds())
+		return uint64(duration), nil
 	}
 
-	return cfg, nil
+	return uint64(duration.Seconds()), nil
+}
+
+// parseQuotas разбирает квоты тенантов вида team-a=100,team-b=500
+func parseQuotas(value string) (map[string]int, error) {
+	quotas := make(map[string]int)
+
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+
+		name, limit, found := strings.Cut(item, "=")
+		if !found {
+			return nil, fmt.Errorf("expected tenant=limit, got %s", item)
+		}
+
+		val, err := strconv.Atoi(strings.TrimSpace(limit))
+		if err != nil || val < 0 {
+			return nil, fmt.Errorf("bad limit of %s: %s", name, limit)
+		}
+
+		quotas[strings.TrimSpace(name)] = val
+	}
+
+	return quotas, nil
 }
 
 type options struct {
-	endpoint      string
-	storeInterval string
-	storePath     string
-	restore       string
-	dbDNS         string
-	signKey       string
+	configPath       string
+	endpoint         string
+	logLevel         string
+	statsdEndpoint   string
+	grpcEndpoint     string
+	storeInterval    string
+	storePath        string
+	storeWAL         string
+	restore          string
+	dbDNS            string
+	signKey          string
+	signKeysPath     string
+	cryptoKey        string
+	tlsCert          string
+	tlsKey           string
+	tlsClientCA      string
+	trustedSubnet    string
+	tokensPath       string
+	tokensDB         string
+	tenantSeries     string
+	tenantQuotas     string
+	historyRetention string
+	summaryWindow    string
+	alertRulesPath   string
+	alertInterval    string
+	alertWebhooks    string
+	alertRules       []alerting.RuleConfig
 }
 
+// opt - флаги привязаны к полям, поэтому структура одна на все перечитывания конфигурации
+var opt options
+
 func LoadServerConfig() (*Config, error) {
 
 	logger.Info(strings.Join(os.Args, " "))
-	var opt options
 
 	/*Разбираем командную строку сперва в структуру только со string полями*/
+	flag.StringVar(&opt.configPath, "c", "", "config file path, json or yaml")
+	flag.StringVar(&opt.configPath, "config", "", "config file path, json or yaml")
+
 	flag.StringVar(&opt.endpoint, "a", "localhost:8080", "address and port to run server")
+	flag.StringVar(&opt.logLevel, "log-level", "info", "log level")
+	flag.StringVar(&opt.statsdEndpoint, "su", "", "udp address and port to receive statsd metrics")
+	flag.StringVar(&opt.grpcEndpoint, "g", "", "address and port to run grpc server")
 
 	flag.StringVar(&opt.storeInterval, "i", "300s", "store metrics interval")
 	flag.StringVar(&opt.storePath, "а", "/tmp/metrics-db.json", "store metrics path")
+	flag.StringVar(&opt.storeWAL, "wal", "false", "write-ahead log of metric updates, store interval sets snapshot interval")
 
 	flag.StringVar(&opt.restore, "r", "true", "is restore")
 	flag.StringVar(&opt.dbDNS, "d", "", "db dns")
 
 	flag.StringVar(&opt.signKey, "k", "", "sign key")
+	flag.StringVar(&opt.signKeysPath, "kf", "", "agents sign keys file path")
+	flag.StringVar(&opt.cryptoKey, "crypto-key", "", "private key path to decrypt requests, unencrypted updates (including /update/{type}/{name}/{value}) are rejected")
+
+	flag.StringVar(&opt.tlsCert, "tls-cert", "", "server TLS certificate path")
+	flag.StringVar(&opt.tlsKey, "tls-key", "", "server TLS private key path")
+	flag.StringVar(&opt.tlsClientCA, "tls-client-ca", "", "CA path to verify agent certificates (mTLS)")
+
+	flag.StringVar(&opt.trustedSubnet, "t", "", "trusted agents subnet in CIDR notation")
+
+	flag.StringVar(&opt.tokensPath, "tokens", "", "API tokens file path")
+	flag.StringVar(&opt.tokensDB, "tokens-db", "false", "load API tokens from db")
+
+	flag.StringVar(&opt.tenantSeries, "tsl", "0", "default series limit per tenant, 0 - unlimited")
+	flag.StringVar(&opt.tenantQuotas, "tq", "", "series limits of tenants, e.g. team-a=100,team-b=500")
+
+	flag.StringVar(&opt.historyRetention, "hr", "1h", "metrics history retention")
+	flag.StringVar(&opt.summaryWindow, "sw", "10m", "summary quantiles sliding window")
+
+	flag.StringVar(&opt.alertRulesPath, "ar", "", "alert rules file path")
+	flag.StringVar(&opt.alertInterval, "ai", "10s", "alert rules evaluation interval")
+	flag.StringVar(&opt.alertWebhooks, "aw", "", "comma separated alert webhook urls")
+
+	return load()
+}
+
+// Reload перечитывает конфигурацию из файла, env и флагов заново, по SIGHUP
+func Reload() (*Config, error) {
+	//В полях остались значения прошлой загрузки - сбрасываем к значениям по умолчанию
+	flag.VisitAll(func(f *flag.Flag) {
+		f.Value.Set(f.DefValue)
+	})
+	opt.alertRules = nil
+
+	return load()
+}
 
+func load() (*Config, error) {
 	flag.Parse()
 
+	/*Файл конфигурации - самый низкий приоритет, поверх него env и флаги*/
+	if opt.configPath == "" {
+		if configPath, exist := os.LookupEnv("CONFIG"); exist {
+			logger.Info("CONFIG env: %s", configPath)
+			opt.configPath = configPath
+		}
+	}
+
+	if opt.configPath != "" {
+		if err := loadFile(opt.configPath, &opt); err != nil {
+			return nil, err
+		}
+	}
+
 	/*Но если заданы в окружении - берем оттуда*/
 	if addr, exist := os.LookupEnv("ADDRESS"); exist {
 		opt.endpoint = addr
 		logger.Info("ADDRESS env: %s", addr)
 	}
 
+	if logLevel, exist := os.LookupEnv("LOG_LEVEL"); exist {
+		opt.logLevel = logLevel
+		logger.Info("LOG_LEVEL env: %s", logLevel)
+	}
+
+	if statsdAddr, exist := os.LookupEnv("STATSD_ADDRESS"); exist {
+		opt.statsdEndpoint = statsdAddr
+		logger.Info("STATSD_ADDRESS env: %s", statsdAddr)
+	}
+
+	if grpcAddr, exist := os.LookupEnv("GRPC_ADDRESS"); exist {
+		opt.grpcEndpoint = grpcAddr
+		logger.Info("GRPC_ADDRESS env: %s", grpcAddr)
+	}
+
 	if storeIntStr, exist := os.LookupEnv("STORE_INTERVAL"); exist {
 		opt.storeInterval = storeIntStr
 		logger.Info("STORE_INTERVAL env: %s", storeIntStr)
@@ -96,6 +364,11 @@ func LoadServerConfig() (*Config, error) {
 		logger.Info("FILE_STORAGE_PATH env: %s", storePath)
 	}
 
+	if storeWAL, exist := os.LookupEnv("STORE_WAL"); exist {
+		opt.storeWAL = storeWAL
+		logger.Info("STORE_WAL env: %s", storeWAL)
+	}
+
 	if restore, exist := os.LookupEnv("RESTORE"); exist {
 		opt.restore = restore
 		logger.Info("RESTORE env: %s", restore)
@@ -111,5 +384,83 @@ func LoadServerConfig() (*Config, error) {
 		opt.signKey = signKey
 	}
 
+	if signKeysPath, exist := os.LookupEnv("KEYS_FILE"); exist {
+		logger.Info("KEYS_FILE env: %s", signKeysPath)
+		opt.signKeysPath = signKeysPath
+	}
+
+	if cryptoKey, exist := os.LookupEnv("CRYPTO_KEY"); exist {
+		logger.Info("CRYPTO_KEY env: %s", cryptoKey)
+		opt.cryptoKey = cryptoKey
+	}
+
+	if tlsCert, exist := os.LookupEnv("TLS_CERT"); exist {
+		logger.Info("TLS_CERT env: %s", tlsCert)
+		opt.tlsCert = tlsCert
+	}
+
+	if tlsKey, exist := os.LookupEnv("TLS_KEY"); exist {
+		logger.Info("TLS_KEY env: %s", tlsKey)
+		opt.tlsKey = tlsKey
+	}
+
+	if tlsClientCA, exist := os.LookupEnv("TLS_CLIENT_CA"); exist {
+		logger.Info("TLS_CLIENT_CA env: %s", tlsClientCA)
+		opt.tlsClientCA = tlsClientCA
+	}
+
+	if trustedSubnet, exist := os.LookupEnv("TRUSTED_SUBNET"); exist {
+		logger.Info("TRUSTED_SUBNET env: %s", trustedSubnet)
+		opt.trustedSubnet = trustedSubnet
+	}
+
+	if tokensPath, exist := os.LookupEnv("TOKENS_FILE"); exist {
+		logger.Info("TOKENS_FILE env: %s", tokensPath)
+		opt.tokensPath = tokensPath
+	}
+
+	if tokensDB, exist := os.LookupEnv("TOKENS_DB"); exist {
+		logger.Info("TOKENS_DB env: %s", tokensDB)
+		opt.tokensDB = tokensDB
+	}
+
+	if tenantSeries, exist := os.LookupEnv("TENANT_SERIES_LIMIT"); exist {
+		logger.Info("TENANT_SERIES_LIMIT env: %s", tenantSeries)
+		opt.tenantSeries = tenantSeries
+	}
+
+	if tenantQuotas, exist := os.LookupEnv("TENANT_QUOTAS"); exist {
+		logger.Info("TENANT_QUOTAS env: %s", tenantQuotas)
+		opt.tenantQuotas = tenantQuotas
+	}
+
+	if historyRetention, exist := os.LookupEnv("HISTORY_RETENTION"); exist {
+		logger.Info("HISTORY_RETENTION env: %s", historyRetention)
+		opt.historyRetention = historyRetention
+	}
+
+	if summaryWindow, exist := os.LookupEnv("SUMMARY_WINDOW"); exist {
+		logger.Info("SUMMARY_WINDOW env: %s", summaryWindow)
+		opt.summaryWindow = summaryWindow
+	}
+
+	if alertRulesPath, exist := os.LookupEnv("ALERT_RULES"); exist {
+		logger.Info("ALERT_RULES env: %s", alertRulesPath)
+		opt.alertRulesPath = alertRulesPath
+	}
+
+	if alertInterval, exist := os.LookupEnv("ALERT_INTERVAL"); exist {
+		logger.Info("ALERT_INTERVAL env: %s", alertInterval)
+		opt.alertInterval = alertInterval
+	}
+
+	if alertWebhooks, exist := os.LookupEnv("ALERT_WEBHOOKS"); exist {
+		logger.Info("ALERT_WEBHOOKS env: %s", alertWebhooks)
+		opt.alertWebhooks = alertWebhooks
+	}
+
+	/*Явно заданные флаги важнее всего - разбираем командную строку еще раз поверх файла и env*/
+	flag.Parse()
+
 	return newConfig(opt)
 }
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	base := Config{
+		Endpoint:      "localhost:8080",
+		LogLevel:      "info",
+		StoreInterval: 300,
+		AlertWebhooks: []string{"http://hook"},
+		TenantQuotas:  map[string]int{"team-a": 10},
+	}
+
+	tests := []struct {
+		name   string
+		change func(cfg *Config)
+		want   []string
+	}{
+		{"same", func(cfg *Config) {}, nil},
+		{"scalars", func(cfg *Config) {
+			cfg.LogLevel = "debug"
+			cfg.StoreInterval = 0
+		}, []string{"LogLevel", "StoreInterval"}},
+		{"slice", func(cfg *Config) { cfg.AlertWebhooks = []string{"http://other"} }, []string{"AlertWebhooks"}},
+		{"map", func(cfg *Config) { cfg.TenantQuotas = map[string]int{"team-a": 20} }, []string{"TenantQuotas"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cur := base
+			tt.change(&cur)
+			assert.Equal(t, tt.want, Diff(&base, &cur))
+		})
+	}
+}
+
+func TestNewConfigCryptoKeyGRPC(t *testing.T) {
+	valid := options{
+		storeInterval:    "300",
+		storeWAL:         "false",
+		restore:          "true",
+		tokensDB:         "false",
+		tenantSeries:     "0",
+		historyRetention: "0s",
+		summaryWindow:    "10m",
+		alertInterval:    "10",
+		cryptoKey:        "key.pem",
+		grpcEndpoint:     ":3200",
+	}
+
+	//Без TLS gRPC обновления шли бы открытыми в обход ключа
+	_, err := newConfig(valid)
+	assert.ErrorContains(t, err, "GRPC_ADDRESS and CRYPTO_KEY")
+
+	withTLS := valid
+	withTLS.tlsCert, withTLS.tlsKey = "cert.pem", "key.pem"
+	_, err = newConfig(withTLS)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"github.com/AntonPashechko/yametrix/internal/alerting"
+	"github.com/AntonPashechko/yametrix/internal/configfile"
+)
+
+// fileOptions - настройки из файла конфигурации, ключи как у переменных окружения
+type fileOptions struct {
+	Address           *configfile.Value `json:"address" yaml:"address"`
+	LogLevel          *configfile.Value `json:"log_level" yaml:"log_level"`
+	StatsdAddress     *configfile.Value `json:"statsd_address" yaml:"statsd_address"`
+	GRPCAddress       *configfile.Value `json:"grpc_address" yaml:"grpc_address"`
+	StoreInterval     *configfile.Value `json:"store_interval" yaml:"store_interval"`
+	FileStoragePath   *configfile.Value `json:"file_storage_path" yaml:"file_storage_path"`
+	StoreWAL          *configfile.Value `json:"store_wal" yaml:"store_wal"`
+	Restore           *configfile.Value `json:"restore" yaml:"restore"`
+	DatabaseDSN       *configfile.Value `json:"database_dsn" yaml:"database_dsn"`
+	Key               *configfile.Value `json:"key" yaml:"key"`
+	KeysFile          *configfile.Value `json:"keys_file" yaml:"keys_file"`
+	CryptoKey         *configfile.Value `json:"crypto_key" yaml:"crypto_key"`
+	TLSCert           *configfile.Value `json:"tls_cert" yaml:"tls_cert"`
+	TLSKey            *configfile.Value `json:"tls_key" yaml:"tls_key"`
+	TLSClientCA       *configfile.Value `json:"tls_client_ca" yaml:"tls_client_ca"`
+	TrustedSubnet     *configfile.Value `json:"trusted_subnet" yaml:"trusted_subnet"`
+	TokensFile        *configfile.Value `json:"tokens_file" yaml:"tokens_file"`
+	TokensDB          *configfile.Value `json:"tokens_db" yaml:"tokens_db"`
+	TenantSeriesLimit *configfile.Value `json:"tenant_series_limit" yaml:"tenant_series_limit"`
+	TenantQuotas      map[string]int    `json:"tenant_quotas" yaml:"tenant_quotas"`
+	HistoryRetention  *configfile.Value `json:"history_retention" yaml:"history_retention"`
+	SummaryWindow     *configfile.Value `json:"summary_window" yaml:"summary_window"`
+	AlertRulesFile    *configfile.Value `json:"alert_rules_file" yaml:"alert_rules_file"`
+	AlertInterval     *configfile.Value `json:"alert_interval" yaml:"alert_interval"`
+	AlertWebhooks     []string          `json:"alert_webhooks" yaml:"alert_webhooks"`
+
+	//Правила алертинга можно описать прямо в файле конфигурации
+	AlertRules []alerting.RuleConfig `json:"alert_rules" yaml:"alert_rules"`
+}
+
+// loadFile читает файл конфигурации и выставляет его значения флагам,
+// поверх потом идут env и еще раз флаги командной строки
+func loadFile(path string, opt *options) error {
+	var file fileOptions
+	if err := configfile.Load(path, &file); err != nil {
+		return err
+	}
+
+	values := []struct {
+		key   string
+		flag  string
+		value *configfile.Value
+	}{
+		{"address", "a", file.Address},
+		{"log_level", "log-level", file.LogLevel},
+		{"statsd_address", "su", file.StatsdAddress},
+		{"grpc_address", "g", file.GRPCAddress},
+		{"store_interval", "i", file.StoreInterval},
+		{"file_storage_path", "а", file.FileStoragePath},
+		{"store_wal", "wal", file.StoreWAL},
+		{"restore", "r", file.Restore},
+		{"database_dsn", "d", file.DatabaseDSN},
+		{"key", "k", file.Key},
+		{"keys_file", "kf", file.KeysFile},
+		{"crypto_key", "crypto-key", file.CryptoKey},
+		{"tls_cert", "tls-cert", file.TLSCert},
+		{"tls_key", "tls-key", file.TLSKey},
+		{"tls_client_ca", "tls-client-ca", file.TLSClientCA},
+		{"trusted_subnet", "t", file.TrustedSubnet},
+		{"tokens_file", "tokens", file.TokensFile},
+		{"tokens_db", "tokens-db", file.TokensDB},
+		{"tenant_series_limit", "tsl", file.TenantSeriesLimit},
+		{"tenant_quotas", "tq", configfile.Map(file.TenantQuotas)},
+		{"history_retention", "hr", file.HistoryRetention},
+		{"summary_window", "sw", file.SummaryWindow},
+		{"alert_rules_file", "ar", file.AlertRulesFile},
+		{"alert_interval", "ai", file.AlertInterval},
+		{"alert_webhooks", "aw", configfile.List(file.AlertWebhooks, ",")},
+	}
+
+	for _, v := range values {
+		if err := configfile.SetFlag(v.key, v.flag, v.value); err != nil {
+			return err
+		}
+	}
+
+	opt.alertRules = file.AlertRules
+
+	return nil
+}
@@ -0,0 +1,229 @@
+package grpcserver
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AntonPashechko/yametrix/internal/auth"
+	"github.com/AntonPashechko/yametrix/internal/logger"
+	pb "github.com/AntonPashechko/yametrix/internal/proto"
+	"github.com/AntonPashechko/yametrix/internal/sign"
+	"github.com/AntonPashechko/yametrix/internal/subnet"
+	"github.com/AntonPashechko/yametrix/internal/tenant"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	gproto "google.golang.org/protobuf/proto"
+)
+
+// LoggerInterceptor - аналог logger.Middleware для unary вызовов
+func LoggerInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+
+	resp, err := handler(ctx, req)
+
+	logger.Info("grpc method: %s, code: %s, duration: %s", info.FullMethod, status.Code(err), time.Since(start))
+
+	return resp, err
+}
+
+// SignInterceptor - аналог sign.Middleware, проверяет подпись запроса, если клиент ее прислал.
+// С keyring обновления без подписи ключом агента не принимаются
+func SignInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if !sign.Enabled() {
+		return handler(ctx, req)
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	var signValue, keyID string
+	if values := md.Get(pb.SignMetadataKey); len(values) != 0 {
+		signValue = values[0]
+	}
+	if ids := md.Get(pb.KeyIDMetadataKey); len(ids) != 0 {
+		keyID = ids[0]
+	}
+
+	if err := sign.RequireAgentKey(updateMethod(info.FullMethod), signValue, keyID); err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	if signValue == "" {
+		return handler(ctx, req)
+	}
+
+	msg, ok := req.(gproto.Message)
+	if !ok {
+		return nil, errorStatus(codes.Internal, fmt.Errorf("cannot sign request of type %T", req))
+	}
+
+	if err := verifySign(msg, keyID, signValue); err != nil {
+		return nil, errorStatus(codes.InvalidArgument, fmt.Errorf("bad request signature: %s", err))
+	}
+
+	return handler(ctx, req)
+}
+
+func verifySign(msg gproto.Message, keyID string, hash string) error {
+	signValue, err := hex.DecodeString(hash)
+	if err != nil {
+		return fmt.Errorf("bad sign value: %w", err)
+	}
+
+	data, err := pb.SignData(msg)
+	if err != nil {
+		return fmt.Errorf("cannot marshal request: %w", err)
+	}
+
+	_, err = sign.Verify(keyID, data, signValue)
+	return err
+}
+
+// updateMethod - метод обновления метрик, аналог маршрутов /update и /updates
+func updateMethod(method string) bool {
+	return method == pb.Metrics_UpdateMetric_FullMethodName || method == pb.Metrics_UpdateMetrics_FullMethodName
+}
+
+// methodScope - область доступа метода, аналог выбора по пути в auth.Middleware
+func methodScope(method string) string {
+	if updateMethod(method) {
+		return auth.ScopeWrite
+	}
+	return auth.ScopeRead
+}
+
+// SubnetInterceptor - аналог subnet.Middleware, обновления принимаем только от агентов из доверенной подсети.
+// IP агент передает в метаданных x-real-ip
+func SubnetInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	trusted := subnet.Trusted()
+	if trusted == nil || !updateMethod(info.FullMethod) {
+		return handler(ctx, req)
+	}
+
+	var realIP string
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(subnet.MetadataKey); len(values) != 0 {
+		realIP = values[0]
+	}
+
+	if !subnet.Contains(realIP) {
+		return nil, errorStatus(codes.PermissionDenied, fmt.Errorf("agent ip %q is not in trusted subnet %s", realIP, trusted))
+	}
+
+	return handler(ctx, req)
+}
+
+// serverStream - поток с подмененным контекстом, в нем владелец токена и тенант
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (m *serverStream) Context() context.Context {
+	return m.ctx
+}
+
+// httpCodeStatus переводит HTTP код ошибки auth и tenant в код gRPC
+func httpCodeStatus(code int) codes.Code {
+	switch code {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	default:
+		return codes.Internal
+	}
+}
+
+// authorize проверяет bearer токен из метаданных authorization, владельца кладет в контекст
+func authorize(ctx context.Context, method string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return nil, errorStatus(codes.Unauthenticated, fmt.Errorf("%s: no token", method))
+	}
+
+	scheme, token, found := strings.Cut(values[0], " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return nil, errorStatus(codes.Unauthenticated, fmt.Errorf("%s: expected bearer token", method))
+	}
+
+	identity, code, err := auth.Authorize(ctx, strings.TrimSpace(token), methodScope(method))
+	if err != nil {
+		return nil, errorStatus(httpCodeStatus(code), fmt.Errorf("%s: %w", method, err))
+	}
+
+	logger.Info("grpc method: %s, identity: %s", method, identity.Name)
+	return auth.WithIdentity(ctx, identity), nil
+}
+
+// resolveTenant - аналог tenant.Middleware, тенант из токена или метаданных x-tenant
+func resolveTenant(ctx context.Context, method string) (context.Context, error) {
+	var header string
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(tenant.MetadataKey); len(values) != 0 {
+		header = values[0]
+	}
+
+	name, code, err := tenant.Resolve(auth.FromContext(ctx), header)
+	if err != nil {
+		return nil, errorStatus(httpCodeStatus(code), fmt.Errorf("%s: %w", method, err))
+	}
+
+	return tenant.WithTenant(ctx, name), nil
+}
+
+// AuthInterceptor - аналог auth.Middleware для unary вызовов
+func AuthInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if auth.MetricsTokens == nil {
+		return handler(ctx, req)
+	}
+
+	ctx, err := authorize(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+// AuthStreamInterceptor - то же для потоковых вызовов, ListMetrics
+func AuthStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if auth.MetricsTokens == nil {
+		return handler(srv, ss)
+	}
+
+	ctx, err := authorize(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+
+	return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+}
+
+// TenantInterceptor кладет тенанта в контекст, должен стоять после AuthInterceptor
+func TenantInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := resolveTenant(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+// TenantStreamInterceptor - то же для потоковых вызовов
+func TenantStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := resolveTenant(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+
+	return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+}
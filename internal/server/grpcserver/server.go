@@ -0,0 +1,178 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/AntonPashechko/yametrix/internal/logger"
+	"github.com/AntonPashechko/yametrix/internal/models"
+	pb "github.com/AntonPashechko/yametrix/internal/proto"
+	"github.com/AntonPashechko/yametrix/internal/server/restorer"
+	"github.com/AntonPashechko/yametrix/internal/storage"
+	"github.com/AntonPashechko/yametrix/internal/tenant"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	_ "google.golang.org/grpc/encoding/gzip" //регистрирует декомпрессию запросов агента
+	"google.golang.org/grpc/status"
+)
+
+// MetricsServer - gRPC API метрик, работает с тем же хранилищем что и http хэндлеры
+type MetricsServer struct {
+	pb.UnimplementedMetricsServer
+	storage storage.MetricsStorage
+}
+
+func NewMetricsServer(storage storage.MetricsStorage) *MetricsServer {
+	return &MetricsServer{
+		storage: storage,
+	}
+}
+
+func (m *MetricsServer) Register(server *grpc.Server) {
+	pb.RegisterMetricsServer(server, m)
+}
+
+func errorStatus(code codes.Code, err error) error {
+	logger.Error(err.Error())
+	return status.Error(code, err.Error())
+}
+
+// updateErrorCode - код ответа на ошибку сохранения метрики
+func updateErrorCode(err error) codes.Code {
+	//Несовпадение корзин гистограмм - ошибка клиента
+	if errors.Is(err, models.ErrHistogramBounds) {
+		return codes.InvalidArgument
+	}
+
+	if errors.Is(err, tenant.ErrQuotaExceeded) {
+		return codes.ResourceExhausted
+	}
+
+	return codes.Internal
+}
+
+func (m *MetricsServer) UpdateMetric(ctx context.Context, req *pb.UpdateMetricRequest) (*pb.UpdateMetricResponse, error) {
+	if req.GetMetric() == nil {
+		return nil, errorStatus(codes.InvalidArgument, fmt.Errorf("metric is empty"))
+	}
+
+	metric := pb.ToDTO(req.GetMetric())
+	if err := models.ValidateMetric(metric); err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	res := &metric
+	var err error
+
+	switch metric.MType {
+	case models.GaugeType:
+		err = m.storage.SetGauge(ctx, metric)
+	case models.CounterType:
+		res, err = m.storage.AddCounter(ctx, metric)
+	case models.HistogramType:
+		res, err = m.storage.AddHistogram(ctx, metric)
+	case models.SummaryType:
+		if err = m.storage.AddSummary(ctx, metric); err == nil {
+			res, err = m.storage.GetSummary(ctx, metric.SeriesKey(), models.DefaultQuantiles)
+		}
+	}
+
+	if err != nil {
+		return nil, errorStatus(updateErrorCode(err), fmt.Errorf("cannot update %s %s: %s", metric.MType, metric.ID, err))
+	}
+
+	restorer.Store()
+
+	return &pb.UpdateMetricResponse{Metric: pb.FromDTO(*res)}, nil
+}
+
+func (m *MetricsServer) UpdateMetrics(ctx context.Context, req *pb.UpdateMetricsRequest) (*pb.UpdateMetricsResponse, error) {
+	metrics := make([]models.MetricDTO, 0, len(req.GetMetrics()))
+
+	for _, msg := range req.GetMetrics() {
+		metric := pb.ToDTO(msg)
+		if err := models.ValidateMetric(metric); err != nil {
+			return nil, errorStatus(codes.InvalidArgument, fmt.Errorf("bad metric %s: %s", metric.ID, err))
+		}
+		metrics = append(metrics, metric)
+	}
+
+	if err := m.storage.AcceptMetricsBatch(ctx, metrics); err != nil {
+		return nil, errorStatus(updateErrorCode(err), fmt.Errorf("cannot accept metrics batch: %s", err))
+	}
+
+	restorer.Store()
+
+	return &pb.UpdateMetricsResponse{}, nil
+}
+
+func (m *MetricsServer) GetMetric(ctx context.Context, req *pb.GetMetricRequest) (*pb.GetMetricResponse, error) {
+	if req.GetMetric() == nil {
+		return nil, errorStatus(codes.InvalidArgument, fmt.Errorf("metric is empty"))
+	}
+
+	metric := pb.ToDTO(req.GetMetric())
+	if err := models.ValidateLabels(metric.Labels); err != nil {
+		return nil, errorStatus(codes.InvalidArgument, fmt.Errorf("bad labels: %s", err))
+	}
+
+	var res *models.MetricDTO
+	var err error
+
+	switch metric.MType {
+	case models.GaugeType:
+		res, err = m.storage.GetGauge(ctx, metric.SeriesKey())
+	case models.CounterType:
+		res, err = m.storage.GetCounter(ctx, metric.SeriesKey())
+	case models.HistogramType:
+		res, err = m.storage.GetHistogram(ctx, metric.SeriesKey())
+	case models.SummaryType:
+		quantiles := models.DefaultQuantiles
+		if metric.Quantile != nil {
+			if *metric.Quantile < 0 || *metric.Quantile > 1 {
+				return nil, errorStatus(codes.InvalidArgument, fmt.Errorf("bad quantile %v", *metric.Quantile))
+			}
+			quantiles = []float64{*metric.Quantile}
+		}
+
+		res, err = m.storage.GetSummary(ctx, metric.SeriesKey(), quantiles)
+
+		//Запрошенный квантиль отдаем в value
+		if err == nil && metric.Quantile != nil {
+			res.Quantile = metric.Quantile
+			if value, ok := res.Summary.QuantileValue(*metric.Quantile); ok {
+				res.SetValue(value)
+			}
+		}
+	default:
+		return nil, errorStatus(codes.InvalidArgument, fmt.Errorf("unknown metric type: %s", metric.MType))
+	}
+
+	if err != nil {
+		return nil, errorStatus(codes.NotFound, fmt.Errorf("cannot get metric: %s", err))
+	}
+
+	return &pb.GetMetricResponse{Metric: pb.FromDTO(*res)}, nil
+}
+
+func (m *MetricsServer) ListMetrics(req *pb.ListMetricsRequest, stream pb.Metrics_ListMetricsServer) error {
+	filter := req.GetLabels()
+	if err := models.ValidateLabels(filter); err != nil {
+		return errorStatus(codes.InvalidArgument, fmt.Errorf("bad labels filter: %s", err))
+	}
+
+	metrics, err := m.storage.GetMetrics(stream.Context(), filter)
+	if err != nil {
+		return errorStatus(codes.Internal, fmt.Errorf("cannot get metrics: %s", err))
+	}
+
+	//Отдаем по одной, клиент может обрабатывать их не дожидаясь всего списка
+	for _, metric := range metrics {
+		if err := stream.Send(pb.FromDTO(metric)); err != nil {
+			return fmt.Errorf("cannot send metric %s: %w", metric.ID, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,263 @@
+package grpcserver
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AntonPashechko/yametrix/internal/auth"
+	"github.com/AntonPashechko/yametrix/internal/models"
+	pb "github.com/AntonPashechko/yametrix/internal/proto"
+	"github.com/AntonPashechko/yametrix/internal/sign"
+	"github.com/AntonPashechko/yametrix/internal/storage/memstorage"
+	"github.com/AntonPashechko/yametrix/internal/subnet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func newTestClient(t *testing.T) pb.MetricsClient {
+	listener := bufconn.Listen(1024 * 1024)
+
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(LoggerInterceptor, SubnetInterceptor, AuthInterceptor, TenantInterceptor, SignInterceptor),
+		grpc.ChainStreamInterceptor(AuthStreamInterceptor, TenantStreamInterceptor))
+	NewMetricsServer(memstorage.NewStorage()).Register(server)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return pb.NewMetricsClient(conn)
+}
+
+func TestUpdateMetric(t *testing.T) {
+	client := newTestClient(t)
+
+	tests := []struct {
+		name     string
+		metric   models.MetricDTO
+		wantCode codes.Code
+		check    func(t *testing.T, res *pb.Metric)
+	}{
+		{
+			name:     "gauge",
+			metric:   models.NewGaugeMetric("Alloc", 1.5),
+			wantCode: codes.OK,
+			check: func(t *testing.T, res *pb.Metric) {
+				assert.Equal(t, 1.5, res.GetValue())
+			},
+		},
+		{
+			name:     "counter",
+			metric:   models.NewCounterMetric("PollCount", 3),
+			wantCode: codes.OK,
+			check: func(t *testing.T, res *pb.Metric) {
+				assert.Equal(t, int64(3), res.GetDelta())
+			},
+		},
+		{
+			name:     "summary",
+			metric:   models.NewSummaryMetric("latency", 1, 2, 3),
+			wantCode: codes.OK,
+			check: func(t *testing.T, res *pb.Metric) {
+				assert.Equal(t, uint64(3), res.GetSummary().GetCount())
+			},
+		},
+		{
+			name:     "gauge_without_value",
+			metric:   models.MetricDTO{ID: "Alloc", MType: models.GaugeType},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "unknown_type",
+			metric:   models.MetricDTO{ID: "Alloc", MType: "unknown"},
+			wantCode: codes.InvalidArgument,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := client.UpdateMetric(context.Background(), &pb.UpdateMetricRequest{Metric: pb.FromDTO(tt.metric)})
+			require.Equal(t, tt.wantCode, status.Code(err))
+			if tt.check != nil {
+				tt.check(t, res.GetMetric())
+			}
+		})
+	}
+}
+
+func TestUpdateMetricsAndGet(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+
+	counter := models.NewCounterMetric("PollCount", 2)
+	counter.Labels = map[string]string{"host": "a"}
+
+	req := &pb.UpdateMetricsRequest{
+		Metrics: []*pb.Metric{
+			pb.FromDTO(models.NewGaugeMetric("Alloc", 10)),
+			pb.FromDTO(counter),
+			pb.FromDTO(counter),
+		},
+	}
+	_, err := client.UpdateMetrics(ctx, req)
+	require.NoError(t, err)
+
+	res, err := client.GetMetric(ctx, &pb.GetMetricRequest{Metric: &pb.Metric{
+		Id:     "PollCount",
+		Type:   models.CounterType,
+		Labels: map[string]string{"host": "a"},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), res.GetMetric().GetDelta())
+
+	_, err = client.GetMetric(ctx, &pb.GetMetricRequest{Metric: &pb.Metric{Id: "PollCount", Type: models.CounterType}})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	stream, err := client.ListMetrics(ctx, &pb.ListMetricsRequest{Labels: map[string]string{"host": "a"}})
+	require.NoError(t, err)
+
+	var ids []string
+	for {
+		metric, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		ids = append(ids, metric.GetId())
+	}
+	assert.Equal(t, []string{"PollCount"}, ids)
+}
+
+func TestSignInterceptor(t *testing.T) {
+	sign.Initialize("", []byte("secret"))
+	defer sign.Initialize("", nil)
+
+	client := newTestClient(t)
+
+	req := &pb.UpdateMetricsRequest{
+		Metrics: []*pb.Metric{pb.FromDTO(models.NewGaugeMetric("Alloc", 10))},
+	}
+	data, err := pb.SignData(req)
+	require.NoError(t, err)
+	signValue, err := sign.Shared().CreateSign(data)
+	require.NoError(t, err)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), pb.SignMetadataKey, hex.EncodeToString(signValue))
+	_, err = client.UpdateMetrics(ctx, req)
+	assert.NoError(t, err)
+
+	ctx = metadata.AppendToOutgoingContext(context.Background(), pb.SignMetadataKey, "00")
+	_, err = client.UpdateMetrics(ctx, req)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestSignInterceptorKeyring(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[{"id": "host-1", "key": "agent-secret"}]`), 0600))
+	require.NoError(t, sign.InitializeKeyring(path))
+	defer func() { sign.MetricsKeyring = nil }()
+
+	client := newTestClient(t)
+
+	req := &pb.UpdateMetricsRequest{
+		Metrics: []*pb.Metric{pb.FromDTO(models.NewGaugeMetric("Alloc", 10))},
+	}
+	data, err := pb.SignData(req)
+	require.NoError(t, err)
+	signValue, err := sign.NewSigner("host-1", []byte("agent-secret")).CreateSign(data)
+	require.NoError(t, err)
+
+	//Без подписи ключом агента обновления не принимаются
+	_, err = client.UpdateMetrics(context.Background(), req)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), pb.SignMetadataKey, hex.EncodeToString(signValue))
+	_, err = client.UpdateMetrics(ctx, req)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	ctx = metadata.AppendToOutgoingContext(ctx, pb.KeyIDMetadataKey, "host-1")
+	_, err = client.UpdateMetrics(ctx, req)
+	assert.NoError(t, err)
+}
+
+func TestSubnetInterceptor(t *testing.T) {
+	require.NoError(t, subnet.Initialize("192.168.1.0/24"))
+	defer subnet.Initialize("")
+
+	client := newTestClient(t)
+	req := &pb.UpdateMetricRequest{Metric: pb.FromDTO(models.NewGaugeMetric("Alloc", 1))}
+
+	_, err := client.UpdateMetric(context.Background(), req)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), subnet.MetadataKey, "10.0.0.1")
+	_, err = client.UpdateMetric(ctx, req)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	ctx = metadata.AppendToOutgoingContext(context.Background(), subnet.MetadataKey, "192.168.1.5")
+	_, err = client.UpdateMetric(ctx, req)
+	assert.NoError(t, err)
+
+	//Чтение подсетью не ограничивается
+	_, err = client.GetMetric(context.Background(), &pb.GetMetricRequest{Metric: &pb.Metric{Id: "Alloc", Type: models.GaugeType}})
+	assert.NoError(t, err)
+}
+
+func TestAuthInterceptor(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[
+		{"name": "agent", "token": "agent-token", "scopes": ["write"]},
+		{"name": "reader", "token": "reader-token", "scopes": ["read"]}
+	]`), 0600))
+	store, err := auth.LoadFileStore(path)
+	require.NoError(t, err)
+	auth.Initialize(store)
+	defer func() { auth.MetricsTokens = nil }()
+
+	client := newTestClient(t)
+
+	withToken := func(token string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+	}
+	req := &pb.UpdateMetricRequest{Metric: pb.FromDTO(models.NewGaugeMetric("Alloc", 1))}
+
+	_, err = client.UpdateMetric(context.Background(), req)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = client.UpdateMetric(withToken("unknown"), req)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = client.UpdateMetric(withToken("reader-token"), req)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = client.UpdateMetric(withToken("agent-token"), req)
+	assert.NoError(t, err)
+
+	//Потоковый вызов проверяется отдельным интерсептором
+	stream, err := client.ListMetrics(withToken("agent-token"), &pb.ListMetricsRequest{})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	stream, err = client.ListMetrics(withToken("reader-token"), &pb.ListMetricsRequest{})
+	require.NoError(t, err)
+	metric, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "Alloc", metric.GetId())
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/AntonPashechko/yametrix/internal/alerting"
+	"github.com/AntonPashechko/yametrix/internal/logger"
+	"github.com/go-chi/chi/v5"
+)
+
+type AlertsHandler struct {
+	engine *alerting.Engine
+}
+
+func NewAlertsHandler(engine *alerting.Engine) AlertsHandler {
+	return AlertsHandler{
+		engine: engine,
+	}
+}
+
+func (m *AlertsHandler) Register(router *chi.Mux) {
+	router.Get("/alerts", m.getAlerts)
+}
+
+func (m *AlertsHandler) getAlerts(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(m.engine.ActiveAlerts()); err != nil {
+		logger.Error(fmt.Sprintf("error encoding response: %s", err))
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
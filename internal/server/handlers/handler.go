@@ -2,15 +2,20 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/AntonPashechko/yametrix/internal/logger"
 	"github.com/AntonPashechko/yametrix/internal/models"
+	"github.com/AntonPashechko/yametrix/internal/prometheus"
 	"github.com/AntonPashechko/yametrix/internal/server/restorer"
 	"github.com/AntonPashechko/yametrix/internal/storage"
+	"github.com/AntonPashechko/yametrix/internal/subnet"
+	"github.com/AntonPashechko/yametrix/internal/tenant"
 	"github.com/AntonPashechko/yametrix/pkg/utils"
 	"github.com/go-chi/chi/v5"
 )
@@ -27,18 +32,21 @@ func NewMetricsHandler(storage storage.MetricsStorage) MetricsHandler {
 
 func (m *MetricsHandler) Register(router *chi.Mux) {
 	router.Get("/", m.getAll)
+	router.Get("/metrics", m.getPrometheus)
 
 	router.Route("/ping", func(router chi.Router) {
 		router.Get("/", m.pingDB)
 	})
 
 	router.Route("/update", func(router chi.Router) {
+		router.Use(subnet.Middleware)
 		router.Use(restorer.Middleware)
 		router.Post("/", m.updateJSON)
 		router.Post("/{type}/{name}/{value}", m.update)
 	})
 
 	router.Route("/updates", func(router chi.Router) {
+		router.Use(subnet.Middleware)
 		router.Use(restorer.Middleware)
 		router.Post("/", m.updateBatchJSON)
 	})
@@ -47,6 +55,10 @@ func (m *MetricsHandler) Register(router *chi.Mux) {
 		router.Post("/", m.getJSON)
 		router.Get("/{type}/{name}", m.get)
 	})
+
+	router.Route("/history", func(router chi.Router) {
+		router.Get("/{type}/{name}", m.getHistory)
+	})
 }
 
 func (m *MetricsHandler) errorRespond(w http.ResponseWriter, code int, err error) {
@@ -54,8 +66,79 @@ func (m *MetricsHandler) errorRespond(w http.ResponseWriter, code int, err error
 	w.WriteHeader(code)
 }
 
+// updateErrorCode - код ответа на ошибку сохранения метрики
+func updateErrorCode(err error) int {
+	//Несовпадение корзин гистограмм - ошибка клиента
+	if errors.Is(err, models.ErrHistogramBounds) {
+		return http.StatusBadRequest
+	}
+
+	//Тенант исчерпал квоту на количество рядов
+	if errors.Is(err, tenant.ErrQuotaExceeded) {
+		return http.StatusTooManyRequests
+	}
+
+	return http.StatusInternalServerError
+}
+
+// validateErrorCode - код ответа на метрику, не прошедшую проверку
+func validateErrorCode(err error) int {
+	if errors.Is(err, models.ErrUnknownType) {
+		return http.StatusNotImplemented
+	}
+
+	return http.StatusBadRequest
+}
+
+// validateQuantile проверяет запрошенный квантиль, допустимы значения от 0 до 1
+func validateQuantile(quantile float64) error {
+	if quantile < 0 || quantile > 1 {
+		return fmt.Errorf("bad quantile %v", quantile)
+	}
+
+	return nil
+}
+
+func parseQuantile(value string) (float64, error) {
+	quantile, err := utils.StrToFloat64(value)
+	if err != nil {
+		return 0, fmt.Errorf("bad quantile %s", value)
+	}
+
+	return quantile, validateQuantile(quantile)
+}
+
+// queryLabels собирает метки из параметров запроса, кроме служебных
+func queryLabels(r *http.Request, exclude ...string) (map[string]string, error) {
+	query := r.URL.Query()
+	for _, name := range exclude {
+		query.Del(name)
+	}
+
+	if len(query) == 0 {
+		return nil, nil
+	}
+
+	labels := make(map[string]string, len(query))
+	for name := range query {
+		labels[name] = query.Get(name)
+	}
+
+	if err := models.ValidateLabels(labels); err != nil {
+		return nil, err
+	}
+
+	return labels, nil
+}
+
 func (m *MetricsHandler) getAll(w http.ResponseWriter, r *http.Request) {
-	list, err := m.storage.GetMetricsList(r.Context())
+	filter, err := queryLabels(r)
+	if err != nil {
+		m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("bad labels filter: %s", err))
+		return
+	}
+
+	list, err := m.storage.GetMetricsList(r.Context(), filter)
 	if err != nil {
 		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot set metrics list: %s", err))
 		return
@@ -65,23 +148,72 @@ func (m *MetricsHandler) getAll(w http.ResponseWriter, r *http.Request) {
 	io.WriteString(w, strings.Join(list, ", "))
 }
 
+func (m *MetricsHandler) getPrometheus(w http.ResponseWriter, r *http.Request) {
+	filter, err := queryLabels(r)
+	if err != nil {
+		m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("bad labels filter: %s", err))
+		return
+	}
+
+	metrics, err := m.storage.GetMetrics(r.Context(), filter)
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot get metrics: %s", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", prometheus.ContentType)
+	if err := prometheus.WriteText(w, metrics); err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("error encoding response: %s", err))
+	}
+}
+
 func (m *MetricsHandler) get(w http.ResponseWriter, r *http.Request) {
 	mType := chi.URLParam(r, "type")
 	name := chi.URLParam(r, "name")
 
-	var err error
+	labels, err := queryLabels(r, "quantile")
+	if err != nil {
+		m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("bad labels: %s", err))
+		return
+	}
+	key := models.SeriesKey(name, labels)
 
 	switch mType {
 	case models.GaugeType:
-		if metric, err := m.storage.GetGauge(r.Context(), name); err == nil {
+		if metric, err := m.storage.GetGauge(r.Context(), key); err == nil {
 			w.Write([]byte(utils.Float64ToStr(*metric.Value)))
 			return
 		}
 	case models.CounterType:
-		if metric, err := m.storage.GetCounter(r.Context(), name); err == nil {
+		if metric, err := m.storage.GetCounter(r.Context(), key); err == nil {
 			w.Write([]byte(utils.Int64ToStr(*metric.Delta)))
 			return
 		}
+	case models.HistogramType:
+		//У гистограммы нет одного значения, отдаем ее целиком
+		if metric, err := m.storage.GetHistogram(r.Context(), key); err == nil {
+			json.NewEncoder(w).Encode(metric.Histogram)
+			return
+		}
+	case models.SummaryType:
+		//Без квантиля отдаем summary целиком
+		if q := r.URL.Query().Get("quantile"); q != "" {
+			quantile, err := parseQuantile(q)
+			if err != nil {
+				m.errorRespond(w, http.StatusBadRequest, err)
+				return
+			}
+
+			if metric, err := m.storage.GetSummary(r.Context(), key, []float64{quantile}); err == nil {
+				if value, ok := metric.Summary.QuantileValue(quantile); ok {
+					w.Write([]byte(utils.Float64ToStr(value)))
+					return
+				}
+			}
+		} else if metric, err := m.storage.GetSummary(r.Context(), key, models.DefaultQuantiles); err == nil {
+			json.NewEncoder(w).Encode(metric.Summary)
+			return
+		}
 	}
 
 	m.errorRespond(w, http.StatusNotFound, fmt.Errorf("cannot get metric: %s", err))
@@ -91,15 +223,28 @@ func (m *MetricsHandler) update(w http.ResponseWriter, r *http.Request) {
 	mType := chi.URLParam(r, "type")
 	name := chi.URLParam(r, "name")
 
+	if err := models.ValidateID(name); err != nil {
+		m.errorRespond(w, http.StatusBadRequest, err)
+		return
+	}
+
+	labels, err := queryLabels(r)
+	if err != nil {
+		m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("bad labels: %s", err))
+		return
+	}
+
 	switch mType {
 	case models.GaugeType:
 		if value, err := utils.StrToFloat64(chi.URLParam(r, "value")); err != nil {
 			m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("bad gauge value: %s", chi.URLParam(r, "value")))
 			return
 		} else {
-			err := m.storage.SetGauge(r.Context(), models.NewGaugeMetric(name, value))
+			metric := models.NewGaugeMetric(name, value)
+			metric.Labels = labels
+			err := m.storage.SetGauge(r.Context(), metric)
 			if err != nil {
-				m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot set gauge: %s", err))
+				m.errorRespond(w, updateErrorCode(err), fmt.Errorf("cannot set gauge: %s", err))
 				return
 			}
 			w.WriteHeader(http.StatusOK)
@@ -110,9 +255,11 @@ func (m *MetricsHandler) update(w http.ResponseWriter, r *http.Request) {
 			m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("bad counter value: %s", chi.URLParam(r, "value")))
 			return
 		} else {
-			_, err := m.storage.AddCounter(r.Context(), models.NewCounterMetric(name, value))
+			metric := models.NewCounterMetric(name, value)
+			metric.Labels = labels
+			_, err := m.storage.AddCounter(r.Context(), metric)
 			if err != nil {
-				m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot add counter: %s", err))
+				m.errorRespond(w, updateErrorCode(err), fmt.Errorf("cannot add counter: %s", err))
 				return
 			}
 			w.WriteHeader(http.StatusOK)
@@ -131,19 +278,51 @@ func (m *MetricsHandler) getJSON(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := models.ValidateLabels(metric.Labels); err != nil {
+		m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("bad labels: %s", err))
+		return
+	}
+
 	var res *models.MetricDTO
 
 	switch metric.MType {
 	case models.GaugeType:
-		if res, err = m.storage.GetGauge(r.Context(), metric.ID); err != nil {
+		if res, err = m.storage.GetGauge(r.Context(), metric.SeriesKey()); err != nil {
 			m.errorRespond(w, http.StatusNotFound, fmt.Errorf("cannot get metric: %s", err))
 			return
 		}
 	case models.CounterType:
-		if res, err = m.storage.GetCounter(r.Context(), metric.ID); err != nil {
+		if res, err = m.storage.GetCounter(r.Context(), metric.SeriesKey()); err != nil {
+			m.errorRespond(w, http.StatusNotFound, fmt.Errorf("cannot get metric: %s", err))
+			return
+		}
+	case models.HistogramType:
+		if res, err = m.storage.GetHistogram(r.Context(), metric.SeriesKey()); err != nil {
+			m.errorRespond(w, http.StatusNotFound, fmt.Errorf("cannot get metric: %s", err))
+			return
+		}
+	case models.SummaryType:
+		quantiles := models.DefaultQuantiles
+		if metric.Quantile != nil {
+			if err := validateQuantile(*metric.Quantile); err != nil {
+				m.errorRespond(w, http.StatusBadRequest, err)
+				return
+			}
+			quantiles = []float64{*metric.Quantile}
+		}
+
+		if res, err = m.storage.GetSummary(r.Context(), metric.SeriesKey(), quantiles); err != nil {
 			m.errorRespond(w, http.StatusNotFound, fmt.Errorf("cannot get metric: %s", err))
 			return
 		}
+
+		//Запрошенный квантиль отдаем в value
+		if metric.Quantile != nil {
+			res.Quantile = metric.Quantile
+			if value, ok := res.Summary.QuantileValue(*metric.Quantile); ok {
+				res.SetValue(value)
+			}
+		}
 	default:
 		m.errorRespond(w, http.StatusNotFound, fmt.Errorf("unknown metric type: %s", metric.MType))
 		return
@@ -163,15 +342,16 @@ func (m *MetricsHandler) updateJSON(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := models.ValidateMetric(metric); err != nil {
+		m.errorRespond(w, validateErrorCode(err), fmt.Errorf("bad metric %s: %s", metric.ID, err))
+		return
+	}
+
 	switch metric.MType {
 	case models.GaugeType:
-		if metric.Value == nil {
-			m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("gauge value is nil"))
-			return
-		}
 		err := m.storage.SetGauge(r.Context(), metric)
 		if err != nil {
-			m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot set gauge: %s", err))
+			m.errorRespond(w, updateErrorCode(err), fmt.Errorf("cannot set gauge: %s", err))
 			return
 		}
 
@@ -181,13 +361,38 @@ func (m *MetricsHandler) updateJSON(w http.ResponseWriter, r *http.Request) {
 		}
 
 	case models.CounterType:
-		if metric.Delta == nil {
-			m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("counter delta is nil"))
+		res, err := m.storage.AddCounter(r.Context(), metric)
+		if err != nil {
+			m.errorRespond(w, updateErrorCode(err), fmt.Errorf("cannot add counter: %s", err))
 			return
 		}
-		res, err := m.storage.AddCounter(r.Context(), metric)
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("error encoding response: %s", err))
+		}
+
+	case models.SummaryType:
+		if err := m.storage.AddSummary(r.Context(), metric); err != nil {
+			m.errorRespond(w, updateErrorCode(err), fmt.Errorf("cannot add summary: %s", err))
+			return
+		}
+
+		res, err := m.storage.GetSummary(r.Context(), metric.SeriesKey(), models.DefaultQuantiles)
+		if err != nil {
+			m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot get summary: %s", err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("error encoding response: %s", err))
+		}
+
+	case models.HistogramType:
+		res, err := m.storage.AddHistogram(r.Context(), metric)
 		if err != nil {
-			m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot add counter: %s", err))
+			m.errorRespond(w, updateErrorCode(err), fmt.Errorf("cannot add histogram: %s", err))
 			return
 		}
 
@@ -208,12 +413,76 @@ func (m *MetricsHandler) updateBatchJSON(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	for _, metric := range metrics {
+		if err := models.ValidateMetric(metric); err != nil {
+			m.errorRespond(w, validateErrorCode(err), fmt.Errorf("bad metric %s: %s", metric.ID, err))
+			return
+		}
+	}
+
 	if err := m.storage.AcceptMetricsBatch(r.Context(), metrics); err != nil {
-		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot accept metrics batch: %s", err))
+		m.errorRespond(w, updateErrorCode(err), fmt.Errorf("cannot accept metrics batch: %s", err))
 		return
 	}
 }
 
+// parseTimeParam разбирает границу интервала - RFC3339 или unix время в секундах
+func parseTimeParam(value string, def time.Time) (time.Time, error) {
+	if value == "" {
+		return def, nil
+	}
+
+	if ts, err := time.Parse(time.RFC3339, value); err == nil {
+		return ts, nil
+	}
+
+	sec, err := utils.StrToInt64(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("bad time value %s", value)
+	}
+
+	return time.Unix(sec, 0), nil
+}
+
+func (m *MetricsHandler) getHistory(w http.ResponseWriter, r *http.Request) {
+	mType := chi.URLParam(r, "type")
+	name := chi.URLParam(r, "name")
+
+	if mType != models.GaugeType && mType != models.CounterType {
+		m.errorRespond(w, http.StatusNotImplemented, fmt.Errorf("unknown metric type %s", mType))
+		return
+	}
+
+	from, err := parseTimeParam(r.URL.Query().Get("from"), time.Time{})
+	if err != nil {
+		m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("bad param from: %s", err))
+		return
+	}
+
+	to, err := parseTimeParam(r.URL.Query().Get("to"), time.Now())
+	if err != nil {
+		m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("bad param to: %s", err))
+		return
+	}
+
+	labels, err := queryLabels(r, "from", "to")
+	if err != nil {
+		m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("bad labels: %s", err))
+		return
+	}
+
+	points, err := m.storage.GetHistory(r.Context(), mType, models.SeriesKey(name, labels), from, to)
+	if err != nil {
+		m.errorRespond(w, http.StatusNotFound, fmt.Errorf("cannot get metric history: %s", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(points); err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("error encoding response: %s", err))
+	}
+}
+
 func (m *MetricsHandler) pingDB(w http.ResponseWriter, r *http.Request) {
 
 	if err := m.storage.PingStorage(r.Context()); err != nil {
@@ -1,11 +1,15 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/AntonPashechko/yametrix/internal/models"
 	memstorage "github.com/AntonPashechko/yametrix/internal/storage/memstorage"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-resty/resty/v2"
@@ -121,3 +125,247 @@ func TestHandler_updateJson(t *testing.T) {
 		})
 	}
 }
+
+func TestHandler_getHistory(t *testing.T) {
+	storage := memstorage.NewStorage()
+	storage.SetHistoryRetention(time.Hour)
+	router := chi.NewRouter()
+	metricsHandler := NewMetricsHandler(storage)
+	metricsHandler.Register(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	for _, url := range []string{"/update/gauge/testGauge/1", "/update/gauge/testGauge/2", "/update/counter/testCounter/5"} {
+		resp := testRequest(t, ts, "POST", url)
+		resp.Body.Close()
+	}
+
+	tests := []struct {
+		name         string
+		url          string
+		expectedCode int
+		expectedLen  int
+	}{
+		{"gauge history", "/history/gauge/testGauge", http.StatusOK, 2},
+		{"counter history", "/history/counter/testCounter", http.StatusOK, 1},
+		{"empty interval", "/history/gauge/testGauge?to=1", http.StatusOK, 0},
+		{"bad from", "/history/gauge/testGauge?from=yesterday", http.StatusBadRequest, 0},
+		{"unknown metric", "/history/gauge/unknown", http.StatusNotFound, 0},
+		{"unknown type", "/history/unknown/testGauge", http.StatusNotImplemented, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := testRequestWithBody(t, ts, "GET", tt.url, "")
+			assert.Equal(t, tt.expectedCode, resp.StatusCode(), "Код ответа не совпадает с ожидаемым")
+
+			if tt.expectedCode == http.StatusOK {
+				var points []models.MetricPoint
+				require.NoError(t, json.Unmarshal(resp.Body(), &points))
+				assert.Len(t, points, tt.expectedLen)
+			}
+		})
+	}
+}
+
+func TestHandler_labels(t *testing.T) {
+	storage := memstorage.NewStorage()
+	router := chi.NewRouter()
+	metricsHandler := NewMetricsHandler(storage)
+	metricsHandler.Register(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	//Одна и та же метрика с разных хостов не перезаписывает друг друга
+	resp := testRequestWithBody(t, ts, "POST", "/updates/", `[
+		{"id":"Alloc","type":"gauge","value":1,"labels":{"host":"a"}},
+		{"id":"Alloc","type":"gauge","value":2,"labels":{"host":"b"}},
+		{"id":"Alloc","type":"gauge","value":3}
+	]`)
+	require.Equal(t, http.StatusOK, resp.StatusCode())
+
+	tests := []struct {
+		name         string
+		method       string
+		url          string
+		body         string
+		expectedCode int
+		expectedBody string
+	}{
+		{"value json host a", "POST", "/value/", `{"id":"Alloc","type":"gauge","labels":{"host":"a"}}`, http.StatusOK, `{"id":"Alloc","type":"gauge","value":1,"labels":{"host":"a"}}`},
+		{"value path host b", "GET", "/value/gauge/Alloc?host=b", "", http.StatusOK, "2"},
+		{"value without labels", "GET", "/value/gauge/Alloc", "", http.StatusOK, "3"},
+		{"unknown host", "GET", "/value/gauge/Alloc?host=c", "", http.StatusNotFound, ""},
+		{"list filter", "GET", "/?host=b", "", http.StatusOK, `Alloc{host="b"} = 2`},
+		{"bad label name", "POST", "/update/", `{"id":"Alloc","type":"gauge","value":1,"labels":{"1host":"a"}}`, http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := testRequestWithBody(t, ts, tt.method, tt.url, tt.body)
+			assert.Equal(t, tt.expectedCode, resp.StatusCode(), "Код ответа не совпадает с ожидаемым")
+
+			replacer := strings.NewReplacer("\r", "", "\n", "")
+			assert.Equal(t, tt.expectedBody, replacer.Replace(string(resp.Body())), "Значение ответа не совпадает с ожидаемым")
+		})
+	}
+}
+
+func TestHandler_histogram(t *testing.T) {
+	storage := memstorage.NewStorage()
+	router := chi.NewRouter()
+	metricsHandler := NewMetricsHandler(storage)
+	metricsHandler.Register(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	tests := []struct {
+		name         string
+		url          string
+		body         string
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "add histogram",
+			url:          "/update/",
+			body:         `{"id":"latency","type":"histogram","histogram":{"bounds":[0.1,1],"counts":[1,0,0],"sum":0.05,"count":1}}`,
+			expectedCode: http.StatusOK,
+			expectedBody: `{"id":"latency","type":"histogram","histogram":{"bounds":[0.1,1],"counts":[1,0,0],"sum":0.05,"count":1}}`,
+		},
+		{
+			name:         "merge in batch",
+			url:          "/updates/",
+			body:         `[{"id":"latency","type":"histogram","histogram":{"bounds":[0.1,1],"counts":[0,1,0],"sum":0.5,"count":1}},{"id":"latency","type":"histogram","histogram":{"bounds":[0.1,1],"counts":[0,0,1],"sum":5,"count":1}}]`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "get merged",
+			url:          "/value/",
+			body:         `{"id":"latency","type":"histogram"}`,
+			expectedCode: http.StatusOK,
+			expectedBody: `{"id":"latency","type":"histogram","histogram":{"bounds":[0.1,1],"counts":[1,1,1],"sum":5.55,"count":3}}`,
+		},
+		{
+			name:         "other bounds",
+			url:          "/update/",
+			body:         `{"id":"latency","type":"histogram","histogram":{"bounds":[1],"counts":[1,0],"sum":0.05,"count":1}}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "inconsistent histogram",
+			url:          "/update/",
+			body:         `{"id":"latency","type":"histogram","histogram":{"bounds":[0.1,1],"counts":[1,0],"sum":0.05,"count":1}}`,
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := testRequestWithBody(t, ts, "POST", tt.url, tt.body)
+			assert.Equal(t, tt.expectedCode, resp.StatusCode(), "Код ответа не совпадает с ожидаемым")
+
+			replacer := strings.NewReplacer("\r", "", "\n", "")
+			assert.Equal(t, tt.expectedBody, replacer.Replace(string(resp.Body())), "Значение ответа не совпадает с ожидаемым")
+		})
+	}
+}
+
+func TestHandler_batchValidation(t *testing.T) {
+	storage := memstorage.NewStorage()
+	router := chi.NewRouter()
+	metricsHandler := NewMetricsHandler(storage)
+	metricsHandler.Register(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	tests := []struct {
+		name         string
+		body         string
+		expectedCode int
+	}{
+		{"counter without delta", `[{"id":"PollCount","type":"counter"}]`, http.StatusBadRequest},
+		{"gauge without value", `[{"id":"Alloc","type":"gauge"}]`, http.StatusBadRequest},
+		{"empty id", `[{"type":"gauge","value":1}]`, http.StatusBadRequest},
+		{"unknown type", `[{"id":"Alloc","type":"meter","value":1}]`, http.StatusNotImplemented},
+		{"valid", `[{"id":"Alloc","type":"gauge","value":1},{"id":"PollCount","type":"counter","delta":1}]`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := testRequestWithBody(t, ts, "POST", "/updates/", tt.body)
+			assert.Equal(t, tt.expectedCode, resp.StatusCode(), "Код ответа не совпадает с ожидаемым")
+		})
+	}
+
+	//Отклоненные батчи ничего не сохранили
+	metrics, err := storage.GetMetrics(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Len(t, metrics, 2)
+}
+
+func TestHandler_summary(t *testing.T) {
+	storage := memstorage.NewStorage()
+	router := chi.NewRouter()
+	metricsHandler := NewMetricsHandler(storage)
+	metricsHandler.Register(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	tests := []struct {
+		name         string
+		method       string
+		url          string
+		body         string
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "add observations",
+			method:       "POST",
+			url:          "/update/",
+			body:         `{"id":"latency","type":"summary","observations":[1,2,3,4,5,6,7,8,9,10]}`,
+			expectedCode: http.StatusOK,
+			expectedBody: `{"id":"latency","type":"summary","summary":{"quantiles":[{"quantile":0.5,"value":5},{"quantile":0.9,"value":9},{"quantile":0.99,"value":10}],"sum":55,"count":10}}`,
+		},
+		{
+			name:         "requested quantile",
+			method:       "POST",
+			url:          "/value/",
+			body:         `{"id":"latency","type":"summary","quantile":0.2}`,
+			expectedCode: http.StatusOK,
+			expectedBody: `{"id":"latency","type":"summary","value":2,"summary":{"quantiles":[{"quantile":0.2,"value":2}],"sum":55,"count":10},"quantile":0.2}`,
+		},
+		{
+			name:         "requested quantile by path",
+			method:       "GET",
+			url:          "/value/summary/latency?quantile=0.9",
+			expectedCode: http.StatusOK,
+			expectedBody: "9",
+		},
+		{
+			name:         "bad quantile",
+			method:       "POST",
+			url:          "/value/",
+			body:         `{"id":"latency","type":"summary","quantile":2}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "empty observations",
+			method:       "POST",
+			url:          "/update/",
+			body:         `{"id":"latency","type":"summary"}`,
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := testRequestWithBody(t, ts, tt.method, tt.url, tt.body)
+			assert.Equal(t, tt.expectedCode, resp.StatusCode(), "Код ответа не совпадает с ожидаемым")
+
+			replacer := strings.NewReplacer("\r", "", "\n", "")
+			assert.Equal(t, tt.expectedBody, replacer.Replace(string(resp.Body())), "Значение ответа не совпадает с ожидаемым")
+		})
+	}
+}
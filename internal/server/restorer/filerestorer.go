@@ -26,7 +26,13 @@ func (m *fileRestorer) restore() error {
 		return fmt.Errorf("cannot read store file: %w", err)
 	}
 
-	return m.storage.Restore(data)
+	//Файл мог остаться от сервера с STORE_WAL - тогда метрики лежат внутри снимка
+	metrics, _, err := parseSnapshot(data)
+	if err != nil {
+		return err
+	}
+
+	return m.storage.Restore(metrics)
 }
 
 // Сохраняем метрики в файл
@@ -43,3 +49,7 @@ func (m *fileRestorer) store() error {
 func (m *fileRestorer) Work() error {
 	return m.store()
 }
+
+func (m *fileRestorer) close() error {
+	return nil
+}
@@ -1,6 +1,7 @@
 package restorer
 
 import (
+	"fmt"
 	"sync"
 
 	"github.com/AntonPashechko/yametrix/internal/logger"
@@ -13,68 +14,169 @@ type RestorerType int
 
 const (
 	FileRestorer RestorerType = iota + 1
+	//Журнал обновлений и периодические снимки
+	WALRestorer
 )
 
 type Manager struct {
-	restorer  MetricsRestorer
+	//Сохранение по запросам и смена настроек при перечитывании конфигурации идут из разных горутин
+	mux       sync.Mutex
+	mType     RestorerType
+	path      string
+	storage   *memstorage.Storage
+	restorer  MetricsRestorer //nil - сохранять некуда
 	scheduler scheduler.Scheduler
 }
 
+func newRestorer(mType RestorerType, storage *memstorage.Storage, path string) (MetricsRestorer, error) {
+	//Если имя файла для Store не задано - сохранять некуда
+	if path == "" {
+		return nil, nil
+	}
+
+	switch mType {
+	case FileRestorer:
+		return NewFileRestorer(storage, path), nil
+	case WALRestorer:
+		return NewWALRestorer(storage, path)
+	default:
+		return nil, fmt.Errorf("bad restore type")
+	}
+}
+
 func (m *Manager) store() {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
 	//Если синхронная запись и шедулер не запущен
 	//По другому тут не проверить, твой вариант с nil не cработает, а я не хочу иметь здесь указатель
-	if m.scheduler == (scheduler.Scheduler{}) {
+	if m.restorer != nil && m.scheduler == (scheduler.Scheduler{}) {
 		m.restorer.store()
 	}
 }
 
-func (m *Manager) shutdown() {
+// start запускает шедулер, если периодичность сохранения задана, вызывается под mux
+func (m *Manager) start(interval uint64) {
+	if m.restorer == nil || interval == 0 {
+		return
+	}
+
+	m.scheduler = scheduler.NewScheduler(int64(interval), m.restorer)
+	go m.scheduler.Start()
+}
+
+// stop останавливает шедулер, вызывается под mux
+func (m *Manager) stop() {
 	//Стопаем если вообще был запущен
 	//По другому тут не проверить, твой вариант с nil не работает, а я не хочу иметь здесь указатель
 	if m.scheduler != (scheduler.Scheduler{}) {
 		m.scheduler.Stop()
+		m.scheduler = scheduler.Scheduler{}
+	}
+}
+
+func (m *Manager) shutdown() {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.stop()
+
+	if m.restorer != nil {
+		if err := m.restorer.close(); err != nil {
+			logger.Error("cannot close restorer: %s", err)
+		}
+	}
+}
+
+func (m *Manager) reconfigure(path string, interval uint64) error {
+	//Журнал подключен к хранилищу и открыт на старте, на лету меняем только периодичность снимков
+	if m.mType == WALRestorer {
+		if path != m.path {
+			return fmt.Errorf("store path with wal cannot be changed without restart")
+		}
+		if interval == 0 {
+			return fmt.Errorf("store interval with wal must be positive")
+		}
+
+		m.mux.Lock()
+		defer m.mux.Unlock()
+
+		m.stop()
+		m.start(interval)
+		return nil
 	}
+
+	restorer, err := newRestorer(m.mType, m.storage, path)
+	if err != nil {
+		return err
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.stop()
+	m.restorer = restorer
+	m.path = path
+	m.start(interval)
+
+	//Сразу сохраняем по новым настройкам, что бы новый файл не ждал интервала
+	if m.restorer != nil {
+		if err := m.restorer.store(); err != nil {
+			return fmt.Errorf("cannot store metrics to %s: %w", path, err)
+		}
+	}
+
+	return nil
 }
 
 var instance *Manager
 var once sync.Once
 
-func Initialize(storage *memstorage.Storage, mType RestorerType, cfg *config.Config) {
+// Initialize создает менеджер и восстанавливает метрики. С журналом ошибка восстановления
+// прерывает запуск: иначе снимок неполного состояния и удаление сегментов потеряли бы данные
+func Initialize(storage *memstorage.Storage, mType RestorerType, cfg *config.Config) error {
+	var initErr error
+
 	//Ресторер используем как синглтон, потому тут я применяю sync.Once, считаю эту конструкцию наиболее подходящей для задачи инициализации синглтона
 	once.Do(func() {
-		var restorer MetricsRestorer
-
-		switch mType {
-		case FileRestorer:
-			//Если имя файла для Store не задано - просто выходим
-			if cfg.StorePath == "" {
-				return
-			}
-			restorer = NewFileRestorer(storage, cfg.StorePath)
-		default:
-			logger.Error("bad restore type")
+		restorer, err := newRestorer(mType, storage, cfg.StorePath)
+		if err != nil {
+			initErr = err
 			return
 		}
 
 		//делаем restore если просят
-		if cfg.Restore {
+		if restorer != nil && cfg.Restore {
 			if err := restorer.restore(); err != nil {
+				if mType == WALRestorer {
+					initErr = fmt.Errorf("cannot restore metrics from %s: %w", cfg.StorePath, err)
+					return
+				}
 				logger.Error("cannot restore metrics from file %s: %s", cfg.StorePath, err)
 			}
 		}
 
-		var storeScheduler scheduler.Scheduler
-		/*Если периодичность сохранения задана - запускаем шедулер*/
-		if cfg.StoreInterval != 0 {
-			storeScheduler = scheduler.NewScheduler(int64(cfg.StoreInterval), restorer)
-			go storeScheduler.Start()
+		//Журнал начинаем со снимка текущего состояния, старые сегменты больше не нужны,
+		//в том числе если восстановление не просили
+		if mType == WALRestorer && restorer != nil {
+			if err := restorer.store(); err != nil {
+				initErr = fmt.Errorf("cannot store metrics to file %s: %w", cfg.StorePath, err)
+				return
+			}
 		}
 
+		//Менеджер нужен и без файла - его могут задать при перечитывании конфигурации
 		instance = &Manager{
-			restorer:  restorer,
-			scheduler: storeScheduler,
+			mType:    mType,
+			path:     cfg.StorePath,
+			storage:  storage,
+			restorer: restorer,
 		}
+		/*Если периодичность сохранения задана - запускаем шедулер*/
+		instance.start(cfg.StoreInterval)
 	})
+
+	return initErr
 }
 
 func Shutdown() {
@@ -82,3 +184,20 @@ func Shutdown() {
 		instance.shutdown()
 	}
 }
+
+// Store синхронизирует метрики после изменения, если запись синхронная.
+// Для обработчиков вне http, которым не подходит Middleware
+func Store() {
+	if instance != nil {
+		instance.store()
+	}
+}
+
+// Reconfigure меняет файл и периодичность сохранения на лету
+func Reconfigure(path string, interval uint64) error {
+	if instance == nil {
+		return fmt.Errorf("metrics are not stored in memory")
+	}
+
+	return instance.reconfigure(path, interval)
+}
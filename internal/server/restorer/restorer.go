@@ -4,4 +4,5 @@ type MetricsRestorer interface {
 	restore() error
 	store() error
 	Work() error
+	close() error
 }
@@ -0,0 +1,151 @@
+package restorer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/AntonPashechko/yametrix/internal/logger"
+	"github.com/AntonPashechko/yametrix/internal/storage/memstorage"
+	"github.com/AntonPashechko/yametrix/internal/wal"
+)
+
+// walSnapshot - снимок метрик и номер первого сегмента журнала, которого в снимке нет
+type walSnapshot struct {
+	Segment uint64          `json:"segment"`
+	Metrics json.RawMessage `json:"metrics"`
+}
+
+// walRestorer - каждое обновление пишется в журнал, а периодически делается снимок
+// и старые сегменты удаляются. Журнал лежит в каталоге <файл снимка>.wal
+type walRestorer struct {
+	storeFileName string              //Имя файла снимка
+	storage       *memstorage.Storage //Хранилище метрик
+	log           *wal.Log
+}
+
+// parseSnapshot возвращает метрики из файла и первый сегмент журнала после снимка.
+// Файл, сохраненный без журнала - сам по себе метрики, сегмент 0
+func parseSnapshot(data []byte) ([]byte, uint64, error) {
+	var snapshot walSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, 0, fmt.Errorf("cannot unmarshal snapshot: %w", err)
+	}
+
+	if snapshot.Metrics == nil {
+		return data, 0, nil
+	}
+
+	return snapshot.Metrics, snapshot.Segment, nil
+}
+
+func NewWALRestorer(storage *memstorage.Storage, path string) (MetricsRestorer, error) {
+	log, err := wal.Open(path + ".wal")
+	if err != nil {
+		return nil, fmt.Errorf("cannot open wal: %w", err)
+	}
+
+	//Обновления восстановления в журнал не пишутся, поэтому журнал можно подключить сразу
+	storage.SetJournal(log)
+
+	return &walRestorer{
+		storeFileName: path,
+		storage:       storage,
+		log:           log,
+	}, nil
+}
+
+// restore загружает снимок и применяет журнал после него
+func (m *walRestorer) restore() error {
+	var segment uint64
+
+	data, err := os.ReadFile(m.storeFileName)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		//Снимка еще не было, все обновления в журнале
+	case err != nil:
+		return fmt.Errorf("cannot read store file: %w", err)
+	default:
+		metrics, snapshotSegment, err := parseSnapshot(data)
+		if err != nil {
+			return err
+		}
+
+		if err := m.storage.Restore(metrics); err != nil {
+			return err
+		}
+		segment = snapshotSegment
+	}
+
+	count, err := wal.Replay(m.storeFileName+".wal", segment, func(entry wal.Entry) error {
+		//Батч, который не применяется (например, уменьшили квоту) - пропускаем, остальные важнее
+		if err := m.storage.Replay(entry.Tenant, entry.Timestamp, entry.Metrics...); err != nil {
+			logger.Error("cannot replay %d metric updates: %s", len(entry.Metrics), err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("cannot replay wal: %w", err)
+	}
+
+	logger.Info("Replayed %d wal entries", count)
+	return nil
+}
+
+// store делает снимок и удаляет вошедшие в него сегменты журнала
+func (m *walRestorer) store() error {
+	var segment uint64
+	data, err := m.storage.Checkpoint(func() error {
+		var err error
+		segment, err = m.log.Rotate()
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("cannot checkpoint metrics: %w", err)
+	}
+
+	snapshot, err := json.Marshal(walSnapshot{Segment: segment, Metrics: data})
+	if err != nil {
+		return fmt.Errorf("cannot marshal snapshot: %w", err)
+	}
+
+	//Пишем во временный файл и переименовываем, что бы при падении остался целый снимок
+	tmpName := m.storeFileName + ".tmp"
+	if err := writeFileSync(tmpName, snapshot); err != nil {
+		return fmt.Errorf("cannot write snapshot: %w", err)
+	}
+	if err := os.Rename(tmpName, m.storeFileName); err != nil {
+		return fmt.Errorf("cannot replace snapshot: %w", err)
+	}
+
+	return m.log.Compact(segment)
+}
+
+func (m *walRestorer) Work() error {
+	return m.store()
+}
+
+// close делает последний снимок, что бы при старте журнал был пустым
+func (m *walRestorer) close() error {
+	err := m.store()
+	if closeErr := m.log.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+func writeFileSync(name string, data []byte) error {
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := file.Write(data); err != nil {
+		return err
+	}
+
+	return file.Sync()
+}
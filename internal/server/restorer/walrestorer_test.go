@@ -0,0 +1,125 @@
+package restorer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AntonPashechko/yametrix/internal/models"
+	config "github.com/AntonPashechko/yametrix/internal/server/config"
+	"github.com/AntonPashechko/yametrix/internal/storage/memstorage"
+	"github.com/AntonPashechko/yametrix/internal/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getCounter(t *testing.T, storage *memstorage.Storage, ctx context.Context, id string) int64 {
+	metric, err := storage.GetCounter(ctx, id)
+	require.NoError(t, err)
+	return *metric.Delta
+}
+
+func TestWALRestorer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	ctx := context.Background()
+	teamA := tenant.WithTenant(ctx, "team-a")
+
+	storage := memstorage.NewStorage()
+	restorer, err := NewWALRestorer(storage, path)
+	require.NoError(t, err)
+
+	_, err = storage.AddCounter(ctx, models.NewCounterMetric("PollCount", 5))
+	require.NoError(t, err)
+	require.NoError(t, restorer.store())
+
+	//После снимка - только в журнале
+	_, err = storage.AddCounter(ctx, models.NewCounterMetric("PollCount", 2))
+	require.NoError(t, err)
+	_, err = storage.AddCounter(teamA, models.NewCounterMetric("PollCount", 1))
+	require.NoError(t, err)
+	require.NoError(t, storage.SetGauge(ctx, models.NewGaugeMetric("Alloc", 7)))
+
+	//Сервер упал без последнего снимка - восстанавливаемся из снимка и журнала
+	restored := memstorage.NewStorage()
+	second, err := NewWALRestorer(restored, path)
+	require.NoError(t, err)
+	require.NoError(t, second.restore())
+
+	assert.Equal(t, int64(7), getCounter(t, restored, ctx, "PollCount"))
+	assert.Equal(t, int64(1), getCounter(t, restored, teamA, "PollCount"))
+	gauge, err := restored.GetGauge(ctx, "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, float64(7), *gauge.Value)
+
+	//Снимок после восстановления не удваивает counter при следующем старте
+	require.NoError(t, second.close())
+	third := memstorage.NewStorage()
+	restorer, err = NewWALRestorer(third, path)
+	require.NoError(t, err)
+	require.NoError(t, restorer.restore())
+	assert.Equal(t, int64(7), getCounter(t, third, ctx, "PollCount"))
+
+	//Старые сегменты удалены снимком
+	segments, err := filepath.Glob(filepath.Join(path+".wal", "*.wal"))
+	require.NoError(t, err)
+	assert.LessOrEqual(t, len(segments), 2)
+}
+
+func TestWALRestorerPlainSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+
+	//Файл, сохраненный без журнала
+	storage := memstorage.NewStorage()
+	_, err := storage.AddCounter(context.Background(), models.NewCounterMetric("PollCount", 3))
+	require.NoError(t, err)
+	data, err := storage.Marshal()
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0666))
+
+	restored := memstorage.NewStorage()
+	restorer, err := NewWALRestorer(restored, path)
+	require.NoError(t, err)
+	require.NoError(t, restorer.restore())
+
+	assert.Equal(t, int64(3), getCounter(t, restored, context.Background(), "PollCount"))
+}
+
+func TestFileRestorerWALSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	ctx := context.Background()
+
+	storage := memstorage.NewStorage()
+	restorer, err := NewWALRestorer(storage, path)
+	require.NoError(t, err)
+	require.NoError(t, storage.SetGauge(ctx, models.NewGaugeMetric("Alloc", 7)))
+	require.NoError(t, restorer.close())
+
+	//STORE_WAL выключили - снимок журнала читается и без него
+	restored := memstorage.NewStorage()
+	require.NoError(t, NewFileRestorer(restored, path).restore())
+
+	gauge, err := restored.GetGauge(ctx, "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, float64(7), *gauge.Value)
+}
+
+func TestInitializeRestoreError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+
+	storage := memstorage.NewStorage()
+	_, err := NewWALRestorer(storage, path)
+	require.NoError(t, err)
+	_, err = storage.AddCounter(context.Background(), models.NewCounterMetric("PollCount", 5))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, []byte("{broken"), 0666))
+	segments, err := filepath.Glob(filepath.Join(path+".wal", "*.wal"))
+	require.NoError(t, err)
+
+	//Снимок не читается - запуск прерывается, а журнал остается нетронутым
+	cfg := &config.Config{StorePath: path, StoreInterval: 300, Restore: true}
+	assert.Error(t, Initialize(memstorage.NewStorage(), WALRestorer, cfg))
+	for _, segment := range segments {
+		assert.FileExists(t, segment)
+	}
+}
@@ -0,0 +1,115 @@
+package statsd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/AntonPashechko/yametrix/internal/logger"
+	"github.com/AntonPashechko/yametrix/internal/models"
+	"github.com/AntonPashechko/yametrix/internal/server/restorer"
+	"github.com/AntonPashechko/yametrix/internal/storage"
+)
+
+const (
+	maxPacketSize = 65535
+)
+
+// Listener принимает метрики StatsD по UDP и складывает их в хранилище метрик
+type Listener struct {
+	conn    net.PacketConn
+	storage storage.MetricsStorage
+}
+
+func NewListener(address string, storage storage.MetricsStorage) (*Listener, error) {
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("cannot listen statsd udp %s: %w", address, err)
+	}
+
+	return &Listener{
+		conn:    conn,
+		storage: storage,
+	}, nil
+}
+
+// Addr возвращает адрес, на котором слушаем
+func (m *Listener) Addr() net.Addr {
+	return m.conn.LocalAddr()
+}
+
+// Run читает пакеты до Close
+func (m *Listener) Run() {
+	buf := make([]byte, maxPacketSize)
+
+	for {
+		n, _, err := m.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			logger.Error("cannot read statsd packet: %s", err)
+			continue
+		}
+
+		m.handlePacket(context.Background(), string(buf[:n]))
+	}
+}
+
+func (m *Listener) Close() error {
+	return m.conn.Close()
+}
+
+// handlePacket разбирает пакет, в одном пакете может быть несколько строк.
+// Как и для HTTP и gRPC, при синхронном сохранении пакет сразу пишется в файл
+func (m *Listener) handlePacket(ctx context.Context, packet string) {
+	var applied bool
+	defer func() {
+		if applied {
+			restorer.Store()
+		}
+	}()
+
+	for _, line := range strings.Split(packet, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		parsed, err := ParseLine(line)
+		if err != nil {
+			logger.Error("%s", err)
+			continue
+		}
+
+		if err := m.apply(ctx, parsed); err != nil {
+			logger.Error("cannot apply statsd metric %s: %s", parsed.Metric.ID, err)
+			continue
+		}
+		applied = true
+	}
+}
+
+func (m *Listener) apply(ctx context.Context, line Line) error {
+	metric := line.Metric
+
+	switch metric.MType {
+	case models.CounterType:
+		_, err := m.storage.AddCounter(ctx, metric)
+		return err
+	case models.GaugeType:
+		//Изменение gauge применяем к текущему значению, если оно есть
+		if line.Relative {
+			if current, err := m.storage.GetGauge(ctx, metric.SeriesKey()); err == nil && current.Value != nil {
+				metric.SetValue(*current.Value + *metric.Value)
+			}
+		}
+		return m.storage.SetGauge(ctx, metric)
+	case models.SummaryType:
+		return m.storage.AddSummary(ctx, metric)
+	}
+
+	return fmt.Errorf("unknown metric type %s", metric.MType)
+}
@@ -0,0 +1,44 @@
+package statsd
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/AntonPashechko/yametrix/internal/storage/memstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListener(t *testing.T) {
+	storage := memstorage.NewStorage()
+
+	listener, err := NewListener("127.0.0.1:0", storage)
+	require.NoError(t, err)
+	go listener.Run()
+	defer listener.Close()
+
+	conn, err := net.Dial("udp", listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("requests:2|c\nrequests:3|c\ntemperature:10|g\ntemperature:-2.5|g\nlatency:15|ms\nbroken"))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	assert.Eventually(t, func() bool {
+		counter, err := storage.GetCounter(ctx, "requests")
+		if err != nil || *counter.Delta != 5 {
+			return false
+		}
+
+		gauge, err := storage.GetGauge(ctx, "temperature")
+		if err != nil || *gauge.Value != 7.5 {
+			return false
+		}
+
+		summary, err := storage.GetSummary(ctx, "latency", nil)
+		return err == nil && summary.Summary.Count == 1
+	}, time.Second, 10*time.Millisecond)
+}
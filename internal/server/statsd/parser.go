@@ -0,0 +1,105 @@
+package statsd
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/AntonPashechko/yametrix/internal/models"
+	"github.com/AntonPashechko/yametrix/pkg/utils"
+)
+
+// Типы метрик StatsD
+const (
+	counterType   = "c"
+	gaugeType     = "g"
+	timerType     = "ms"
+	histogramType = "h"
+	distType      = "d"
+)
+
+// Line - разобранная строка StatsD
+type Line struct {
+	Metric models.MetricDTO
+	//Для gauge со знаком (+3, -3) значение - изменение текущего, а не новое значение
+	Relative bool
+}
+
+// ParseLine разбирает строку вида name:value|type[|@rate][|#tag:value,...]
+func ParseLine(line string) (Line, error) {
+	var res Line
+
+	//Двоеточие может встретиться в тегах, поэтому ищем его до первой |
+	head, _, _ := strings.Cut(line, "|")
+	nameEnd := strings.LastIndex(head, ":")
+	if nameEnd <= 0 {
+		return res, fmt.Errorf("bad statsd line %q: no metric name", line)
+	}
+	name := line[:nameEnd]
+	if err := models.ValidateID(name); err != nil {
+		return res, fmt.Errorf("bad statsd line %q: %w", line, err)
+	}
+
+	parts := strings.Split(line[nameEnd+1:], "|")
+	if len(parts) < 2 {
+		return res, fmt.Errorf("bad statsd line %q: no metric type", line)
+	}
+
+	rawValue, mType := parts[0], parts[1]
+
+	value, err := utils.StrToFloat64(rawValue)
+	if err != nil || rawValue == "" {
+		return res, fmt.Errorf("bad statsd line %q: bad value %s", line, rawValue)
+	}
+
+	//Необязательные части - частота выборки и теги
+	rate := 1.0
+	var labels map[string]string
+	for _, part := range parts[2:] {
+		switch {
+		case strings.HasPrefix(part, "@"):
+			rate, err = utils.StrToFloat64(part[1:])
+			if err != nil || rate <= 0 || rate > 1 {
+				return res, fmt.Errorf("bad statsd line %q: bad sample rate %s", line, part[1:])
+			}
+		case strings.HasPrefix(part, "#"):
+			labels = parseTags(part[1:])
+		}
+	}
+
+	switch mType {
+	case counterType:
+		//Счетчик пришел с прореживанием - восстанавливаем полное значение
+		res.Metric = models.NewCounterMetric(name, int64(math.Round(value/rate)))
+	case gaugeType:
+		res.Metric = models.NewGaugeMetric(name, value)
+		res.Relative = strings.HasPrefix(rawValue, "+") || strings.HasPrefix(rawValue, "-")
+	case timerType, histogramType, distType:
+		res.Metric = models.NewSummaryMetric(name, value)
+	default:
+		return res, fmt.Errorf("bad statsd line %q: unsupported metric type %s", line, mType)
+	}
+
+	if err := models.ValidateLabels(labels); err != nil {
+		return res, fmt.Errorf("bad statsd line %q: %w", line, err)
+	}
+	res.Metric.Labels = labels
+
+	return res, nil
+}
+
+// parseTags разбирает теги DogStatsD вида key:value,key2:value2, тег без значения получает пустое значение
+func parseTags(str string) map[string]string {
+	labels := make(map[string]string)
+
+	for _, tag := range strings.Split(str, ",") {
+		if tag == "" {
+			continue
+		}
+
+		name, value, _ := strings.Cut(tag, ":")
+		labels[name] = value
+	}
+
+	return labels
+}
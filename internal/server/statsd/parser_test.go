@@ -0,0 +1,48 @@
+package statsd
+
+import (
+	"testing"
+
+	"github.com/AntonPashechko/yametrix/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLine(t *testing.T) {
+	withLabels := models.NewCounterMetric("requests", 1)
+	withLabels.Labels = map[string]string{"host": "a", "canary": ""}
+
+	tests := []struct {
+		name     string
+		line     string
+		want     models.MetricDTO
+		relative bool
+		wantErr  bool
+	}{
+		{"counter", "requests:1|c", models.NewCounterMetric("requests", 1), false, false},
+		{"sampled counter", "requests:2|c|@0.1", models.NewCounterMetric("requests", 20), false, false},
+		{"gauge", "temperature:3.2|g", models.NewGaugeMetric("temperature", 3.2), false, false},
+		{"relative gauge", "temperature:-1.5|g", models.NewGaugeMetric("temperature", -1.5), true, false},
+		{"timer", "latency:320|ms|@0.5", models.NewSummaryMetric("latency", 320), false, false},
+		{"histogram", "size:1024|h", models.NewSummaryMetric("size", 1024), false, false},
+		{"tags", "requests:1|c|#host:a,canary", withLabels, false, false},
+		{"dotted name", "api.http.requests:1|c", models.NewCounterMetric("api.http.requests", 1), false, false},
+		{"no type", "requests:1", models.MetricDTO{}, false, true},
+		{"bad value", "requests:x|c", models.MetricDTO{}, false, true},
+		{"bad rate", "requests:1|c|@2", models.MetricDTO{}, false, true},
+		{"set", "users:42|s", models.MetricDTO{}, false, true},
+		{"bad tag", "requests:1|c|#1host:a", models.MetricDTO{}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLine(tt.line)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got.Metric)
+			assert.Equal(t, tt.relative, got.Relative)
+		})
+	}
+}
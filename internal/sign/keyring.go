@@ -0,0 +1,121 @@
+package sign
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// MetricsKeyring - ключи агентов на сервере, nil - только общий ключ
+var MetricsKeyring *Keyring
+
+// keyFileEntry - запись файла ключей.
+// Для ротации у ID заводится второй ключ, а старому ставится expires - пока он не наступил, принимаются оба
+type keyFileEntry struct {
+	ID      string    `json:"id"`
+	Key     string    `json:"key"`
+	Expires time.Time `json:"expires,omitempty"`
+}
+
+type keyEntry struct {
+	signer  *Signer
+	expires time.Time //нулевое - бессрочный
+}
+
+func (m keyEntry) expired(now time.Time) bool {
+	return !m.expires.IsZero() && now.After(m.expires)
+}
+
+// Keyring - ключи агентов по ID, у одного ID на время ротации может быть несколько ключей
+type Keyring struct {
+	path string
+	mux  sync.RWMutex
+	keys map[string][]keyEntry
+}
+
+// LoadKeyring читает файл ключей - JSON массив {"id", "key", "expires"}
+func LoadKeyring(path string) (*Keyring, error) {
+	keyring := &Keyring{path: path}
+	if err := keyring.Reload(); err != nil {
+		return nil, err
+	}
+
+	return keyring, nil
+}
+
+func InitializeKeyring(path string) error {
+	keyring, err := LoadKeyring(path)
+	if err != nil {
+		return err
+	}
+
+	MetricsKeyring = keyring
+	return nil
+}
+
+// Reload перечитывает файл ключей, при ошибке остаются прежние ключи
+func (m *Keyring) Reload() error {
+	data, err := os.ReadFile(m.path)
+	if err != nil {
+		return fmt.Errorf("cannot read keys file: %w", err)
+	}
+
+	var entries []keyFileEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("cannot parse keys file: %w", err)
+	}
+
+	keys := make(map[string][]keyEntry)
+	for i, entry := range entries {
+		if entry.ID == "" || entry.Key == "" {
+			return fmt.Errorf("key #%d: id and key are required", i+1)
+		}
+		keys[entry.ID] = append(keys[entry.ID], keyEntry{
+			signer:  NewSigner(entry.ID, []byte(entry.Key)),
+			expires: entry.Expires,
+		})
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.keys = keys
+	return nil
+}
+
+// Len - количество ключей, для лога
+func (m *Keyring) Len() int {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+
+	var count int
+	for _, entries := range m.keys {
+		count += len(entries)
+	}
+	return count
+}
+
+// Verify ищет действующий ключ агента, которым сходится подпись
+func (m *Keyring) Verify(keyID string, data []byte, signValue []byte) (*Signer, error) {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+
+	entries, ok := m.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %s", keyID)
+	}
+
+	now := time.Now()
+	for _, entry := range entries {
+		if entry.expired(now) {
+			continue
+		}
+		if entry.signer.matches(data, signValue) {
+			return entry.signer, nil
+		}
+	}
+
+	return nil, fmt.Errorf("invalid signature for key id %s", keyID)
+}
@@ -0,0 +1,165 @@
+package sign
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testKeys = `[
+	{"id": "host-1", "key": "old-secret", "expires": "2000-01-01T00:00:00Z"},
+	{"id": "host-1", "key": "new-secret"},
+	{"id": "host-2", "key": "rotating-secret", "expires": "2999-01-01T00:00:00Z"},
+	{"id": "host-2", "key": "next-secret"}
+]`
+
+func writeKeys(t *testing.T, data string) string {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	require.NoError(t, os.WriteFile(path, []byte(data), 0600))
+	return path
+}
+
+func createSign(t *testing.T, key string, data []byte) []byte {
+	value, err := NewSigner("", []byte(key)).CreateSign(data)
+	require.NoError(t, err)
+	return value
+}
+
+func TestKeyringVerify(t *testing.T) {
+	keyring, err := LoadKeyring(writeKeys(t, testKeys))
+	require.NoError(t, err)
+	assert.Equal(t, 4, keyring.Len())
+
+	data := []byte("body")
+
+	tests := []struct {
+		name    string
+		keyID   string
+		key     string
+		wantErr bool
+	}{
+		{"current_key", "host-1", "new-secret", false},
+		{"expired_key", "host-1", "old-secret", true},
+		{"rotation_old_key", "host-2", "rotating-secret", false},
+		{"rotation_new_key", "host-2", "next-secret", false},
+		{"other_host_key", "host-2", "new-secret", true},
+		{"unknown_id", "host-3", "new-secret", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer, err := keyring.Verify(tt.keyID, data, createSign(t, tt.key, data))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.keyID, signer.KeyID())
+		})
+	}
+}
+
+func TestKeyringReload(t *testing.T) {
+	path := writeKeys(t, `[{"id": "host-1", "key": "secret"}]`)
+	keyring, err := LoadKeyring(path)
+	require.NoError(t, err)
+
+	data := []byte("body")
+	_, err = keyring.Verify("host-1", data, createSign(t, "secret", data))
+	require.NoError(t, err)
+
+	//Битый файл не должен ломать действующие ключи
+	require.NoError(t, os.WriteFile(path, []byte(`[{"id": "host-1"}]`), 0600))
+	assert.Error(t, keyring.Reload())
+	_, err = keyring.Verify("host-1", data, createSign(t, "secret", data))
+	assert.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte(`[{"id": "host-1", "key": "rotated"}]`), 0600))
+	require.NoError(t, keyring.Reload())
+	_, err = keyring.Verify("host-1", data, createSign(t, "secret", data))
+	assert.Error(t, err)
+	_, err = keyring.Verify("host-1", data, createSign(t, "rotated", data))
+	assert.NoError(t, err)
+}
+
+func TestMiddlewareKeyring(t *testing.T) {
+	require.NoError(t, InitializeKeyring(writeKeys(t, testKeys)))
+	Initialize("", []byte("shared"))
+	defer func() {
+		MetricsKeyring = nil
+		Initialize("", nil)
+	}()
+
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+
+	body := []byte(`[{"id":"Alloc","type":"gauge","value":1}]`)
+
+	tests := []struct {
+		name     string
+		path     string
+		keyID    string
+		key      string
+		wantCode int
+	}{
+		{"agent_key", "/updates/", "host-1", "new-secret", http.StatusOK},
+		{"shared_key", "/updates/", "", "shared", http.StatusBadRequest},
+		{"shared_key_with_id", "/updates/", "host-1", "shared", http.StatusBadRequest},
+		{"expired_key", "/updates/", "host-1", "old-secret", http.StatusBadRequest},
+		{"unsigned_update", "/updates/", "", "", http.StatusBadRequest},
+		{"shared_key_read", "/value/", "", "shared", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, tt.path, bytes.NewReader(body))
+			if tt.key != "" {
+				r.Header.Set(Header, hex.EncodeToString(createSign(t, tt.key, body)))
+			}
+			if tt.keyID != "" {
+				r.Header.Set(KeyIDHeader, tt.keyID)
+			}
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, r)
+
+			require.Equal(t, tt.wantCode, w.Code)
+			if tt.wantCode == http.StatusOK {
+				//Ответ подписан тем же ключом, что и запрос
+				assert.Equal(t, hex.EncodeToString(createSign(t, tt.key, []byte("ok"))), w.Header().Get(Header))
+			}
+		})
+	}
+}
+
+func TestMiddlewareDisabled(t *testing.T) {
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+
+	body := []byte(`[{"id":"Alloc","type":"gauge","value":1}]`)
+	request := func() *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(body))
+		r.Header.Set(Header, hex.EncodeToString(createSign(t, "shared", body)))
+		return r
+	}
+
+	//Ключ задали на лету - подпись проверяется
+	Initialize("", []byte("other"))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, request())
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	//Ключ убрали - запросы проходят без проверки и подписи ответа
+	Initialize("", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, request())
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get(Header))
+}
@@ -6,17 +6,20 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 
 	"github.com/AntonPashechko/yametrix/internal/logger"
 )
 
 type signWriter struct {
-	w http.ResponseWriter
+	w      http.ResponseWriter
+	signer *Signer
 }
 
-func newSignWriter(w http.ResponseWriter) *signWriter {
+func newSignWriter(w http.ResponseWriter, signer *Signer) *signWriter {
 	return &signWriter{
-		w: w,
+		w:      w,
+		signer: signer,
 	}
 }
 
@@ -25,12 +28,12 @@ func (m *signWriter) Header() http.Header {
 }
 
 func (m *signWriter) Write(p []byte) (int, error) {
-	sign, err := MetricsSigner.CreateSign(p)
+	sign, err := m.signer.CreateSign(p)
 	if err != nil {
 		return 0, fmt.Errorf("cannot sign request body: %w", err)
 	}
 
-	m.w.Header().Set("HashSHA256", hex.EncodeToString(sign))
+	m.w.Header().Set(Header, hex.EncodeToString(sign))
 	return m.w.Write(p)
 }
 
@@ -40,13 +43,26 @@ func (m *signWriter) WriteHeader(statusCode int) {
 
 func Middleware(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		//Подпись могли выключить при перечитывании конфигурации
+		if !Enabled() {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		//Ответ подписываем общим ключом, а если запрос подписан ключом агента - его ключом
+		signer := Shared()
+
+		bodyHash := r.Header.Get(Header)
+		if err := RequireAgentKey(strings.HasPrefix(r.URL.Path, "/update"), bodyHash, r.Header.Get(KeyIDHeader)); err != nil {
+			logger.Error(fmt.Sprintf("request %s %s: %s", r.Method, r.URL.Path, err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
 
 		// проверяем, что клиент отправил серверу заголовок HashSHA256
-		if bodyHash := r.Header.Get("HashSHA256"); bodyHash != `` {
+		if bodyHash != `` {
 			buf, _ := io.ReadAll(r.Body)
 
-			logger.Info("input body: %s", string(buf))
-
 			signValue, err := hex.DecodeString(bodyHash)
 			if err != nil {
 				logger.Error(fmt.Sprintf("bad request sign value: %s", err))
@@ -54,7 +70,8 @@ func Middleware(h http.Handler) http.Handler {
 				return
 			}
 
-			if err := MetricsSigner.VerifySign(buf, signValue); err != nil {
+			signer, err = Verify(r.Header.Get(KeyIDHeader), buf, signValue)
+			if err != nil {
 				logger.Error(fmt.Sprintf("bad request signature: %s", err))
 				w.WriteHeader(http.StatusBadRequest)
 				return
@@ -64,7 +81,13 @@ func Middleware(h http.Handler) http.Handler {
 			r.Body = rdr1
 		}
 
-		sw := newSignWriter(w)
+		//Только keyring и запрос без подписи - ответ подписать нечем
+		if signer == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		sw := newSignWriter(w, signer)
 
 		//Вызов целевого handler
 		h.ServeHTTP(sw, r)
@@ -5,20 +5,52 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"sync/atomic"
 
 	"github.com/AntonPashechko/yametrix/internal/logger"
 )
 
-var MetricsSigner *Signer
+const (
+	// Header - заголовок с подписью тела
+	Header = "HashSHA256"
+	// KeyIDHeader - заголовок с ID ключа агента, по нему сервер ищет ключ в keyring
+	KeyIDHeader = "HashKeyID"
+)
+
+// metricsSigner - общий ключ. На агенте им подписываются запросы, на сервере - проверяются запросы без ID ключа.
+// На сервере меняется на лету при перечитывании конфигурации, поэтому atomic
+var metricsSigner atomic.Pointer[Signer]
 
 type Signer struct {
-	key []byte
+	keyID string
+	key   []byte
+}
+
+func NewSigner(keyID string, key []byte) *Signer {
+	return &Signer{
+		keyID: keyID,
+		key:   key,
+	}
 }
 
-func Initialize(key []byte) {
-	MetricsSigner = &Signer{
-		key: key,
+// Initialize задает общий ключ, keyID передается серверу, пустой - не передается.
+// Пустой ключ выключает подпись общим ключом
+func Initialize(keyID string, key []byte) {
+	if len(key) == 0 {
+		metricsSigner.Store(nil)
+		return
 	}
+
+	metricsSigner.Store(NewSigner(keyID, key))
+}
+
+// Shared - общий ключ, nil - не задан
+func Shared() *Signer {
+	return metricsSigner.Load()
+}
+
+func (m *Signer) KeyID() string {
+	return m.keyID
 }
 
 func (m *Signer) CreateSign(buf []byte) ([]byte, error) {
@@ -32,6 +64,12 @@ func (m *Signer) CreateSign(buf []byte) ([]byte, error) {
 	return h.Sum(nil), nil
 }
 
+// matches сверяет подпись без логирования, keyring перебирает ключи
+func (m *Signer) matches(data []byte, signValue []byte) bool {
+	newSign, err := m.CreateSign(data)
+	return err == nil && hmac.Equal(newSign, signValue)
+}
+
 func (m *Signer) VerifySign(data []byte, signValue []byte) error {
 	newSign, err := m.CreateSign(data)
 	if err != nil {
@@ -47,3 +85,41 @@ func (m *Signer) VerifySign(data []byte, signValue []byte) error {
 
 	return nil
 }
+
+// Enabled - на сервере задан общий ключ или keyring
+func Enabled() bool {
+	return Shared() != nil || MetricsKeyring != nil
+}
+
+// RequireAgentKey проверяет, что обновление подписано ключом агента, если задан keyring.
+// Иначе агент с утекшим общим ключом или вовсе без подписи обходил бы ключи агентов
+func RequireAgentKey(update bool, signValue string, keyID string) error {
+	if !update || MetricsKeyring == nil {
+		return nil
+	}
+
+	if signValue == "" || keyID == "" {
+		return fmt.Errorf("update must be signed with an agent key")
+	}
+
+	return nil
+}
+
+// Verify проверяет подпись ключом агента из keyring, а без ID или keyring - общим ключом.
+// Возвращает ключ, которым сошлась подпись, им же подписывается ответ
+func Verify(keyID string, data []byte, signValue []byte) (*Signer, error) {
+	if keyID != "" && MetricsKeyring != nil {
+		return MetricsKeyring.Verify(keyID, data, signValue)
+	}
+
+	signer := Shared()
+	if signer == nil {
+		return nil, fmt.Errorf("request without key id, but no shared key")
+	}
+
+	if err := signer.VerifySign(data, signValue); err != nil {
+		return nil, err
+	}
+
+	return signer, nil
+}
@@ -5,82 +5,497 @@ import (
 	"encoding/json"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/AntonPashechko/yametrix/internal/models"
+	"github.com/AntonPashechko/yametrix/internal/summary"
+	"github.com/AntonPashechko/yametrix/internal/tenant"
 	"github.com/AntonPashechko/yametrix/pkg/utils"
 )
 
 var mux sync.Mutex
 
-type Storage struct {
+const (
+	defaultSummaryWindow = 10 * time.Minute
+	//Как часто чистить историю всех рядов, а не только обновленного
+	historyPruneInterval = time.Minute
+)
+
+// summaryEntry - скользящее окно наблюдений summary
+type summaryEntry struct {
+	metric models.MetricDTO
+	window *summary.Window
+}
+
+// metricsSet - ряды одного тенанта
+type metricsSet struct {
 	//ЗАГЛАВНЫЕ ЧТО БЫ СРАБОТАЛ json.Marshal
-	Gauge   map[string]models.MetricDTO
-	Counter map[string]models.MetricDTO
+	Gauge     map[string]models.MetricDTO
+	Counter   map[string]models.MetricDTO
+	Histogram map[string]models.MetricDTO
+
+	//История значений метрик, хранится не дольше historyRetention. В снимок не попадает,
+	//иначе при синхронной записи файл с историей переписывался бы целиком на каждое обновление
+	gaugeHistory   map[string][]models.MetricPoint
+	counterHistory map[string][]models.MetricPoint
+
+	//Окна summary живут только в памяти, при рестарте начинаются заново
+	summaries map[string]*summaryEntry
+}
+
+// init создает недостающие словари, в файлах старого формата гистограмм и истории нет
+func (m *metricsSet) init() {
+	if m.Gauge == nil {
+		m.Gauge = make(map[string]models.MetricDTO)
+	}
+	if m.Counter == nil {
+		m.Counter = make(map[string]models.MetricDTO)
+	}
+	if m.Histogram == nil {
+		m.Histogram = make(map[string]models.MetricDTO)
+	}
+	if m.gaugeHistory == nil {
+		m.gaugeHistory = make(map[string][]models.MetricPoint)
+	}
+	if m.counterHistory == nil {
+		m.counterHistory = make(map[string][]models.MetricPoint)
+	}
+	if m.summaries == nil {
+		m.summaries = make(map[string]*summaryEntry)
+	}
+}
+
+// size - количество рядов, оно и ограничивается квотой
+func (m *metricsSet) size() int {
+	return len(m.Gauge) + len(m.Counter) + len(m.Histogram) + len(m.summaries)
+}
+
+// exists - есть ли уже ряд такого типа
+func (m *metricsSet) exists(mType string, key string) bool {
+	var ok bool
+	switch mType {
+	case models.GaugeType:
+		_, ok = m.Gauge[key]
+	case models.CounterType:
+		_, ok = m.Counter[key]
+	case models.HistogramType:
+		_, ok = m.Histogram[key]
+	case models.SummaryType:
+		_, ok = m.summaries[key]
+	}
+	return ok
+}
+
+type Storage struct {
+	//Ряды тенанта по умолчанию лежат на верхнем уровне, как и до появления тенантов,
+	//поэтому старые файлы восстанавливаются без изменений
+	metricsSet
+	//Ряды остальных тенантов, у каждого свои словари
+	Tenants map[string]*metricsSet `json:",omitempty"`
+
+	historyRetention time.Duration //0 - история не ведется
+	historyPruned    time.Time     //Когда последний раз чистили историю всех рядов
+
+	summaryWindow time.Duration
+	//Наблюдения summary, накопленные агентом до отправки
+	observations map[string]models.MetricDTO
+
+	//Квоты на количество рядов по тенантам
+	quotas tenant.Quotas
+
+	journal Journal //nil - обновления не журналируются
+}
+
+// Journal - журнал обновлений (WAL). Append идет под mux до применения обновления,
+// поэтому порядок записей совпадает с порядком применения. Обновления батча пишутся одной записью.
+// Sync сбрасывает записи на диск и вызывается уже без mux, что бы fsync не держал хранилище
+type Journal interface {
+	Append(tenant string, ts time.Time, metrics ...models.MetricDTO) error
+	Sync() error
 }
 
-func (m *Storage) clearCounter() {
+// clearDeltas сбрасывает накопленные с прошлой выгрузки counter и histogram
+func (m *Storage) clearDeltas() {
 	m.Counter = make(map[string]models.MetricDTO)
+	m.Histogram = make(map[string]models.MetricDTO)
+	m.observations = make(map[string]models.MetricDTO)
 }
 
 func NewStorage() *Storage {
 
 	ms := &Storage{}
-	ms.Gauge = make(map[string]models.MetricDTO)
-	ms.Counter = make(map[string]models.MetricDTO)
+	ms.metricsSet.init()
+	ms.Tenants = make(map[string]*metricsSet)
+	ms.summaryWindow = defaultSummaryWindow
+	ms.observations = make(map[string]models.MetricDTO)
 
 	return ms
 }
 
-func (m *Storage) ApplyMetric(ctx context.Context, metric models.MetricDTO) {
-	if metric.MType == models.GaugeType {
-		m.SetGauge(ctx, metric)
-	} else if metric.MType == models.CounterType {
-		m.AddCounter(ctx, metric)
+// tenantSet возвращает ряды тенанта из контекста, вызывается под mux.
+// Для чтения ряды отсутствующего тенанта пустые, для записи - создаются
+func (m *Storage) tenantSet(ctx context.Context, create bool) *metricsSet {
+	name := tenant.FromContext(ctx)
+	if name == tenant.Default {
+		return &m.metricsSet
 	}
+
+	set, ok := m.Tenants[name]
+	if !ok {
+		set = &metricsSet{}
+		if create {
+			set.init()
+			m.Tenants[name] = set
+		}
+	}
+
+	return set
 }
 
-func (m *Storage) SetGauge(ctx context.Context, metric models.MetricDTO) error {
+// SetQuotas задает квоты тенантов на количество рядов
+func (m *Storage) SetQuotas(quotas tenant.Quotas) {
+	mux.Lock()
+	defer mux.Unlock()
+
+	m.quotas = quotas
+}
+
+// check проверяет обновления до применения: квоту на новые ряды и совместимость корзин гистограмм.
+// Возвращает результат слияния гистограмм, вызывается под mux
+func (m *Storage) check(ctx context.Context, set *metricsSet, metrics []models.MetricDTO) (map[string]*models.Histogram, error) {
+	added := make(map[string]struct{})
+	merged := make(map[string]*models.Histogram)
+
+	for _, metric := range metrics {
+		key := metric.SeriesKey()
+
+		switch metric.MType {
+		case models.GaugeType, models.CounterType, models.SummaryType:
+		case models.HistogramType:
+			histogram, ok := merged[key]
+			if !ok {
+				if val, exists := set.Histogram[key]; exists {
+					histogram = val.Histogram.Copy()
+				}
+			}
+
+			//Храним копию, что бы не зависеть от гистограммы вызывающего
+			if histogram == nil {
+				histogram = metric.Histogram.Copy()
+			} else if err := histogram.Merge(metric.Histogram); err != nil {
+				return nil, fmt.Errorf("cannot merge histogram %s: %w", key, err)
+			}
+			merged[key] = histogram
+		default:
+			return nil, fmt.Errorf("unknown metric type %s", metric.MType)
+		}
+
+		if !set.exists(metric.MType, key) {
+			added[metric.MType+key] = struct{}{}
+		}
+	}
+
+	if err := m.quotas.Check(tenant.FromContext(ctx), set.size(), len(added)); err != nil {
+		return nil, err
+	}
+
+	return merged, nil
+}
+
+// SetJournal включает журналирование обновлений gauge, counter и histogram.
+// Summary живут только в памяти, их не журналируем
+func (m *Storage) SetJournal(journal Journal) {
 	mux.Lock()
 	defer mux.Unlock()
 
-	m.Gauge[metric.ID] = metric
+	m.journal = journal
+}
+
+// writeJournal пишет обновления в журнал одной записью, если он задан, вызывается под mux
+func (m *Storage) writeJournal(ctx context.Context, metrics []models.MetricDTO, ts time.Time) error {
+	if m.journal == nil {
+		return nil
+	}
+
+	entries := make([]models.MetricDTO, 0, len(metrics))
+	for _, metric := range metrics {
+		if metric.MType != models.SummaryType {
+			entries = append(entries, metric)
+		}
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	if err := m.journal.Append(tenant.FromContext(ctx), ts, entries...); err != nil {
+		return fmt.Errorf("cannot write journal: %w", err)
+	}
+
 	return nil
 }
 
-func (m *Storage) AddCounter(ctx context.Context, metric models.MetricDTO) (*models.MetricDTO, error) {
+// Checkpoint снимает состояние для снимка. rotate вызывается под тем же mux,
+// поэтому в снимке ровно те обновления, что журнал записал до rotate
+func (m *Storage) Checkpoint(rotate func() error) ([]byte, error) {
 	mux.Lock()
 	defer mux.Unlock()
 
-	_, ok := m.Counter[metric.ID]
-	if ok {
-		*m.Counter[metric.ID].Delta += *metric.Delta
-	} else {
-		m.Counter[metric.ID] = metric
+	if err := rotate(); err != nil {
+		return nil, err
 	}
 
-	val := m.Counter[metric.ID]
+	data, err := json.Marshal(&m)
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal metrics: %w", err)
+	}
 
-	return &val, nil
+	return data, nil
 }
 
+// Replay применяет запись журнала с ее исходным временем целиком, как исходный батч.
+// В журнал она повторно не пишется
+func (m *Storage) Replay(tenantName string, ts time.Time, metrics ...models.MetricDTO) error {
+	mux.Lock()
+	defer mux.Unlock()
+
+	for _, metric := range metrics {
+		if metric.MType == models.SummaryType {
+			return fmt.Errorf("unknown metric type %s", metric.MType)
+		}
+	}
+
+	journal := m.journal
+	m.journal = nil
+	defer func() { m.journal = journal }()
+
+	_, err := m.update(tenant.WithTenant(context.Background(), tenantName), ts, metrics...)
+	return err
+}
+
+// SetSummaryWindow задает ширину скользящего окна для новых summary
+func (m *Storage) SetSummaryWindow(window time.Duration) {
+	mux.Lock()
+	defer mux.Unlock()
+
+	m.summaryWindow = window
+}
+
+// SetHistoryRetention включает ведение истории значений метрик с заданной глубиной хранения
+func (m *Storage) SetHistoryRetention(retention time.Duration) {
+	mux.Lock()
+	defer mux.Unlock()
+
+	m.historyRetention = retention
+}
+
+// prunePoints отбрасывает точки старше border. Точки упорядочены по времени, ищем первую актуальную
+func prunePoints(points []models.MetricPoint, border time.Time) []models.MetricPoint {
+	first := 0
+	for first < len(points) && points[first].Timestamp.Before(border) {
+		first++
+	}
+
+	return points[first:]
+}
+
+// appendPoint добавляет точку в историю и отбрасывает устаревшие, вызывается под mux.
+// Раз в historyPruneInterval чистится история всех рядов - ряды, которые больше не обновляются, тоже
+func (m *Storage) appendPoint(history map[string][]models.MetricPoint, key string, metric models.MetricDTO, ts time.Time) {
+	if m.historyRetention == 0 {
+		return
+	}
+
+	now := time.Now()
+	border := now.Add(-m.historyRetention)
+	history[key] = prunePoints(append(history[key], models.NewMetricPoint(metric, ts)), border)
+
+	if now.Sub(m.historyPruned) >= historyPruneInterval {
+		m.pruneHistory(border)
+		m.historyPruned = now
+	}
+}
+
+// pruneHistory отбрасывает устаревшие точки всех рядов всех тенантов, вызывается под mux
+func (m *Storage) pruneHistory(border time.Time) {
+	sets := []*metricsSet{&m.metricsSet}
+	for _, set := range m.Tenants {
+		sets = append(sets, set)
+	}
+
+	for _, set := range sets {
+		for _, history := range []map[string][]models.MetricPoint{set.gaugeHistory, set.counterHistory} {
+			for key, points := range history {
+				if points = prunePoints(points, border); len(points) == 0 {
+					delete(history, key)
+				} else {
+					history[key] = points
+				}
+			}
+		}
+	}
+}
+
+func (m *Storage) ApplyMetric(ctx context.Context, metric models.MetricDTO) error {
+	switch metric.MType {
+	case models.GaugeType:
+		return m.SetGauge(ctx, metric)
+	case models.CounterType:
+		_, err := m.AddCounter(ctx, metric)
+		return err
+	case models.HistogramType:
+		_, err := m.AddHistogram(ctx, metric)
+		return err
+	case models.SummaryType:
+		//Агент не считает квантили, а копит наблюдения для отправки на сервер
+		m.appendObservations(metric)
+		return nil
+	}
+
+	return fmt.Errorf("unknown metric type %s", metric.MType)
+}
+
+func (m *Storage) appendObservations(metric models.MetricDTO) {
+	mux.Lock()
+	defer mux.Unlock()
+
+	key := metric.SeriesKey()
+
+	val, ok := m.observations[key]
+	if !ok {
+		val = metric
+		val.Observations = nil
+	}
+
+	val.Observations = append(val.Observations, metric.Observations...)
+	m.observations[key] = val
+}
+
+func (m *Storage) SetGauge(ctx context.Context, metric models.MetricDTO) error {
+	_, err := m.write(ctx, metric)
+	return err
+}
+
+func (m *Storage) AddCounter(ctx context.Context, metric models.MetricDTO) (*models.MetricDTO, error) {
+	res, err := m.write(ctx, metric)
+	if err != nil {
+		return nil, err
+	}
+
+	return &res[0], nil
+}
+
+func (m *Storage) AddHistogram(ctx context.Context, metric models.MetricDTO) (*models.MetricDTO, error) {
+	res, err := m.write(ctx, metric)
+	if err != nil {
+		return nil, err
+	}
+
+	return &res[0], nil
+}
+
+func (m *Storage) AddSummary(ctx context.Context, metric models.MetricDTO) error {
+	_, err := m.write(ctx, metric)
+	return err
+}
+
+// AcceptMetricsBatch применяет батч целиком под одним mux: либо все обновления, либо ни одного
 func (m *Storage) AcceptMetricsBatch(ctx context.Context, metrics []models.MetricDTO) error {
+	_, err := m.write(ctx, metrics...)
+	return err
+}
+
+// write применяет обновления под mux, а сброса журнала на диск ждет уже без него.
+// Ошибка сброса возвращается клиенту, хотя в памяти обновление уже применено
+func (m *Storage) write(ctx context.Context, metrics ...models.MetricDTO) ([]models.MetricDTO, error) {
+	mux.Lock()
+	res, err := m.update(ctx, time.Now(), metrics...)
+	journal := m.journal
+	mux.Unlock()
+
+	if err != nil || journal == nil {
+		return res, err
+	}
+
+	if err := journal.Sync(); err != nil {
+		return nil, fmt.Errorf("cannot sync journal: %w", err)
+	}
+
+	return res, nil
+}
 
+// update проверяет обновления, пишет их в журнал и только потом применяет, ts - время точек истории.
+// После проверки применение не может завершиться ошибкой, поэтому обновления не применяются наполовину.
+// Возвращает значения рядов после каждого обновления, вызывается под mux
+func (m *Storage) update(ctx context.Context, ts time.Time, metrics ...models.MetricDTO) ([]models.MetricDTO, error) {
+	set := m.tenantSet(ctx, true)
+
+	merged, err := m.check(ctx, set, metrics)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.writeJournal(ctx, metrics, ts); err != nil {
+		return nil, err
+	}
+
+	res := make([]models.MetricDTO, 0, len(metrics))
 	for _, metric := range metrics {
-		if metric.MType == models.GaugeType {
-			m.SetGauge(ctx, metric)
-		} else if metric.MType == models.CounterType {
-			m.AddCounter(ctx, metric)
+		res = append(res, m.apply(set, metric, merged, ts))
+	}
+
+	return res, nil
+}
+
+// apply применяет проверенное обновление, вызывается под mux
+func (m *Storage) apply(set *metricsSet, metric models.MetricDTO, merged map[string]*models.Histogram, ts time.Time) models.MetricDTO {
+	key := metric.SeriesKey()
+
+	switch metric.MType {
+	case models.GaugeType:
+		set.Gauge[key] = metric
+		m.appendPoint(set.gaugeHistory, key, metric, ts)
+
+	case models.CounterType:
+		if val, ok := set.Counter[key]; ok {
+			*val.Delta += *metric.Delta
+		} else {
+			set.Counter[key] = metric
+		}
+		metric = set.Counter[key]
+		m.appendPoint(set.counterHistory, key, metric, ts)
+
+	case models.HistogramType:
+		//Гистограмма уже слита при проверке, история у гистограмм не ведется
+		val, ok := set.Histogram[key]
+		if !ok {
+			val = metric
+		}
+		val.Histogram = merged[key]
+		set.Histogram[key] = val
+
+		metric = val
+		metric.Histogram = val.Histogram.Copy()
+
+	case models.SummaryType:
+		entry, ok := set.summaries[key]
+		if !ok {
+			entry = &summaryEntry{
+				metric: models.MetricDTO{ID: metric.ID, MType: models.SummaryType, Labels: metric.Labels},
+				window: summary.NewWindow(m.summaryWindow),
+			}
+			set.summaries[key] = entry
 		}
+		entry.window.Observe(time.Now(), metric.Observations...)
 	}
 
-	return nil
+	return metric
 }
 
 func (m *Storage) GetGauge(ctx context.Context, key string) (*models.MetricDTO, error) {
 	mux.Lock()
 	defer mux.Unlock()
 
-	val, ok := m.Gauge[key]
+	val, ok := m.tenantSet(ctx, false).Gauge[key]
 	if !ok {
 		return nil, fmt.Errorf("gauge mertic %s is not exist", key)
 	}
@@ -91,31 +506,153 @@ func (m *Storage) GetCounter(ctx context.Context, key string) (*models.MetricDTO
 	mux.Lock()
 	defer mux.Unlock()
 
-	val, ok := m.Counter[key]
+	val, ok := m.tenantSet(ctx, false).Counter[key]
 	if !ok {
 		return nil, fmt.Errorf("counter mertic %s is not exist", key)
 	}
 	return &val, nil
 }
 
-func (m *Storage) GetMetricsList(ctx context.Context) ([]string, error) {
+func (m *Storage) GetHistogram(ctx context.Context, key string) (*models.MetricDTO, error) {
+	mux.Lock()
+	defer mux.Unlock()
+
+	val, ok := m.tenantSet(ctx, false).Histogram[key]
+	if !ok {
+		return nil, fmt.Errorf("histogram mertic %s is not exist", key)
+	}
+
+	val.Histogram = val.Histogram.Copy()
+
+	return &val, nil
+}
+
+func (m *Storage) GetSummary(ctx context.Context, key string, quantiles []float64) (*models.MetricDTO, error) {
 	mux.Lock()
 	defer mux.Unlock()
 
-	list := make([]string, 0, len(m.Counter)+len(m.Gauge))
+	entry, ok := m.tenantSet(ctx, false).summaries[key]
+	if !ok {
+		return nil, fmt.Errorf("summary mertic %s is not exist", key)
+	}
+
+	val := entry.metric
+	val.Summary = entry.window.Snapshot(time.Now(), quantiles)
 
-	for name, metric := range m.Gauge {
+	return &val, nil
+}
+
+func (m *Storage) GetMetricsList(ctx context.Context, filter map[string]string) ([]string, error) {
+	mux.Lock()
+	defer mux.Unlock()
+
+	set := m.tenantSet(ctx, false)
+	list := make([]string, 0, set.size())
+
+	for key, metric := range set.Gauge {
+		if !models.MatchLabels(metric.Labels, filter) {
+			continue
+		}
 		strValue := utils.Float64ToStr(*metric.Value)
-		list = append(list, fmt.Sprintf("%s = %s", name, strValue))
+		list = append(list, fmt.Sprintf("%s = %s", key, strValue))
+	}
+
+	for key, metric := range set.Counter {
+		if !models.MatchLabels(metric.Labels, filter) {
+			continue
+		}
+		list = append(list, fmt.Sprintf("%s = %d", key, *metric.Delta))
+	}
+
+	for key, metric := range set.Histogram {
+		if !models.MatchLabels(metric.Labels, filter) {
+			continue
+		}
+		list = append(list, fmt.Sprintf("%s = count %d, sum %s", key, metric.Histogram.Count, utils.Float64ToStr(metric.Histogram.Sum)))
 	}
 
-	for name, metric := range m.Counter {
-		list = append(list, fmt.Sprintf("%s = %d", name, *metric.Delta))
+	now := time.Now()
+	for key, entry := range set.summaries {
+		if !models.MatchLabels(entry.metric.Labels, filter) {
+			continue
+		}
+		snapshot := entry.window.Snapshot(now, nil)
+		list = append(list, fmt.Sprintf("%s = count %d, sum %s", key, snapshot.Count, utils.Float64ToStr(snapshot.Sum)))
 	}
 
 	return list, nil
 }
 
+func (m *Storage) GetMetrics(ctx context.Context, filter map[string]string) ([]models.MetricDTO, error) {
+	mux.Lock()
+	defer mux.Unlock()
+
+	set := m.tenantSet(ctx, false)
+	metrics := make([]models.MetricDTO, 0, set.size())
+
+	for _, metric := range set.Gauge {
+		if models.MatchLabels(metric.Labels, filter) {
+			metrics = append(metrics, metric)
+		}
+	}
+
+	for _, metric := range set.Counter {
+		if models.MatchLabels(metric.Labels, filter) {
+			metrics = append(metrics, metric)
+		}
+	}
+
+	for _, metric := range set.Histogram {
+		if models.MatchLabels(metric.Labels, filter) {
+			metric.Histogram = metric.Histogram.Copy()
+			metrics = append(metrics, metric)
+		}
+	}
+
+	now := time.Now()
+	for _, entry := range set.summaries {
+		if models.MatchLabels(entry.metric.Labels, filter) {
+			metric := entry.metric
+			metric.Summary = entry.window.Snapshot(now, models.DefaultQuantiles)
+			metrics = append(metrics, metric)
+		}
+	}
+
+	return metrics, nil
+}
+
+func (m *Storage) GetHistory(ctx context.Context, mType string, key string, from time.Time, to time.Time) ([]models.MetricPoint, error) {
+	mux.Lock()
+	defer mux.Unlock()
+
+	set := m.tenantSet(ctx, false)
+
+	var history map[string][]models.MetricPoint
+	switch mType {
+	case models.GaugeType:
+		history = set.gaugeHistory
+	case models.CounterType:
+		history = set.counterHistory
+	default:
+		return nil, fmt.Errorf("unknown metric type %s", mType)
+	}
+
+	points, ok := history[key]
+	if !ok {
+		return nil, fmt.Errorf("%s mertic %s has no history", mType, key)
+	}
+
+	res := make([]models.MetricPoint, 0)
+	for _, point := range points {
+		if point.Timestamp.Before(from) || point.Timestamp.After(to) {
+			continue
+		}
+		res = append(res, point)
+	}
+
+	return res, nil
+}
+
 func (m *Storage) GetAllMetrics() []models.MetricDTO {
 	mux.Lock()
 	defer mux.Unlock()
@@ -130,7 +667,15 @@ func (m *Storage) GetAllMetrics() []models.MetricDTO {
 		metrics = append(metrics, metric)
 	}
 
-	defer m.clearCounter()
+	for _, metric := range m.Histogram {
+		metrics = append(metrics, metric)
+	}
+
+	for _, metric := range m.observations {
+		metrics = append(metrics, metric)
+	}
+
+	defer m.clearDeltas()
 
 	return metrics
 }
@@ -155,6 +700,14 @@ func (m *Storage) Restore(data []byte) error {
 		return fmt.Errorf("cannot unmarshal metrics: %w", err)
 	}
 
+	m.metricsSet.init()
+	if m.Tenants == nil {
+		m.Tenants = make(map[string]*metricsSet)
+	}
+	for _, set := range m.Tenants {
+		set.init()
+	}
+
 	return nil
 }
 
@@ -2,10 +2,16 @@ package memstorage
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/AntonPashechko/yametrix/internal/models"
+	"github.com/AntonPashechko/yametrix/internal/tenant"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewStorage(t *testing.T) {
@@ -112,7 +118,7 @@ func TestMemStorage_GetMetricsList(t *testing.T) {
 				storage.AddCounter(context.Background(), models.NewCounterMetric(k, c))
 			}
 
-			list, err := storage.GetMetricsList(context.Background())
+			list, err := storage.GetMetricsList(context.Background(), nil)
 			assert.NoError(t, err)
 
 			if tt.isWant {
@@ -188,3 +194,193 @@ func TestMemStorage_GetMetricsList(t *testing.T) {
 		})
 	}
 }*/
+
+func TestMemStorage_Tenants(t *testing.T) {
+	storage := NewStorage()
+
+	teamA := tenant.WithTenant(context.Background(), "team-a")
+	teamB := tenant.WithTenant(context.Background(), "team-b")
+
+	require.NoError(t, storage.SetGauge(teamA, models.NewGaugeMetric("Alloc", 1)))
+	require.NoError(t, storage.SetGauge(teamB, models.NewGaugeMetric("Alloc", 2)))
+	require.NoError(t, storage.SetGauge(context.Background(), models.NewGaugeMetric("Alloc", 3)))
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want float64
+	}{
+		{"teamA", teamA, 1},
+		{"teamB", teamB, 2},
+		{"default", context.Background(), 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metric, err := storage.GetGauge(tt.ctx, "Alloc")
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, *metric.Value)
+
+			list, err := storage.GetMetricsList(tt.ctx, nil)
+			require.NoError(t, err)
+			assert.Len(t, list, 1)
+		})
+	}
+
+	_, err := storage.GetGauge(tenant.WithTenant(context.Background(), "team-c"), "Alloc")
+	assert.Error(t, err)
+
+	//Тенанты переживают сохранение и восстановление
+	data, err := storage.Marshal()
+	require.NoError(t, err)
+	restored := NewStorage()
+	require.NoError(t, restored.Restore(data))
+	for _, tt := range tests {
+		metric, err := restored.GetGauge(tt.ctx, "Alloc")
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, *metric.Value)
+	}
+}
+
+func TestMemStorage_TenantQuotas(t *testing.T) {
+	storage := NewStorage()
+	storage.SetQuotas(tenant.Quotas{Default: 2, Tenants: map[string]int{"big": 0}})
+
+	small := tenant.WithTenant(context.Background(), "small")
+	big := tenant.WithTenant(context.Background(), "big")
+
+	require.NoError(t, storage.SetGauge(small, models.NewGaugeMetric("Alloc", 1)))
+	_, err := storage.AddCounter(small, models.NewCounterMetric("PollCount", 1))
+	require.NoError(t, err)
+
+	//Существующие ряды обновляются и при исчерпанной квоте
+	assert.NoError(t, storage.SetGauge(small, models.NewGaugeMetric("Alloc", 2)))
+	_, err = storage.AddCounter(small, models.NewCounterMetric("PollCount", 1))
+	assert.NoError(t, err)
+
+	err = storage.SetGauge(small, models.NewGaugeMetric("Frees", 1))
+	assert.ErrorIs(t, err, tenant.ErrQuotaExceeded)
+
+	//Батч, не влезающий в квоту, не принимается целиком
+	other := tenant.WithTenant(context.Background(), "other")
+	err = storage.AcceptMetricsBatch(other, []models.MetricDTO{
+		models.NewGaugeMetric("Alloc", 1),
+		models.NewGaugeMetric("Frees", 1),
+		models.NewGaugeMetric("Mallocs", 1),
+	})
+	assert.ErrorIs(t, err, tenant.ErrQuotaExceeded)
+	list, err := storage.GetMetricsList(other, nil)
+	require.NoError(t, err)
+	assert.Empty(t, list)
+
+	for _, id := range []string{"Alloc", "Frees", "Mallocs"} {
+		assert.NoError(t, storage.SetGauge(big, models.NewGaugeMetric(id, 1)))
+	}
+}
+
+func TestMemStorage_BatchAtomic(t *testing.T) {
+	storage := NewStorage()
+	storage.SetQuotas(tenant.Quotas{Default: 10})
+
+	//Параллельные батчи вместе не превышают квоту
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			batch := make([]models.MetricDTO, 0, 3)
+			for j := 0; j < 3; j++ {
+				batch = append(batch, models.NewGaugeMetric(fmt.Sprintf("Gauge%d_%d", i, j), 1))
+			}
+			storage.AcceptMetricsBatch(context.Background(), batch)
+		}(i)
+	}
+	wg.Wait()
+
+	list, err := storage.GetMetricsList(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Len(t, list, 9)
+
+	//Батч с несовместимой гистограммой не применяется даже частично
+	storage = NewStorage()
+	require.NoError(t, storage.SetGauge(context.Background(), models.NewGaugeMetric("Alloc", 1)))
+	_, err = storage.AddHistogram(context.Background(), models.NewHistogramMetric("Latency", models.NewHistogram([]float64{1, 2})))
+	require.NoError(t, err)
+
+	err = storage.AcceptMetricsBatch(context.Background(), []models.MetricDTO{
+		models.NewGaugeMetric("Alloc", 2),
+		models.NewHistogramMetric("Latency", models.NewHistogram([]float64{1})),
+	})
+	assert.ErrorIs(t, err, models.ErrHistogramBounds)
+
+	metric, err := storage.GetGauge(context.Background(), "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, float64(1), *metric.Value)
+}
+
+type testJournal struct {
+	err     error
+	entries []models.MetricDTO
+}
+
+func (m *testJournal) Append(tenant string, ts time.Time, metrics ...models.MetricDTO) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.entries = append(m.entries, metrics...)
+	return nil
+}
+
+func (m *testJournal) Sync() error {
+	return nil
+}
+
+func TestMemStorage_Journal(t *testing.T) {
+	storage := NewStorage()
+	storage.SetQuotas(tenant.Quotas{Default: 1})
+	storage.SetHistoryRetention(time.Hour)
+
+	journal := &testJournal{err: errors.New("disk full")}
+	storage.SetJournal(journal)
+
+	//Обновление, не записанное в журнал, не применяется и не занимает квоту
+	assert.Error(t, storage.SetGauge(context.Background(), models.NewGaugeMetric("Alloc", 1)))
+	_, err := storage.GetGauge(context.Background(), "Alloc")
+	assert.Error(t, err)
+
+	journal.err = nil
+	require.NoError(t, storage.SetGauge(context.Background(), models.NewGaugeMetric("Frees", 1)))
+	assert.Len(t, journal.entries, 1)
+
+	//Восстановление из журнала в журнал не пишется, а точка истории получает исходное время
+	ts := time.Now().Add(-time.Minute).Truncate(time.Second)
+	require.NoError(t, storage.Replay("", ts, models.NewGaugeMetric("Frees", 2)))
+	assert.Len(t, journal.entries, 1)
+
+	history, err := storage.GetHistory(context.Background(), models.GaugeType, "Frees", ts.Add(-time.Second), ts.Add(time.Second))
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.True(t, ts.Equal(history[0].Timestamp))
+}
+
+func TestMemStorage_HistoryPrune(t *testing.T) {
+	ctx := context.Background()
+	storage := NewStorage()
+	storage.SetHistoryRetention(time.Hour)
+
+	require.NoError(t, storage.Replay("", time.Now().Add(-45*time.Minute), models.NewGaugeMetric("Old", 1)))
+	_, err := storage.GetHistory(ctx, models.GaugeType, "Old", time.Now().Add(-time.Hour), time.Now())
+	require.NoError(t, err)
+
+	//Глубину уменьшили - обновление другого ряда чистит и историю ряда, который больше не пишется
+	storage.SetHistoryRetention(30 * time.Minute)
+	storage.historyPruned = time.Time{}
+	require.NoError(t, storage.SetGauge(ctx, models.NewGaugeMetric("New", 1)))
+
+	_, err = storage.GetHistory(ctx, models.GaugeType, "Old", time.Now().Add(-time.Hour), time.Now())
+	assert.Error(t, err)
+
+	//История в снимок не попадает
+	data, err := storage.Marshal()
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "History")
+}
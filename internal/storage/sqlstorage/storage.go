@@ -3,46 +3,98 @@ package sqlstorage
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
 
 	"github.com/AntonPashechko/yametrix/internal/models"
+	"github.com/AntonPashechko/yametrix/internal/scheduler"
 	"github.com/AntonPashechko/yametrix/internal/storage"
+	"github.com/AntonPashechko/yametrix/internal/tenant"
 	"github.com/AntonPashechko/yametrix/pkg/utils"
 )
 
+// Все запросы к метрикам разделены по тенанту, он всегда первый параметр
 const (
-	setGaugeSQL       = "INSERT INTO metrics (id, type, value) VALUES($1,$2,$3) ON CONFLICT (id) DO UPDATE SET value = $3"
-	addCounterSQL     = "INSERT INTO metrics (id, type, delta) VALUES($1,$2,$3) ON CONFLICT (id) DO UPDATE SET delta = metrics.delta + $3"
-	getAllMerticsSQL  = "SELECT * FROM metrics"
-	selectMerticsByID = "SELECT * FROM metrics WHERE id = $1"
-
-	setGaugesBatch   = "INSERT INTO metrics (id, type, value) VALUES%s ON CONFLICT (id) DO UPDATE SET value = EXCLUDED.value"
-	setCountersBatch = "INSERT INTO metrics (id, type, delta) VALUES%s ON CONFLICT (id) DO UPDATE SET delta = metrics.delta + EXCLUDED.delta"
+	setGaugeSQL       = "INSERT INTO metrics (tenant, id, labels, type, value) VALUES($1,$2,$3,$4,$5) ON CONFLICT (tenant, type, id, labels) DO UPDATE SET value = $5"
+	addCounterSQL     = "INSERT INTO metrics (tenant, id, labels, type, delta) VALUES($1,$2,$3,$4,$5) ON CONFLICT (tenant, type, id, labels) DO UPDATE SET delta = metrics.delta + $5"
+	getAllMerticsSQL  = "SELECT id, labels, type, delta, value, histogram FROM metrics WHERE tenant = $1"
+	selectMerticsByID = "SELECT id, labels, type, delta, value, histogram FROM metrics WHERE tenant = $1 AND id = $2 AND labels = $3 AND type = $4"
+
+	createMetricSQL    = "INSERT INTO metrics (tenant, id, labels, type) VALUES($1,$2,$3,$4) ON CONFLICT (tenant, type, id, labels) DO NOTHING"
+	lockHistogramSQL   = "SELECT id, labels, type, delta, value, histogram FROM metrics WHERE tenant = $1 AND id = $2 AND labels = $3 AND type = 'histogram' FOR UPDATE"
+	updateHistogramSQL = "UPDATE metrics SET histogram = $4 WHERE tenant = $1 AND id = $2 AND labels = $3 AND type = 'histogram'"
+
+	addObservationsSQL = "INSERT INTO metrics_observations (tenant, id, labels, value) VALUES%s"
+	pruneSummarySQL    = "DELETE FROM metrics_observations WHERE ts < $1"
+	selectSummarySQL   = "SELECT COALESCE(sum(value), 0), count(*) FROM metrics_observations WHERE tenant = $1 AND id = $2 AND labels = $3 AND ts >= $4"
+	selectQuantileSQL  = "SELECT percentile_disc($5) WITHIN GROUP (ORDER BY value) FROM metrics_observations WHERE tenant = $1 AND id = $2 AND labels = $3 AND ts >= $4"
+
+	setGaugesBatch   = "INSERT INTO metrics (tenant, id, labels, type, value) VALUES%s ON CONFLICT (tenant, type, id, labels) DO UPDATE SET value = EXCLUDED.value"
+	setCountersBatch = "INSERT INTO metrics (tenant, id, labels, type, delta) VALUES%s ON CONFLICT (tenant, type, id, labels) DO UPDATE SET delta = metrics.delta + EXCLUDED.delta"
+
+	addHistorySQL      = "INSERT INTO metrics_history (tenant, id, labels, type, delta, value) VALUES($1,$2,$3,$4,$5,$6)"
+	addHistoryBatchSQL = "INSERT INTO metrics_history (tenant, id, labels, type, delta, value) SELECT tenant, id, labels, type, delta, value FROM metrics WHERE tenant = $1 AND type || ':' || id || labels = ANY($2)"
+	pruneHistorySQL    = "DELETE FROM metrics_history WHERE ts < $1"
+	selectHistorySQL   = "SELECT ts, delta, value FROM metrics_history WHERE tenant = $1 AND type = $2 AND id = $3 AND labels = $4 AND ts BETWEEN $5 AND $6 ORDER BY ts"
+
+	countSeriesSQL = "SELECT count(*) FROM metrics WHERE tenant = $1"
+	countExistsSQL = "SELECT count(*) FROM metrics WHERE tenant = $1 AND type || ':' || id || labels = ANY($2)"
+	lockTenantSQL  = "SELECT pg_advisory_xact_lock(hashtext($1))"
 )
 
 var _ storage.MetricsStorage = &Storage{}
 
+// pruneInterval - период удаления устаревших данных в секундах, на каждой записи это был бы полный проход
+const pruneInterval = 60
+
 // Store реализует интерфейс store.Store и позволяет взаимодействовать с СУБД PostgreSQL
 type Storage struct {
 	// Поле conn содержит объект соединения с СУБД
 	conn *sql.DB
+	// Глубина хранения истории метрик, 0 - история не ведется
+	historyRetention time.Duration
+	// Ширина скользящего окна summary
+	summaryWindow time.Duration
+	// Квоты тенантов на количество рядов
+	quotas tenant.Quotas
+	// Периодическое удаление устаревших данных
+	pruneScheduler scheduler.Scheduler
+}
+
+// pruner - задача шедулера, удаляет устаревшие данные
+type pruner struct {
+	storage *Storage
+}
+
+func (m pruner) Work() error {
+	return m.storage.prune(context.Background())
 }
 
 // NewStore возвращает новый экземпляр PostgreSQL хранилища
-func NewStorage(dns string) (*Storage, error) {
+func NewStorage(dns string, historyRetention time.Duration, summaryWindow time.Duration) (*Storage, error) {
 	//Храним метрики в базе postgres
 	conn, err := sql.Open("pgx", dns)
 	if err != nil {
 		return nil, fmt.Errorf("cannot create connection db: %w", err)
 	}
 
-	storage := &Storage{conn: conn}
+	storage := &Storage{conn: conn, historyRetention: historyRetention, summaryWindow: summaryWindow}
 	if err := storage.applyDBMigrations(context.Background()); err != nil {
 		return nil, fmt.Errorf("cannot bootstarp db: %w", err)
 	}
-	return &Storage{conn: conn}, nil
+
+	//Наблюдения summary за пределами окна удаляются всегда, история - если ведется
+	storage.pruneScheduler = scheduler.NewScheduler(pruneInterval, pruner{storage: storage})
+	go storage.pruneScheduler.Start()
+
+	return storage, nil
+}
+
+// SetQuotas задает квоты тенантов на количество рядов
+func (m *Storage) SetQuotas(quotas tenant.Quotas) {
+	m.quotas = quotas
 }
 
 // Bootstrap подготавливает БД к работе, создавая необходимые таблицы и индексы
@@ -59,52 +111,339 @@ func (m *Storage) applyDBMigrations(ctx context.Context) error {
 	// создаём таблицу для хранения метрик
 	tx.ExecContext(ctx, `
         CREATE TABLE IF NOT EXISTS metrics (
-            id varchar(128) PRIMARY KEY,
+            id varchar(128),
+			labels varchar(1024) NOT NULL DEFAULT '',
+			type varchar(128),
+			delta bigint,
+			value double precision,
+			histogram jsonb
+        )
+    `)
+
+	// метки входят в идентификатор метрики, в таблицах старого формата их нет
+	tx.ExecContext(ctx, `ALTER TABLE metrics ADD COLUMN IF NOT EXISTS labels varchar(1024) NOT NULL DEFAULT ''`)
+	tx.ExecContext(ctx, `ALTER TABLE metrics DROP CONSTRAINT IF EXISTS metrics_pkey`)
+	// метрики разделены по тенантам, старые строки попадают в тенант по умолчанию
+	tx.ExecContext(ctx, `ALTER TABLE metrics ADD COLUMN IF NOT EXISTS tenant varchar(64) NOT NULL DEFAULT ''`)
+	tx.ExecContext(ctx, `DROP INDEX IF EXISTS metrics_id_labels_idx`)
+	// тип входит в ключ ряда, как в memstorage: gauge и counter с одним именем - разные ряды
+	tx.ExecContext(ctx, `DROP INDEX IF EXISTS metrics_tenant_id_labels_idx`)
+	tx.ExecContext(ctx, `CREATE UNIQUE INDEX IF NOT EXISTS metrics_tenant_type_id_labels_idx ON metrics (tenant, type, id, labels)`)
+	tx.ExecContext(ctx, `ALTER TABLE metrics ADD COLUMN IF NOT EXISTS histogram jsonb`)
+
+	// создаём таблицу для хранения истории значений метрик
+	tx.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS metrics_history (
+            id varchar(128),
+			labels varchar(1024) NOT NULL DEFAULT '',
 			type varchar(128),
 			delta bigint,
-			value double precision
+			value double precision,
+			ts timestamptz NOT NULL DEFAULT now()
         )
     `)
+	tx.ExecContext(ctx, `ALTER TABLE metrics_history ADD COLUMN IF NOT EXISTS tenant varchar(64) NOT NULL DEFAULT ''`)
+	tx.ExecContext(ctx, `DROP INDEX IF EXISTS metrics_history_series_idx`)
+	tx.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS metrics_history_tenant_series_idx ON metrics_history (tenant, type, id, labels, ts)`)
+	tx.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS metrics_history_ts_idx ON metrics_history (ts)`)
+
+	// создаём таблицу для наблюдений summary за скользящее окно
+	tx.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS metrics_observations (
+            id varchar(128),
+			labels varchar(1024) NOT NULL DEFAULT '',
+			value double precision,
+			ts timestamptz NOT NULL DEFAULT now()
+        )
+    `)
+	tx.ExecContext(ctx, `ALTER TABLE metrics_observations ADD COLUMN IF NOT EXISTS tenant varchar(64) NOT NULL DEFAULT ''`)
+	tx.ExecContext(ctx, `DROP INDEX IF EXISTS metrics_observations_series_idx`)
+	tx.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS metrics_observations_tenant_series_idx ON metrics_observations (tenant, id, labels, ts)`)
+	tx.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS metrics_observations_ts_idx ON metrics_observations (ts)`)
 
 	// коммитим транзакцию
 	return tx.Commit()
 }
 
-// GetGauge implements storage.MetricsStorage
-func (m *Storage) getMetricByID(ctx context.Context, id string) (*models.MetricDTO, error) {
-	// делаем запрос
-	row := m.conn.QueryRowContext(ctx, selectMerticsByID, id)
-	// готовим переменную для чтения результата
+// scanner - общий интерфейс *sql.Row и *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
 
+// scanMetric разбирает строку таблицы metrics
+func scanMetric(row scanner) (*models.MetricDTO, error) {
 	var metric models.MetricDTO
-	err := row.Scan(&metric.ID, &metric.MType, &metric.Delta, &metric.Value) // разбираем результат
+	var labels string
+	var histogram []byte
+
+	err := row.Scan(&metric.ID, &labels, &metric.MType, &metric.Delta, &metric.Value, &histogram)
 	if err != nil {
 		return nil, fmt.Errorf("cannot scan row: %w", err)
 	}
+
+	metric.Labels, err = models.ParseLabels(labels)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse labels of metric %s: %w", metric.ID, err)
+	}
+
+	if histogram != nil {
+		metric.Histogram = new(models.Histogram)
+		if err := json.Unmarshal(histogram, metric.Histogram); err != nil {
+			return nil, fmt.Errorf("cannot unmarshal histogram of metric %s: %w", metric.ID, err)
+		}
+	}
+
 	return &metric, nil
 }
 
+// typedKey - ключ ряда с типом, как его сравнивают countExistsSQL и addHistoryBatchSQL
+func typedKey(mType string, key string) string {
+	return mType + ":" + key
+}
+
+// getMetricByID ищет ряд метрики заданного типа
+func (m *Storage) getMetricByID(ctx context.Context, mType string, key string) (*models.MetricDTO, error) {
+	id, labels := models.SplitSeriesKey(key)
+
+	// делаем запрос
+	row := m.conn.QueryRowContext(ctx, selectMerticsByID, tenant.FromContext(ctx), id, labels, mType)
+	// разбираем результат
+	return scanMetric(row)
+}
+
+// execer - общий интерфейс *sql.DB и *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// querier - общий интерфейс *sql.DB и *sql.Tx для запросов
+type querier interface {
+	execer
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// checkQuota проверяет, что новые из переданных рядов (ключи typedKey) влезут в квоту тенанта.
+// Проверка и вставка должны идти в одной транзакции под блокировкой тенанта, иначе параллельные запросы превысят квоту
+func (m *Storage) checkQuota(ctx context.Context, db querier, keys []string) error {
+	name := tenant.FromContext(ctx)
+	if m.quotas.Limit(name) == 0 || len(keys) == 0 {
+		return nil
+	}
+
+	if _, err := db.ExecContext(ctx, lockTenantSQL, name); err != nil {
+		return fmt.Errorf("cannot lock tenant: %w", err)
+	}
+
+	var count, exists int
+	if err := db.QueryRowContext(ctx, countSeriesSQL, name).Scan(&count); err != nil {
+		return fmt.Errorf("cannot count series: %w", err)
+	}
+	if err := db.QueryRowContext(ctx, countExistsSQL, name, keys).Scan(&exists); err != nil {
+		return fmt.Errorf("cannot count series: %w", err)
+	}
+
+	return m.quotas.Check(name, count, len(keys)-exists)
+}
+
+// addHistory фиксирует значение метрики в истории и удаляет устаревшие точки
+func (m *Storage) addHistory(ctx context.Context, db execer, metric models.MetricDTO) error {
+	if m.historyRetention == 0 {
+		return nil
+	}
+
+	if _, err := db.ExecContext(ctx, addHistorySQL, tenant.FromContext(ctx), metric.ID, models.LabelsString(metric.Labels), metric.MType, metric.Delta, metric.Value); err != nil {
+		return fmt.Errorf("cannot insert history of metric %s: %w", metric.ID, err)
+	}
+
+	return nil
+}
+
+// prune удаляет наблюдения summary за пределами окна и устаревшие точки истории, вызывается шедулером
+func (m *Storage) prune(ctx context.Context) error {
+	if _, err := m.conn.ExecContext(ctx, pruneSummarySQL, time.Now().Add(-m.summaryWindow)); err != nil {
+		return fmt.Errorf("cannot prune observations: %w", err)
+	}
+
+	if m.historyRetention == 0 {
+		return nil
+	}
+
+	if _, err := m.conn.ExecContext(ctx, pruneHistorySQL, time.Now().Add(-m.historyRetention)); err != nil {
+		return fmt.Errorf("cannot prune metrics history: %w", err)
+	}
+
+	return nil
+}
+
 // AddCounter implements storage.MetricsStorage
 func (m *Storage) AddCounter(ctx context.Context, metric models.MetricDTO) (*models.MetricDTO, error) {
+	tx, err := m.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot start a transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := m.checkQuota(ctx, tx, []string{typedKey(metric.MType, metric.SeriesKey())}); err != nil {
+		return nil, err
+	}
+
+	labels := models.LabelsString(metric.Labels)
+
 	//Если метрики с таким именем не существует - вставляем, иначе обновляем
-	_, err := m.conn.ExecContext(ctx, addCounterSQL, metric.ID, metric.MType, metric.Delta)
+	_, err = tx.ExecContext(ctx, addCounterSQL, tenant.FromContext(ctx), metric.ID, labels, metric.MType, metric.Delta)
 
 	if err != nil {
 		return nil, fmt.Errorf("cannot insert gauge metric %s: %w", metric.ID, err)
 	}
 
-	return m.getMetricByID(ctx, metric.ID)
+	res, err := scanMetric(tx.QueryRowContext(ctx, selectMerticsByID, tenant.FromContext(ctx), metric.ID, labels, models.CounterType))
+	if err != nil {
+		return nil, err
+	}
+
+	//В историю пишем уже накопленное значение
+	if err := m.addHistory(ctx, tx, *res); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("cannot commit the transaction: %w", err)
+	}
+
+	return res, nil
+}
+
+// mergeHistogram добавляет значения гистограммы к уже сохраненной в рамках транзакции
+func (m *Storage) mergeHistogram(ctx context.Context, tx *sql.Tx, metric models.MetricDTO) (*models.MetricDTO, error) {
+	labels := models.LabelsString(metric.Labels)
+	name := tenant.FromContext(ctx)
+
+	//Сперва гарантируем наличие строки, что бы ее можно было заблокировать
+	if _, err := tx.ExecContext(ctx, createMetricSQL, name, metric.ID, labels, metric.MType); err != nil {
+		return nil, fmt.Errorf("cannot insert histogram metric %s: %w", metric.ID, err)
+	}
+
+	res, err := scanMetric(tx.QueryRowContext(ctx, lockHistogramSQL, name, metric.ID, labels))
+	if err != nil {
+		return nil, err
+	}
+
+	if res.Histogram == nil {
+		res.Histogram = metric.Histogram.Copy()
+	} else if err := res.Histogram.Merge(metric.Histogram); err != nil {
+		return nil, fmt.Errorf("cannot merge histogram %s: %w", metric.ID, err)
+	}
+
+	data, err := json.Marshal(res.Histogram)
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal histogram %s: %w", metric.ID, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, updateHistogramSQL, name, metric.ID, labels, data); err != nil {
+		return nil, fmt.Errorf("cannot update histogram metric %s: %w", metric.ID, err)
+	}
+
+	return res, nil
+}
+
+// AddHistogram implements storage.MetricsStorage
+func (m *Storage) AddHistogram(ctx context.Context, metric models.MetricDTO) (*models.MetricDTO, error) {
+	tx, err := m.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot start a transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := m.checkQuota(ctx, tx, []string{typedKey(metric.MType, metric.SeriesKey())}); err != nil {
+		return nil, err
+	}
+
+	res, err := m.mergeHistogram(ctx, tx, metric)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("cannot commit the transaction: %w", err)
+	}
+
+	return res, nil
+}
+
+// addObservations сохраняет наблюдения summary в рамках транзакции
+func (m *Storage) addObservations(ctx context.Context, tx *sql.Tx, metric models.MetricDTO) error {
+	labels := models.LabelsString(metric.Labels)
+
+	if _, err := tx.ExecContext(ctx, createMetricSQL, tenant.FromContext(ctx), metric.ID, labels, models.SummaryType); err != nil {
+		return fmt.Errorf("cannot insert summary metric %s: %w", metric.ID, err)
+	}
+
+	if len(metric.Observations) == 0 {
+		return nil
+	}
+
+	values := make([]string, 0, len(metric.Observations))
+	for _, observation := range metric.Observations {
+		values = append(values, fmt.Sprintf("($1, $2, $3, %s)", utils.Float64ToStr(observation))) //Без конвертации float скукожится
+	}
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(addObservationsSQL, strings.Join(values, ",")), tenant.FromContext(ctx), metric.ID, labels); err != nil {
+		return fmt.Errorf("cannot insert observations of metric %s: %w", metric.ID, err)
+	}
+
+	return nil
+}
+
+// AddSummary implements storage.MetricsStorage
+func (m *Storage) AddSummary(ctx context.Context, metric models.MetricDTO) error {
+	tx, err := m.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("cannot start a transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := m.checkQuota(ctx, tx, []string{typedKey(metric.MType, metric.SeriesKey())}); err != nil {
+		return err
+	}
+
+	if err := m.addObservations(ctx, tx, metric); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("cannot commit the transaction: %w", err)
+	}
+
+	return nil
 }
 
 // SetGauge implements storage.MetricsStorage
 func (m *Storage) SetGauge(ctx context.Context, metric models.MetricDTO) error {
+	tx, err := m.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("cannot start a transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := m.checkQuota(ctx, tx, []string{typedKey(metric.MType, metric.SeriesKey())}); err != nil {
+		return err
+	}
+
 	//Если метрики с таким именем не существует - вставляем, иначе обновляем
-	_, err := m.conn.ExecContext(ctx, setGaugeSQL, metric.ID, metric.MType, metric.Value)
+	_, err = tx.ExecContext(ctx, setGaugeSQL, tenant.FromContext(ctx), metric.ID, models.LabelsString(metric.Labels), metric.MType, metric.Value)
 
 	if err != nil {
 		return fmt.Errorf("cannot insert gauge metric %s: %w", metric.ID, err)
 	}
 
+	if err := m.addHistory(ctx, tx, metric); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("cannot commit the transaction: %w", err)
+	}
+
 	return nil
 }
 
@@ -116,19 +455,43 @@ func (m *Storage) AcceptMetricsBatch(ctx context.Context, metrics []models.Metri
 
 	gaugesMap := make(map[string]models.MetricDTO, 0)
 	countersMap := make(map[string]models.MetricDTO, 0)
+	histogramsMap := make(map[string]models.MetricDTO, 0)
+	summariesMap := make(map[string]models.MetricDTO, 0)
 
 	for _, metric := range metrics {
 
-		if metric.MType == models.GaugeType {
+		key := metric.SeriesKey()
+
+		switch metric.MType {
+		case models.GaugeType:
 			//Тут фиксируем последнюю метрику
-			gaugesMap[metric.ID] = metric
-		} else {
+			gaugesMap[key] = metric
+		case models.CounterType:
 			//А тут суммируем
-			if value, ok := countersMap[metric.ID]; ok {
+			if value, ok := countersMap[key]; ok {
 				value.SetDelta(*value.Delta + *metric.Delta)
 			} else {
-				countersMap[metric.ID] = metric
+				countersMap[key] = metric
+			}
+		case models.HistogramType:
+			//Гистограммы сливаем
+			if value, ok := histogramsMap[key]; ok {
+				if err := value.Histogram.Merge(metric.Histogram); err != nil {
+					return fmt.Errorf("cannot merge histogram %s: %w", key, err)
+				}
+			} else {
+				metric.Histogram = metric.Histogram.Copy()
+				histogramsMap[key] = metric
+			}
+		case models.SummaryType:
+			//Наблюдения собираем вместе
+			value, ok := summariesMap[key]
+			if !ok {
+				value = metric
+				value.Observations = nil
 			}
+			value.Observations = append(value.Observations, metric.Observations...)
+			summariesMap[key] = value
 		}
 	}
 
@@ -139,15 +502,29 @@ func (m *Storage) AcceptMetricsBatch(ctx context.Context, metrics []models.Metri
 	}
 	defer tx.Rollback()
 
+	//Квоту проверяем по всем рядам батча сразу, что бы не принять его наполовину
+	seriesKeys := make([]string, 0, len(gaugesMap)+len(countersMap)+len(histogramsMap)+len(summariesMap))
+	for _, batch := range []map[string]models.MetricDTO{gaugesMap, countersMap, histogramsMap, summariesMap} {
+		for key, metric := range batch {
+			seriesKeys = append(seriesKeys, typedKey(metric.MType, key))
+		}
+	}
+	if err = m.checkQuota(ctx, tx, seriesKeys); err != nil {
+		return err
+	}
+
+	name := tenant.FromContext(ctx)
+
 	if len(gaugesMap) > 0 {
 		//Тут составляем запрос для gauges
 		gauges := make([]string, 0, len(gaugesMap))
-		names := make([]interface{}, 0, len(gaugesMap))
-		i := 1
+		names := make([]interface{}, 0, 2*len(gaugesMap)+1)
+		names = append(names, name)
+		i := 2
 		for _, metric := range gaugesMap {
-			gauges = append(gauges, fmt.Sprintf("($%d, 'gauge', %s)", i, utils.Float64ToStr(*metric.Value))) //Без конвертации float скукожится и тесты не проходят
-			i++
-			names = append(names, metric.ID)
+			gauges = append(gauges, fmt.Sprintf("($1, $%d, $%d, 'gauge', %s)", i, i+1, utils.Float64ToStr(*metric.Value))) //Без конвертации float скукожится и тесты не проходят
+			i += 2
+			names = append(names, metric.ID, models.LabelsString(metric.Labels))
 		}
 
 		gaugesReq := fmt.Sprintf(setGaugesBatch, strings.Join(gauges, ","))
@@ -161,12 +538,13 @@ func (m *Storage) AcceptMetricsBatch(ctx context.Context, metrics []models.Metri
 	if len(countersMap) > 0 {
 		//Тут составляем запрос для gauges
 		counters := make([]string, 0, len(countersMap))
-		names := make([]interface{}, 0, len(countersMap))
-		i := 1
+		names := make([]interface{}, 0, 2*len(countersMap)+1)
+		names = append(names, name)
+		i := 2
 		for _, metric := range countersMap {
-			counters = append(counters, fmt.Sprintf("($%d, 'counter', %d)", i, *metric.Delta))
-			i++
-			names = append(names, metric.ID)
+			counters = append(counters, fmt.Sprintf("($1, $%d, $%d, 'counter', %d)", i, i+1, *metric.Delta))
+			i += 2
+			names = append(names, metric.ID, models.LabelsString(metric.Labels))
 		}
 
 		countersReq := fmt.Sprintf(setCountersBatch, strings.Join(counters, ","))
@@ -177,6 +555,33 @@ func (m *Storage) AcceptMetricsBatch(ctx context.Context, metrics []models.Metri
 		}
 	}
 
+	for _, metric := range histogramsMap {
+		if _, err = m.mergeHistogram(ctx, tx, metric); err != nil {
+			return err
+		}
+	}
+
+	for _, metric := range summariesMap {
+		if err = m.addObservations(ctx, tx, metric); err != nil {
+			return err
+		}
+	}
+
+	//Фиксируем в истории итоговые значения всех затронутых метрик
+	if m.historyRetention != 0 && len(metrics) > 0 {
+		keys := make([]string, 0, len(gaugesMap)+len(countersMap))
+		for key := range gaugesMap {
+			keys = append(keys, typedKey(models.GaugeType, key))
+		}
+		for key := range countersMap {
+			keys = append(keys, typedKey(models.CounterType, key))
+		}
+
+		if _, err = tx.ExecContext(ctx, addHistoryBatchSQL, name, keys); err != nil {
+			return fmt.Errorf("cannot exec history batch: %w", err)
+		}
+	}
+
 	// завершаем транзакцию
 	err = tx.Commit()
 	if err != nil {
@@ -187,38 +592,110 @@ func (m *Storage) AcceptMetricsBatch(ctx context.Context, metrics []models.Metri
 }
 
 func (m *Storage) GetCounter(ctx context.Context, key string) (*models.MetricDTO, error) {
-	return m.getMetricByID(ctx, key)
+	return m.getMetricByID(ctx, models.CounterType, key)
+}
+
+// GetHistogram implements storage.MetricsStorage
+func (m *Storage) GetHistogram(ctx context.Context, key string) (*models.MetricDTO, error) {
+	return m.getMetricByID(ctx, models.HistogramType, key)
+}
+
+// summarySnapshot считает summary по наблюдениям в окне
+func (m *Storage) summarySnapshot(ctx context.Context, metric models.MetricDTO, quantiles []float64) (*models.Summary, error) {
+	labels := models.LabelsString(metric.Labels)
+	from := time.Now().Add(-m.summaryWindow)
+
+	name := tenant.FromContext(ctx)
+
+	res := &models.Summary{}
+	row := m.conn.QueryRowContext(ctx, selectSummarySQL, name, metric.ID, labels, from)
+	if err := row.Scan(&res.Sum, &res.Count); err != nil {
+		return nil, fmt.Errorf("cannot scan row: %w", err)
+	}
+
+	if res.Count == 0 {
+		return res, nil
+	}
+
+	for _, q := range quantiles {
+		var value sql.NullFloat64
+		row := m.conn.QueryRowContext(ctx, selectQuantileSQL, name, metric.ID, labels, from, q)
+		if err := row.Scan(&value); err != nil {
+			return nil, fmt.Errorf("cannot scan row: %w", err)
+		}
+
+		if value.Valid {
+			res.Quantiles = append(res.Quantiles, models.Quantile{Quantile: q, Value: value.Float64})
+		}
+	}
+
+	return res, nil
+}
+
+// GetSummary implements storage.MetricsStorage
+func (m *Storage) GetSummary(ctx context.Context, key string, quantiles []float64) (*models.MetricDTO, error) {
+	metric, err := m.getMetricByID(ctx, models.SummaryType, key)
+	if err != nil {
+		return nil, err
+	}
+
+	metric.Summary, err = m.summarySnapshot(ctx, *metric, quantiles)
+	if err != nil {
+		return nil, err
+	}
+
+	return metric, nil
 }
 
 // GetGauge implements storage.MetricsStorage
 func (m *Storage) GetGauge(ctx context.Context, key string) (*models.MetricDTO, error) {
-	return m.getMetricByID(ctx, key)
+	return m.getMetricByID(ctx, models.GaugeType, key)
 }
 
 // GetMetricsList implements storage.MetricsStorage
-func (m *Storage) GetMetricsList(ctx context.Context) ([]string, error) {
+func (m *Storage) GetMetricsList(ctx context.Context, filter map[string]string) ([]string, error) {
+	metrics, err := m.GetMetrics(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
 
-	list := make([]string, 0)
+	list := make([]string, 0, len(metrics))
 
-	var metric models.MetricDTO
-	rows, err := m.conn.QueryContext(ctx, getAllMerticsSQL)
+	for _, metric := range metrics {
+		if metric.MType == models.GaugeType {
+			strValue := utils.Float64ToStr(*metric.Value)
+			list = append(list, fmt.Sprintf("%s = %s", metric.SeriesKey(), strValue))
+		} else if metric.MType == models.CounterType {
+			list = append(list, fmt.Sprintf("%s = %d", metric.SeriesKey(), *metric.Delta))
+		} else if metric.MType == models.HistogramType && metric.Histogram != nil {
+			list = append(list, fmt.Sprintf("%s = count %d, sum %s", metric.SeriesKey(), metric.Histogram.Count, utils.Float64ToStr(metric.Histogram.Sum)))
+		} else if metric.MType == models.SummaryType && metric.Summary != nil {
+			list = append(list, fmt.Sprintf("%s = count %d, sum %s", metric.SeriesKey(), metric.Summary.Count, utils.Float64ToStr(metric.Summary.Sum)))
+		}
+	}
+
+	return list, nil
+}
+
+// GetMetrics implements storage.MetricsStorage
+func (m *Storage) GetMetrics(ctx context.Context, filter map[string]string) ([]models.MetricDTO, error) {
+	rows, err := m.conn.QueryContext(ctx, getAllMerticsSQL, tenant.FromContext(ctx))
 	if err != nil {
 		return nil, fmt.Errorf("cannot query contex: %w", err)
 	}
 
 	defer rows.Close()
 
+	metrics := make([]models.MetricDTO, 0)
 	for rows.Next() {
-		err = rows.Scan(&metric.ID, &metric.MType, &metric.Delta, &metric.Value)
+		metric, err := scanMetric(rows)
 		if err != nil {
-			return nil, fmt.Errorf("cannot scan row: %w", err)
+			return nil, err
 		}
 
-		if metric.MType == models.GaugeType {
-			strValue := utils.Float64ToStr(*metric.Value)
-			list = append(list, fmt.Sprintf("%s = %s", metric.ID, strValue))
-		} else if metric.MType == models.CounterType {
-			list = append(list, fmt.Sprintf("%s = %d", metric.ID, *metric.Delta))
+		//Метки хранятся строкой, фильтруем уже разобранные
+		if models.MatchLabels(metric.Labels, filter) {
+			metrics = append(metrics, *metric)
 		}
 	}
 
@@ -228,7 +705,45 @@ func (m *Storage) GetMetricsList(ctx context.Context) ([]string, error) {
 		return nil, fmt.Errorf("query rows: %w", err)
 	}
 
-	return list, nil
+	//Для summary считаем квантили по окну
+	for i := range metrics {
+		if metrics[i].MType == models.SummaryType {
+			if metrics[i].Summary, err = m.summarySnapshot(ctx, metrics[i], models.DefaultQuantiles); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return metrics, nil
+}
+
+// GetHistory implements storage.MetricsStorage
+func (m *Storage) GetHistory(ctx context.Context, mType string, key string, from time.Time, to time.Time) ([]models.MetricPoint, error) {
+	id, labels := models.SplitSeriesKey(key)
+
+	rows, err := m.conn.QueryContext(ctx, selectHistorySQL, tenant.FromContext(ctx), mType, id, labels, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("cannot query contex: %w", err)
+	}
+
+	defer rows.Close()
+
+	points := make([]models.MetricPoint, 0)
+	for rows.Next() {
+		var point models.MetricPoint
+		if err = rows.Scan(&point.Timestamp, &point.Delta, &point.Value); err != nil {
+			return nil, fmt.Errorf("cannot scan row: %w", err)
+		}
+		points = append(points, point)
+	}
+
+	// проверяем на ошибки
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("query rows: %w", err)
+	}
+
+	return points, nil
 }
 
 func (m *Storage) PingStorage(ctx context.Context) error {
@@ -239,5 +754,10 @@ func (m *Storage) PingStorage(ctx context.Context) error {
 }
 
 func (m *Storage) Close() {
+	//Стопаем если вообще был запущен
+	if m.pruneScheduler != (scheduler.Scheduler{}) {
+		m.pruneScheduler.Stop()
+	}
+
 	m.conn.Close()
 }
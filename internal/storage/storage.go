@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"time"
 
 	"github.com/AntonPashechko/yametrix/internal/models"
 )
@@ -9,11 +10,20 @@ import (
 type MetricsStorage interface {
 	SetGauge(context.Context, models.MetricDTO) error
 	AddCounter(context.Context, models.MetricDTO) (*models.MetricDTO, error)
+	AddHistogram(context.Context, models.MetricDTO) (*models.MetricDTO, error)
+	AddSummary(context.Context, models.MetricDTO) error
 	AcceptMetricsBatch(context.Context, []models.MetricDTO) error
 
+	//Метрики ищутся по идентификатору ряда models.SeriesKey - имени с метками
 	GetGauge(context.Context, string) (*models.MetricDTO, error)
 	GetCounter(context.Context, string) (*models.MetricDTO, error)
-	GetMetricsList(context.Context) ([]string, error)
+	GetHistogram(context.Context, string) (*models.MetricDTO, error)
+	GetSummary(ctx context.Context, key string, quantiles []float64) (*models.MetricDTO, error)
+	GetHistory(ctx context.Context, mType string, key string, from time.Time, to time.Time) ([]models.MetricPoint, error)
+
+	//Списки фильтруются по меткам, пустой фильтр - все метрики
+	GetMetricsList(ctx context.Context, filter map[string]string) ([]string, error)
+	GetMetrics(ctx context.Context, filter map[string]string) ([]models.MetricDTO, error)
 
 	PingStorage(context.Context) error
 	Close()
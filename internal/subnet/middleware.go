@@ -0,0 +1,29 @@
+package subnet
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/AntonPashechko/yametrix/internal/logger"
+)
+
+// Middleware пропускает только запросы агентов из доверенной подсети
+func Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		//Подсеть не задана - принимаем от всех
+		trusted := Trusted()
+		if trusted == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		if realIP := r.Header.Get(Header); !Contains(realIP) {
+			logger.Error(fmt.Sprintf("agent ip %q is not in trusted subnet %s", realIP, trusted))
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		//Вызов целевого handler
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,69 @@
+package subnet
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sync/atomic"
+)
+
+const (
+	// Header - заголовок, в котором агент передает свой IP
+	Header = "X-Real-IP"
+	// MetadataKey - то же для gRPC
+	MetadataKey = "x-real-ip"
+)
+
+// trustedSubnet - подсеть, из которой принимаются метрики, nil - проверка выключена.
+// Меняется на лету при перечитывании конфигурации, поэтому atomic
+var trustedSubnet atomic.Pointer[net.IPNet]
+
+// Initialize разбирает доверенную подсеть в CIDR нотации, пустая строка выключает проверку
+func Initialize(cidr string) error {
+	if cidr == "" {
+		trustedSubnet.Store(nil)
+		return nil
+	}
+
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return fmt.Errorf("bad trusted subnet %s: %w", cidr, err)
+	}
+
+	trustedSubnet.Store(ipNet)
+	return nil
+}
+
+// Trusted - доверенная подсеть, nil - не задана
+func Trusted() *net.IPNet {
+	return trustedSubnet.Load()
+}
+
+// Contains проверяет, что IP из заголовка агента входит в доверенную подсеть
+func Contains(value string) bool {
+	trusted := Trusted()
+	ip := net.ParseIP(value)
+	return ip != nil && trusted != nil && trusted.Contains(ip)
+}
+
+// OutboundIP определяет IP интерфейса, через который агент ходит на сервер.
+// UDP Dial ничего не отправляет, только выбирает маршрут
+func OutboundIP(endpoint string) (net.IP, error) {
+	host := endpoint
+	if u, err := url.Parse(endpoint); err == nil && u.Host != "" {
+		host = u.Host
+	}
+
+	//Порт для выбора маршрута не важен, но Dial без него не работает
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, "80")
+	}
+
+	conn, err := net.Dial("udp", host)
+	if err != nil {
+		return nil, fmt.Errorf("cannot detect outbound address: %w", err)
+	}
+	defer conn.Close()
+
+	return conn.LocalAddr().(*net.UDPAddr).IP, nil
+}
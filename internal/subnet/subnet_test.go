@@ -0,0 +1,66 @@
+package subnet
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name     string
+		subnet   string
+		realIP   string
+		wantCode int
+	}{
+		{"no_subnet", "", "", http.StatusOK},
+		{"trusted", "192.168.1.0/24", "192.168.1.15", http.StatusOK},
+		{"trusted_ipv6", "fd00::/8", "fd00::1", http.StatusOK},
+		{"outside", "192.168.1.0/24", "10.0.0.1", http.StatusForbidden},
+		{"no_header", "192.168.1.0/24", "", http.StatusForbidden},
+		{"bad_header", "192.168.1.0/24", "192.168.1", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, Initialize(tt.subnet))
+			defer Initialize("")
+
+			r := httptest.NewRequest(http.MethodPost, "/updates/", nil)
+			if tt.realIP != "" {
+				r.Header.Set(Header, tt.realIP)
+			}
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+		})
+	}
+}
+
+func TestInitialize(t *testing.T) {
+	defer Initialize("")
+
+	assert.Error(t, Initialize("192.168.1.0"))
+	assert.Error(t, Initialize("192.168.1.0/33"))
+	assert.NoError(t, Initialize("192.168.1.0/24"))
+	assert.NotNil(t, Trusted())
+
+	//Пустая подсеть выключает проверку
+	assert.NoError(t, Initialize(""))
+	assert.Nil(t, Trusted())
+}
+
+func TestOutboundIP(t *testing.T) {
+	//До loopback маршрут всегда через loopback
+	for _, endpoint := range []string{"http://127.0.0.1:8080", "127.0.0.1:8080", "https://127.0.0.1"} {
+		ip, err := OutboundIP(endpoint)
+		require.NoError(t, err)
+		assert.Equal(t, "127.0.0.1", ip.String())
+	}
+}
@@ -0,0 +1,146 @@
+package summary
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/AntonPashechko/yametrix/internal/models"
+)
+
+const (
+	ageBuckets = 5    //на сколько частей делится окно
+	maxSamples = 1024 //сколько наблюдений хранится в одной части, остальные попадают в выборку случайно
+)
+
+// bucket - наблюдения за часть окна
+type bucket struct {
+	start   time.Time
+	samples []float64
+	seen    uint64 //сколько наблюдений пришло, для выборки
+	sum     float64
+}
+
+/*
+Скользящее окно наблюдений для оценки квантилей. Окно делится на части, устаревшие части отбрасываются целиком.
+В каждой части хранится не больше maxSamples наблюдений (reservoir sampling), сумма и количество считаются точно
+*/
+type Window struct {
+	width   time.Duration //длительность одной части окна
+	buckets []*bucket     //по возрастанию времени начала
+}
+
+func NewWindow(window time.Duration) *Window {
+	width := window / ageBuckets
+	if width <= 0 {
+		width = time.Nanosecond
+	}
+
+	return &Window{
+		width: width,
+	}
+}
+
+// rotate отбрасывает части, вышедшие за окно
+func (m *Window) rotate(now time.Time) {
+	border := now.Add(-m.width * ageBuckets)
+
+	first := 0
+	for first < len(m.buckets) && !m.buckets[first].start.Add(m.width).After(border) {
+		first++
+	}
+
+	m.buckets = m.buckets[first:]
+}
+
+// Observe добавляет наблюдения
+func (m *Window) Observe(now time.Time, values ...float64) {
+	m.rotate(now)
+
+	var current *bucket
+	if last := len(m.buckets) - 1; last >= 0 && now.Before(m.buckets[last].start.Add(m.width)) {
+		current = m.buckets[last]
+	} else {
+		current = &bucket{start: now.Truncate(m.width)}
+		m.buckets = append(m.buckets, current)
+	}
+
+	for _, value := range values {
+		if math.IsNaN(value) {
+			continue
+		}
+
+		current.seen++
+		current.sum += value
+
+		if len(current.samples) < maxSamples {
+			current.samples = append(current.samples, value)
+		} else if i := rand.Int63n(int64(current.seen)); i < maxSamples {
+			current.samples[i] = value
+		}
+	}
+}
+
+// Empty сообщает, что в окне не осталось наблюдений
+func (m *Window) Empty(now time.Time) bool {
+	m.rotate(now)
+	return len(m.buckets) == 0
+}
+
+// Snapshot считает квантили, сумму и количество наблюдений в окне
+func (m *Window) Snapshot(now time.Time, quantiles []float64) *models.Summary {
+	m.rotate(now)
+
+	res := &models.Summary{}
+	samples := make([]float64, 0)
+	weights := make([]float64, 0)
+
+	for _, b := range m.buckets {
+		res.Sum += b.sum
+		res.Count += b.seen
+
+		//Каждое наблюдение из выборки представляет seen/len(samples) реальных
+		weight := float64(b.seen) / float64(len(b.samples))
+		for _, sample := range b.samples {
+			samples = append(samples, sample)
+			weights = append(weights, weight)
+		}
+	}
+
+	if len(samples) == 0 {
+		return res
+	}
+
+	order := make([]int, len(samples))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return samples[order[i]] < samples[order[j]]
+	})
+
+	for _, q := range quantiles {
+		res.Quantiles = append(res.Quantiles, models.Quantile{
+			Quantile: q,
+			Value:    weightedQuantile(q, samples, weights, order, float64(res.Count)),
+		})
+	}
+
+	return res
+}
+
+// weightedQuantile ищет значение, до которого набирается доля q от общего веса
+func weightedQuantile(q float64, samples []float64, weights []float64, order []int, total float64) float64 {
+	target := q * total
+
+	var acc float64
+	for _, i := range order {
+		acc += weights[i]
+		if acc >= target {
+			return samples[i]
+		}
+	}
+
+	return samples[order[len(order)-1]]
+}
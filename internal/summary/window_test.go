@@ -0,0 +1,64 @@
+package summary
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWindow_Snapshot(t *testing.T) {
+	window := NewWindow(time.Minute)
+	now := time.Now()
+
+	values := make([]float64, 0, 100)
+	for i := 1; i <= 100; i++ {
+		values = append(values, float64(i))
+	}
+	window.Observe(now, values...)
+
+	summary := window.Snapshot(now, []float64{0.5, 0.9, 0.99})
+	assert.Equal(t, uint64(100), summary.Count)
+	assert.Equal(t, float64(5050), summary.Sum)
+
+	p50, ok := summary.QuantileValue(0.5)
+	assert.True(t, ok)
+	assert.Equal(t, float64(50), p50)
+
+	p99, _ := summary.QuantileValue(0.99)
+	assert.Equal(t, float64(99), p99)
+}
+
+func TestWindow_slide(t *testing.T) {
+	window := NewWindow(time.Minute)
+	now := time.Now()
+
+	window.Observe(now, 1000)
+	window.Observe(now.Add(50*time.Second), 1, 2, 3)
+
+	//Окно сдвигается частями, через минуту с небольшим первое наблюдение гарантированно вышло из окна
+	later := now.Add(80 * time.Second)
+	summary := window.Snapshot(later, []float64{0.99})
+	assert.Equal(t, uint64(3), summary.Count)
+
+	p99, _ := summary.QuantileValue(0.99)
+	assert.Equal(t, float64(3), p99)
+
+	assert.True(t, window.Empty(later.Add(time.Minute)))
+}
+
+func TestWindow_sampling(t *testing.T) {
+	window := NewWindow(time.Minute)
+	now := time.Now()
+
+	//Наблюдений больше, чем помещается в выборку - квантили оцениваются приблизительно
+	for i := 0; i < 10*maxSamples; i++ {
+		window.Observe(now, float64(i%100))
+	}
+
+	summary := window.Snapshot(now, []float64{0.5})
+	assert.Equal(t, uint64(10*maxSamples), summary.Count)
+
+	p50, _ := summary.QuantileValue(0.5)
+	assert.InDelta(t, 50, p50, 10)
+}
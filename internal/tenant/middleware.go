@@ -0,0 +1,49 @@
+package tenant
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/AntonPashechko/yametrix/internal/auth"
+	"github.com/AntonPashechko/yametrix/internal/logger"
+)
+
+// Resolve выбирает тенанта: токен с тенантом задает его жестко, иначе берется заголовок.
+// Возвращает HTTP код ошибки
+func Resolve(identity *auth.Identity, header string) (string, int, error) {
+	if identity != nil && identity.Tenant != "" {
+		//Тенант токена из файла или БД, проверяем так же как заголовок
+		if err := Validate(identity.Tenant); err != nil {
+			return "", http.StatusInternalServerError, fmt.Errorf("token %s: %w", identity.Name, err)
+		}
+		if header != "" && header != identity.Tenant {
+			return "", http.StatusForbidden, fmt.Errorf("%s cannot access tenant %q", identity.Name, header)
+		}
+		return identity.Tenant, http.StatusOK, nil
+	}
+
+	if header == "" {
+		return Default, http.StatusOK, nil
+	}
+
+	if err := Validate(header); err != nil {
+		return "", http.StatusBadRequest, err
+	}
+
+	return header, http.StatusOK, nil
+}
+
+// Middleware кладет тенанта запроса в контекст, должен стоять после auth.Middleware
+func Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, code, err := Resolve(auth.FromContext(r.Context()), r.Header.Get(Header))
+		if err != nil {
+			logger.Error(fmt.Sprintf("cannot resolve tenant: %s", err))
+			w.WriteHeader(code)
+			return
+		}
+
+		//Вызов целевого handler
+		h.ServeHTTP(w, r.WithContext(WithTenant(r.Context(), name)))
+	})
+}
@@ -0,0 +1,67 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+const (
+	// Header - заголовок с пространством имен, если его не задает токен
+	Header = "X-Tenant"
+	// MetadataKey - то же для gRPC
+	MetadataKey = "x-tenant"
+	// Default - пространство имен метрик без тенанта, в нем живут все метрики до разделения
+	Default = ""
+)
+
+// ErrQuotaExceeded - у тенанта кончилась квота на количество рядов
+var ErrQuotaExceeded = errors.New("series quota exceeded")
+
+var nameRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Validate проверяет имя тенанта, оно становится частью ключей хранилища
+func Validate(name string) error {
+	if !nameRegexp.MatchString(name) {
+		return fmt.Errorf("bad tenant name %q", name)
+	}
+	return nil
+}
+
+type tenantKey struct{}
+
+// WithTenant кладет тенанта в контекст, хранилища берут его оттуда
+func WithTenant(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, name)
+}
+
+// FromContext - тенант запроса, без него - Default
+func FromContext(ctx context.Context) string {
+	name, _ := ctx.Value(tenantKey{}).(string)
+	return name
+}
+
+// Quotas - ограничения количества рядов, 0 - без ограничения
+type Quotas struct {
+	Default int            //для тенантов без своей квоты
+	Tenants map[string]int //свои квоты тенантов
+}
+
+// Limit - квота тенанта, 0 - без ограничения
+func (m Quotas) Limit(name string) int {
+	if limit, ok := m.Tenants[name]; ok {
+		return limit
+	}
+	return m.Default
+}
+
+// Check проверяет, что новые ряды влезают в квоту
+func (m Quotas) Check(name string, count int, added int) error {
+	limit := m.Limit(name)
+	if limit == 0 || added == 0 || count+added <= limit {
+		return nil
+	}
+
+	return fmt.Errorf("tenant %q has %d of %d series: %w", name, count, limit, ErrQuotaExceeded)
+}
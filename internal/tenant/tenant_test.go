@@ -0,0 +1,104 @@
+package tenant
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AntonPashechko/yametrix/internal/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name     string
+		identity *auth.Identity
+		header   string
+		want     string
+		wantCode int
+	}{
+		{"default", nil, "", Default, http.StatusOK},
+		{"header", nil, "team-a", "team-a", http.StatusOK},
+		{"bad_header", nil, "team a", "", http.StatusBadRequest},
+		{"token_tenant", &auth.Identity{Name: "agent", Tenant: "team-a"}, "", "team-a", http.StatusOK},
+		{"token_same_header", &auth.Identity{Name: "agent", Tenant: "team-a"}, "team-a", "team-a", http.StatusOK},
+		{"token_other_header", &auth.Identity{Name: "agent", Tenant: "team-a"}, "team-b", "", http.StatusForbidden},
+		{"token_without_tenant", &auth.Identity{Name: "admin"}, "team-b", "team-b", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, code, err := Resolve(tt.identity, tt.header)
+			assert.Equal(t, tt.wantCode, code)
+			assert.Equal(t, tt.want, name)
+			assert.Equal(t, tt.wantCode != http.StatusOK, err != nil)
+		})
+	}
+}
+
+func TestQuotas(t *testing.T) {
+	quotas := Quotas{Default: 10, Tenants: map[string]int{"big": 0, "small": 2}}
+
+	tests := []struct {
+		name    string
+		tenant  string
+		count   int
+		added   int
+		wantErr bool
+	}{
+		{"default_fits", "team-a", 9, 1, false},
+		{"default_exceeded", "team-a", 10, 1, true},
+		{"unlimited", "big", 1000, 10, false},
+		{"own_fits", "small", 0, 2, false},
+		{"own_exceeded", "small", 1, 2, true},
+		{"nothing_added", "small", 5, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := quotas.Check(tt.tenant, tt.count, tt.added)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrQuotaExceeded)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var got string
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = FromContext(r.Context())
+	}))
+
+	tests := []struct {
+		name     string
+		identity *auth.Identity
+		header   string
+		want     string
+		wantCode int
+	}{
+		{"no_tenant", nil, "", Default, http.StatusOK},
+		{"header", nil, "team-a", "team-a", http.StatusOK},
+		{"token", &auth.Identity{Name: "agent", Tenant: "team-b"}, "", "team-b", http.StatusOK},
+		{"forbidden", &auth.Identity{Name: "agent", Tenant: "team-b"}, "team-a", "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = ""
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.identity != nil {
+				request = request.WithContext(auth.WithIdentity(context.Background(), tt.identity))
+			}
+			if tt.header != "" {
+				request.Header.Set(Header, tt.header)
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, request)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
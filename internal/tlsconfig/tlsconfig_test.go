@@ -0,0 +1,154 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func writePEM(t *testing.T, path string, blockType string, der []byte) {
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600))
+}
+
+// newCA создает самоподписанный CA и пишет его сертификат в файл
+func newCA(t *testing.T, dir string) (*testCA, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	path := filepath.Join(dir, "ca.pem")
+	writePEM(t, path, "CERTIFICATE", der)
+
+	return &testCA{cert: cert, key: key}, path
+}
+
+// issue выпускает сертификат, подписанный CA, возвращает пути сертификата и ключа
+func (m *testCA) issue(t *testing.T, dir string, name string, usage x509.ExtKeyUsage) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, m.cert, &key.PublicKey, m.key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certPath := filepath.Join(dir, name+".pem")
+	keyPath := filepath.Join(dir, name+"-key.pem")
+	writePEM(t, certPath, "CERTIFICATE", der)
+	writePEM(t, keyPath, "EC PRIVATE KEY", keyDER)
+
+	return certPath, keyPath
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, caPath := newCA(t, dir)
+	serverCert, serverKey := ca.issue(t, dir, "server", x509.ExtKeyUsageServerAuth)
+	agentCert, agentKey := ca.issue(t, dir, "agent", x509.ExtKeyUsageClientAuth)
+
+	//Чужой CA - его сертификатам сервер не доверяет
+	otherDir := t.TempDir()
+	other, _ := newCA(t, otherDir)
+	strangerCert, strangerKey := other.issue(t, otherDir, "stranger", x509.ExtKeyUsageClientAuth)
+
+	serverConfig, err := NewServerConfig(serverCert, serverKey, caPath)
+	require.NoError(t, err)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	server.TLS = serverConfig
+	server.StartTLS()
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		ca      string
+		cert    string
+		key     string
+		wantErr bool
+	}{
+		{"agent_cert", caPath, agentCert, agentKey, false},
+		{"no_client_cert", caPath, "", "", true},
+		{"foreign_client_cert", caPath, strangerCert, strangerKey, true},
+		{"system_roots", "", agentCert, agentKey, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientConfig, err := NewClientConfig(tt.ca, tt.cert, tt.key)
+			require.NoError(t, err)
+
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig}}
+			resp, err := client.Get(server.URL)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		})
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	ca, caPath := newCA(t, dir)
+	cert, key := ca.issue(t, dir, "server", x509.ExtKeyUsageServerAuth)
+
+	_, err := NewServerConfig(cert, filepath.Join(dir, "missing.pem"), "")
+	assert.Error(t, err)
+
+	//Ключ вместо бандла CA
+	_, err = NewServerConfig(cert, key, key)
+	assert.Error(t, err)
+
+	_, err = NewClientConfig(filepath.Join(dir, "missing.pem"), "", "")
+	assert.Error(t, err)
+
+	_, err = NewClientConfig(caPath, cert, caPath)
+	assert.Error(t, err)
+}
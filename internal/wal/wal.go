@@ -0,0 +1,376 @@
+package wal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AntonPashechko/yametrix/internal/models"
+)
+
+const (
+	segmentExt = ".wal"
+
+	headerSize = 8       //длина и контрольная сумма записи, по 4 байта
+	maxRecord  = 1 << 28 //запись длиннее - испорченный заголовок, а не настоящий батч
+)
+
+var (
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+	// errTorn - запись оборвана: файл кончился посреди нее
+	errTorn = errors.New("torn wal record")
+)
+
+// Entry - запись журнала: обновления одного вызова Append, батч целиком.
+// На диске запись - заголовок (длина, crc32) и JSON, поэтому оборванный батч не применяется частично
+type Entry struct {
+	Tenant    string             `json:"tenant,omitempty"`
+	Timestamp time.Time          `json:"ts"`
+	Metrics   []models.MetricDTO `json:"metrics"`
+}
+
+// Log - журнал из сегментов <номер>.wal в каталоге. Пишется только последний сегмент,
+// при снимке начинается новый, а предыдущие удаляются
+type Log struct {
+	dir     string
+	mux     sync.Mutex
+	file    *os.File
+	segment uint64
+	size    int64  //Длина сегмента по целым записям
+	written uint64 //Количество записей, порядковый номер последней
+	broken  error  //Оборванную запись не удалось отрезать - дальше писать нельзя, записи за ней не прочитать
+
+	//Сброс на диск идет без mux, одним fsync сразу за все записи, накопленные к его началу
+	syncMux sync.Mutex
+	synced  uint64 //Записи до этого номера уже на диске
+}
+
+func segmentPath(dir string, segment uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%016d%s", segment, segmentExt))
+}
+
+// segments возвращает номера сегментов каталога по возрастанию
+func segments(dir string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read wal dir: %w", err)
+	}
+
+	var res []uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+
+		segment, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		res = append(res, segment)
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i] < res[j] })
+	return res, nil
+}
+
+// Open открывает журнал на новом сегменте после уже существующих.
+// Хвост последнего сегмента, оборванный падением, отрезается
+func Open(dir string) (*Log, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("cannot create wal dir: %w", err)
+	}
+
+	existing, err := segments(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	next := uint64(1)
+	if len(existing) != 0 {
+		last := existing[len(existing)-1]
+		if err := repair(segmentPath(dir, last)); err != nil {
+			return nil, err
+		}
+		next = last + 1
+	}
+
+	log := &Log{dir: dir}
+	if err := log.open(next); err != nil {
+		return nil, err
+	}
+
+	return log, nil
+}
+
+// repair обрезает сегмент по последней целой записи
+func repair(path string) error {
+	file, err := os.OpenFile(path, os.O_RDWR, 0666)
+	if err != nil {
+		return fmt.Errorf("cannot open wal segment: %w", err)
+	}
+	defer file.Close()
+
+	var size int64
+	reader := bufio.NewReader(file)
+	for {
+		payload, err := readRecord(reader)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			break
+		}
+		size += int64(headerSize + len(payload))
+	}
+
+	if err := file.Truncate(size); err != nil {
+		return fmt.Errorf("cannot truncate torn wal segment: %w", err)
+	}
+
+	return file.Sync()
+}
+
+// open начинает сегмент, вызывается под mux
+func (m *Log) open(segment uint64) error {
+	file, err := os.OpenFile(segmentPath(m.dir, segment), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return fmt.Errorf("cannot open wal segment: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("cannot stat wal segment: %w", err)
+	}
+
+	m.file = file
+	m.segment = segment
+	m.size = info.Size()
+	m.broken = nil
+	return nil
+}
+
+// Append пишет обновления одной записью. Порядок записей задает mux журнала,
+// на диск их сбрасывает Sync - ответ агенту уходит уже после него
+func (m *Log) Append(tenant string, ts time.Time, metrics ...models.MetricDTO) error {
+	payload, err := json.Marshal(Entry{Tenant: tenant, Timestamp: ts, Metrics: metrics})
+	if err != nil {
+		return fmt.Errorf("cannot marshal wal entry: %w", err)
+	}
+
+	record := make([]byte, headerSize, headerSize+len(payload))
+	binary.LittleEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(record[4:8], crc32.Checksum(payload, crcTable))
+	record = append(record, payload...)
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	if m.broken != nil {
+		return m.broken
+	}
+
+	if _, err := m.file.Write(record); err != nil {
+		//Часть записи могла попасть в файл - отрезаем ее, иначе следующие записи окажутся за мусором
+		if truncErr := m.file.Truncate(m.size); truncErr != nil {
+			m.broken = fmt.Errorf("wal segment is broken: %w", truncErr)
+		}
+		return fmt.Errorf("cannot write wal entry: %w", err)
+	}
+	m.size += int64(len(record))
+	m.written++
+
+	return nil
+}
+
+// Sync сбрасывает на диск все записанные к этому моменту записи. Пока идет fsync, новые записи
+// копятся и сбрасываются следующим вызовом, а вызовы, чьи записи уже на диске, сразу возвращаются
+func (m *Log) Sync() error {
+	m.syncMux.Lock()
+	defer m.syncMux.Unlock()
+
+	m.mux.Lock()
+	file, written := m.file, m.written
+	m.mux.Unlock()
+
+	if m.synced >= written {
+		return nil
+	}
+
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("cannot sync wal segment: %w", err)
+	}
+	m.synced = written
+
+	return nil
+}
+
+// syncLocked сбрасывает текущий сегмент перед его закрытием, вызывается под syncMux и mux
+func (m *Log) syncLocked() error {
+	if m.synced >= m.written {
+		return nil
+	}
+
+	if err := m.file.Sync(); err != nil {
+		return fmt.Errorf("cannot sync wal segment: %w", err)
+	}
+	m.synced = m.written
+
+	return nil
+}
+
+// Rotate закрывает текущий сегмент и начинает следующий, возвращает номер нового
+func (m *Log) Rotate() (uint64, error) {
+	m.syncMux.Lock()
+	defer m.syncMux.Unlock()
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	if err := m.syncLocked(); err != nil {
+		return 0, err
+	}
+
+	if err := m.file.Close(); err != nil {
+		return 0, fmt.Errorf("cannot close wal segment: %w", err)
+	}
+
+	if err := m.open(m.segment + 1); err != nil {
+		return 0, err
+	}
+
+	return m.segment, nil
+}
+
+// Compact удаляет сегменты до before - их обновления уже в снимке
+func (m *Log) Compact(before uint64) error {
+	existing, err := segments(m.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, segment := range existing {
+		if segment >= before {
+			break
+		}
+		if err := os.Remove(segmentPath(m.dir, segment)); err != nil {
+			return fmt.Errorf("cannot remove wal segment: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (m *Log) Close() error {
+	m.syncMux.Lock()
+	defer m.syncMux.Unlock()
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	err := m.syncLocked()
+	if closeErr := m.file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// Replay применяет по порядку записи сегментов, начиная с from, возвращает их количество.
+// Оборванная при падении последняя запись пропускается
+func Replay(dir string, from uint64, apply func(Entry) error) (int, error) {
+	existing, err := segments(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	for _, segment := range existing {
+		if segment < from {
+			continue
+		}
+
+		n, err := replaySegment(segmentPath(dir, segment), apply)
+		count += n
+		if err != nil {
+			return count, fmt.Errorf("segment %d: %w", segment, err)
+		}
+	}
+
+	return count, nil
+}
+
+// readRecord читает запись: io.EOF - записей больше нет, errTorn - файл оборван посреди записи
+func readRecord(reader *bufio.Reader) ([]byte, error) {
+	header := make([]byte, headerSize)
+	if n, err := io.ReadFull(reader, header); err != nil {
+		if err == io.EOF && n == 0 {
+			return nil, io.EOF
+		}
+		if err == io.ErrUnexpectedEOF {
+			return nil, errTorn
+		}
+		return nil, fmt.Errorf("cannot read wal segment: %w", err)
+	}
+
+	size := binary.LittleEndian.Uint32(header[0:4])
+	if size > maxRecord {
+		return nil, fmt.Errorf("bad wal record size %d", size)
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, errTorn
+		}
+		return nil, fmt.Errorf("cannot read wal segment: %w", err)
+	}
+
+	if crc32.Checksum(payload, crcTable) != binary.LittleEndian.Uint32(header[4:8]) {
+		return nil, fmt.Errorf("bad wal record checksum")
+	}
+
+	return payload, nil
+}
+
+func replaySegment(path string, apply func(Entry) error) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("cannot open wal segment: %w", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for count := 0; ; count++ {
+		payload, err := readRecord(reader)
+		if err == io.EOF || errors.Is(err, errTorn) {
+			return count, nil
+		}
+		if err != nil {
+			return count, fmt.Errorf("entry %d: %w", count+1, err)
+		}
+
+		var entry Entry
+		if err := json.Unmarshal(payload, &entry); err != nil {
+			return count, fmt.Errorf("entry %d: %w", count+1, err)
+		}
+
+		if err := apply(entry); err != nil {
+			return count, err
+		}
+	}
+}
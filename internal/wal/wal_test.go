@@ -0,0 +1,157 @@
+package wal
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AntonPashechko/yametrix/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func replayAll(t *testing.T, dir string, from uint64) []Entry {
+	var entries []Entry
+	_, err := Replay(dir, from, func(entry Entry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	require.NoError(t, err)
+	return entries
+}
+
+func TestLogReplay(t *testing.T) {
+	dir := t.TempDir()
+	ts := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	log, err := Open(dir)
+	require.NoError(t, err)
+	require.NoError(t, log.Append("", ts, models.NewGaugeMetric("Alloc", 1)))
+	require.NoError(t, log.Append("team-a", ts, models.NewCounterMetric("PollCount", 2)))
+
+	segment, err := log.Rotate()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), segment)
+	require.NoError(t, log.Append("", ts, models.NewGaugeMetric("Alloc", 3)))
+	require.NoError(t, log.Close())
+
+	entries := replayAll(t, dir, 0)
+	require.Len(t, entries, 3)
+	assert.Equal(t, "team-a", entries[1].Tenant)
+	assert.Equal(t, int64(2), *entries[1].Metrics[0].Delta)
+	assert.True(t, ts.Equal(entries[1].Timestamp))
+	assert.Equal(t, float64(3), *entries[2].Metrics[0].Value)
+
+	//Сегменты до снимка пропускаются
+	entries = replayAll(t, dir, segment)
+	require.Len(t, entries, 1)
+
+	//Новый журнал начинается после существующих сегментов
+	log, err = Open(dir)
+	require.NoError(t, err)
+	require.NoError(t, log.Compact(segment))
+	segment, err = log.Rotate()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), segment)
+	require.NoError(t, log.Close())
+
+	existing, err := segments(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{2, 3, 4}, existing)
+}
+
+func TestLogSync(t *testing.T) {
+	dir := t.TempDir()
+
+	log, err := Open(dir)
+	require.NoError(t, err)
+
+	//Параллельные писатели делят fsync, а каждый Sync покрывает запись вызвавшего
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, log.Append("", time.Now(), models.NewCounterMetric("PollCount", 1)))
+			assert.NoError(t, log.Sync())
+		}()
+	}
+	wg.Wait()
+
+	log.mux.Lock()
+	assert.Equal(t, log.written, log.synced)
+	log.mux.Unlock()
+	require.NoError(t, log.Close())
+
+	assert.Len(t, replayAll(t, dir, 0), 10)
+}
+
+func TestReplayTornEntry(t *testing.T) {
+	dir := t.TempDir()
+
+	log, err := Open(dir)
+	require.NoError(t, err)
+	require.NoError(t, log.Append("", time.Now(), models.NewGaugeMetric("Alloc", 1)))
+	require.NoError(t, log.Append("", time.Now(), models.NewGaugeMetric("Frees", 1), models.NewGaugeMetric("Sys", 1)))
+	require.NoError(t, log.Close())
+
+	//Батч, оборванный падением сервера посреди записи, не применяется даже частично
+	path := segmentPath(dir, 1)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(path, info.Size()-10))
+
+	entries := replayAll(t, dir, 0)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "Alloc", entries[0].Metrics[0].ID)
+
+	//Open отрезает оборванный хвост, записи после него читаются
+	log, err = Open(dir)
+	require.NoError(t, err)
+	require.NoError(t, log.Append("", time.Now(), models.NewGaugeMetric("HeapAlloc", 1)))
+	require.NoError(t, log.Close())
+
+	entries = replayAll(t, dir, 0)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "HeapAlloc", entries[1].Metrics[0].ID)
+}
+
+func TestReplayBatch(t *testing.T) {
+	dir := t.TempDir()
+
+	log, err := Open(dir)
+	require.NoError(t, err)
+	require.NoError(t, log.Append("team-a", time.Now(), models.NewGaugeMetric("Alloc", 1), models.NewCounterMetric("PollCount", 1)))
+	require.NoError(t, log.Close())
+
+	entries := replayAll(t, dir, 0)
+	require.Len(t, entries, 1)
+	assert.Len(t, entries[0].Metrics, 2)
+}
+
+func TestReplayBrokenEntry(t *testing.T) {
+	dir := t.TempDir()
+
+	log, err := Open(dir)
+	require.NoError(t, err)
+	require.NoError(t, log.Append("", time.Now(), models.NewGaugeMetric("Alloc", 1)))
+	require.NoError(t, log.Append("", time.Now(), models.NewGaugeMetric("Frees", 1)))
+	require.NoError(t, log.Close())
+
+	//Испорченная запись в середине сегмента - ошибка, а не молчаливый пропуск
+	file, err := os.OpenFile(segmentPath(dir, 1), os.O_WRONLY, 0666)
+	require.NoError(t, err)
+	_, err = file.WriteAt([]byte("xx"), headerSize+2)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	_, err = Replay(dir, 0, func(entry Entry) error { return nil })
+	assert.Error(t, err)
+}
+
+func TestReplayNoDir(t *testing.T) {
+	count, err := Replay(t.TempDir()+"/missing", 0, func(entry Entry) error { return nil })
+	assert.NoError(t, err)
+	assert.Zero(t, count)
+}